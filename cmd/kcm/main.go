@@ -23,6 +23,7 @@ func init() {
 	rootCmd.AddCommand(cmd.NewProvisionCommand())
 	rootCmd.AddCommand(cmd.NewDestroyCommand())
 	rootCmd.AddCommand(cmd.NewManifestsCommand())
+	rootCmd.AddCommand(cmd.NewPruneCommand(os.Stdin, os.Stdout))
 	rootCmd.AddCommand(cmd.NewDumpConfigCommand(os.Stdout))
 	rootCmd.AddCommand(cmd.NewVersionCommand(os.Stdout))
 
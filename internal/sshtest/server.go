@@ -0,0 +1,144 @@
+package sshtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Handler handles a command executed on the Server. It returns the standard
+// output, the standard error and the exit status of the command.
+type Handler func(cmd string) (stdout, stderr string, exitStatus int)
+
+// Server is an in-process SSH server that can be used in tests. It accepts
+// every client without authentication and passes all commands to a Handler.
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handler  Handler
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a new Server which listens on a random local port and
+// passes executed commands to handler.
+func NewServer(handler Handler) (*Server, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := &Server{
+		listener: listener,
+		config:   config,
+		handler:  handler,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and waits until all connections are closed.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go s.handleSession(channel, requests)
+	}
+}
+
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer s.wg.Done()
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var payload struct{ Command string }
+
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+
+		req.Reply(true, nil)
+
+		stdout, stderr, status := s.handler(payload.Command)
+
+		channel.Write([]byte(stdout))
+		channel.Stderr().Write([]byte(stderr))
+
+		exitStatus := struct{ Status uint32 }{uint32(status)}
+		channel.SendRequest("exit-status", false, ssh.Marshal(&exitStatus))
+
+		return
+	}
+}
@@ -0,0 +1,345 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	pluralize "github.com/gertd/go-pluralize"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Phases in which cluster hooks can run.
+	PreProvision  = "pre-provision"
+	PostProvision = "post-provision"
+	PreDestroy    = "pre-destroy"
+	PostDestroy   = "post-destroy"
+
+	// DefaultJobHookTimeout is the time a Job hook may take if no timeout
+	// is configured.
+	DefaultJobHookTimeout = 30 * time.Minute
+
+	// HookPhaseEnv is set in the environment of command hooks and contains
+	// the phase the hook runs in.
+	HookPhaseEnv = "KCM_HOOK_PHASE"
+)
+
+// HookPhases contains all valid cluster hook phases.
+var HookPhases = []string{
+	PreProvision,
+	PostProvision,
+	PreDestroy,
+	PostDestroy,
+}
+
+// HookOptions configure a cluster hook. Cluster hooks run before or after
+// the cluster infrastructure is provisioned or destroyed. A hook either runs
+// a local command or a Kubernetes Job, so exactly one of Command and Job
+// must be set.
+type HookOptions struct {
+	// Name is used in log messages.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Command is executed via `sh -c`. If cluster credentials are
+	// available, KUBECONFIG points to a kubeconfig which is pinned to the
+	// cluster.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+
+	// Env is added to the environment of Command.
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// Job is the path to a file containing the manifest of a Kubernetes Job.
+	// The Job is recreated and waited for until it completed or failed.
+	Job string `json:"job,omitempty" yaml:"job,omitempty"`
+
+	// Timeout limits the time the hook may take. No limit is applied to
+	// commands if empty, Jobs default to DefaultJobHookTimeout.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// String implements fmt.Stringer.
+func (h HookOptions) String() string {
+	if h.Name != "" {
+		return h.Name
+	}
+
+	if h.Job != "" {
+		return h.Job
+	}
+
+	return h.Command
+}
+
+// Validate returns an error if h does not specify exactly one of Command
+// and Job.
+func (h HookOptions) Validate() error {
+	if (h.Command == "") == (h.Job == "") {
+		return errors.Errorf("cluster hook %q must specify exactly one of command and job", h)
+	}
+
+	return nil
+}
+
+// validateHooks returns an error if hooks contains unknown phases or
+// invalid hooks.
+func validateHooks(hooks map[string][]HookOptions) error {
+	phases := make([]string, 0, len(hooks))
+	for phase := range hooks {
+		phases = append(phases, phase)
+	}
+
+	sort.Strings(phases)
+
+	for _, phase := range phases {
+		if !isValidHookPhase(phase) {
+			return errors.Errorf("invalid cluster hook phase %q, allowed values: %s", phase, strings.Join(HookPhases, ", "))
+		}
+
+		for _, h := range hooks[phase] {
+			if err := h.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isValidHookPhase(phase string) bool {
+	for _, p := range HookPhases {
+		if p == phase {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runHooks runs the cluster hooks of given phase one after another. This is
+// a no-op if hooks are disabled. In dry-run mode the hooks are only logged,
+// unless server-side dry run is enabled, in which case Job hooks are
+// validated by the API server.
+func (m *Manager) runHooks(ctx context.Context, o *Options, phase string) error {
+	hooks := o.Hooks[phase]
+
+	if o.NoHooks || len(hooks) == 0 {
+		return nil
+	}
+
+	logrus.Infof("running %s", pluralize.Pluralize(phase+" hook", len(hooks), true))
+
+	for _, h := range hooks {
+		if o.DryRun && (h.Job == "" || !o.ServerDryRun) {
+			logrus.Warnf("would run %s hook %s", phase, h)
+			continue
+		}
+
+		if o.DryRun {
+			logrus.Infof("validating %s hook %s using server-side dry run", phase, h)
+		} else {
+			logrus.Infof("running %s hook %s", phase, h)
+		}
+
+		var err error
+
+		if h.Job != "" {
+			err = m.runJobHook(ctx, o, h)
+		} else {
+			err = m.runCommandHook(ctx, phase, h)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "%s hook %s failed", phase, h)
+		}
+	}
+
+	return nil
+}
+
+// runCommandHook executes the command of h locally. Credentials are passed
+// on a best effort basis, since the cluster may not exist yet, e.g. in the
+// pre-provision phase of a new cluster.
+func (m *Manager) runCommandHook(ctx context.Context, phase string, h HookOptions) error {
+	env := []string{fmt.Sprintf("%s=%s", HookPhaseEnv, phase)}
+
+	kubeconfig, cleanup, err := m.hookKubeconfig(ctx)
+	if err != nil {
+		logrus.Debugf("running hook %s without cluster credentials: %s", h, err.Error())
+	} else if kubeconfig != "" {
+		defer cleanup()
+		env = append(env, "KUBECONFIG="+kubeconfig)
+	}
+
+	keys := make([]string, 0, len(h.Env))
+	for k := range h.Env {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, h.Env[k]))
+	}
+
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.Command("sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(), env...)
+
+	_, err = command.RunWithContext(ctx, cmd)
+
+	return err
+}
+
+// hookKubeconfig writes a temporary kubeconfig for the cluster which is
+// pinned to the configured context. It must be removed by calling the
+// returned cleanup func.
+func (m *Manager) hookKubeconfig(ctx context.Context) (string, func(), error) {
+	creds, err := m.credentialSource.GetCredentials(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if creds.Empty() {
+		return "", nil, errors.New("empty kubernetes credentials")
+	}
+
+	kubectl := kubernetes.NewKubectl(creds)
+	defer kubectl.Close()
+
+	filename, err := kubectl.WriteTempKubeconfig(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filename, func() { os.Remove(filename) }, nil
+}
+
+// runJobHook recreates the Job of h in the cluster and waits until it
+// completed or failed. If the Job fails, its logs are printed. In dry-run
+// mode the Job is only validated using a server-side dry run.
+func (m *Manager) runJobHook(ctx context.Context, o *Options, h HookOptions) error {
+	head, content, err := readJobHook(h)
+	if err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultJobHookTimeout
+	}
+
+	creds, err := m.readCredentials(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	kubectl := kubernetes.NewKubectl(creds)
+	defer kubectl.Close()
+
+	if _, err := kubectl.ClusterInfo(ctx); err != nil {
+		return err
+	}
+
+	if err := verifyClusterIdentity(ctx, kubectl, o, false); err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		err := kubectl.ApplyManifestDryRun(ctx, content)
+
+		// The deletion preceding the recreation of the Job is not persisted
+		// in a dry run, so changes to immutable fields are expected.
+		if len(kubernetes.ImmutableFieldErrors(err)) > 0 {
+			logrus.Infof("job of hook %s would be recreated", h)
+			return nil
+		}
+
+		return err
+	}
+
+	if err := kubectl.DeleteManifest(ctx, content); err != nil {
+		return err
+	}
+
+	if err := kubectl.ApplyManifest(ctx, content); err != nil {
+		return err
+	}
+
+	err = kubectl.WaitForJob(ctx, kubernetes.WaitOptions{
+		Kind:      head.Kind,
+		Name:      head.Metadata.Name,
+		Namespace: head.Metadata.Namespace,
+		Timeout:   timeout,
+	})
+	if err == nil {
+		return nil
+	}
+
+	logs, lerr := kubectl.Logs(ctx, head)
+	if lerr != nil {
+		logrus.Warnf("failed to fetch logs of hook %s: %s", h, lerr.Error())
+		return err
+	}
+
+	if logs = strings.TrimRight(logs, "\n"); logs == "" {
+		return err
+	}
+
+	for _, line := range strings.Split(logs, "\n") {
+		logrus.Warnf("%s: %s", h, line)
+	}
+
+	return err
+}
+
+// readJobHook reads the Job manifest of h. If the Job does not specify a
+// namespace, the default namespace is set explicitly, since apply and wait
+// must agree on the namespace of the Job instead of relying on the namespace
+// of the kubeconfig context.
+func readJobHook(h HookOptions) (resource.Head, []byte, error) {
+	var head resource.Head
+
+	content, err := ioutil.ReadFile(h.Job)
+	if err != nil {
+		return head, nil, errors.WithStack(err)
+	}
+
+	if err := yaml.Unmarshal(content, &head); err != nil {
+		return head, nil, errors.Wrapf(err, "failed to parse %s", h.Job)
+	}
+
+	if head.Kind != resource.Job || head.Metadata.Name == "" {
+		return head, nil, errors.Errorf("%s must contain the manifest of a single named %s", h.Job, resource.Job)
+	}
+
+	if head.Metadata.Namespace != "" {
+		return head, content, nil
+	}
+
+	r := &resource.Resource{Kind: head.Kind, Name: head.Metadata.Name, Content: content}
+
+	if err := r.SetNamespace(kubernetes.DefaultNamespace); err != nil {
+		return head, nil, err
+	}
+
+	head.Metadata.Namespace = kubernetes.DefaultNamespace
+
+	return head, r.Content, nil
+}
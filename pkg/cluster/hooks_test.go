@@ -0,0 +1,270 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHooks(t *testing.T) {
+	cases := []struct {
+		name        string
+		hooks       map[string][]HookOptions
+		expectError bool
+	}{
+		{
+			name: "valid hooks",
+			hooks: map[string][]HookOptions{
+				PreProvision: {{Name: "backup", Command: "etcdctl snapshot save backup.db"}},
+				PreDestroy:   {{Job: "drain.yaml"}},
+			},
+		},
+		{
+			name: "unknown phase",
+			hooks: map[string][]HookOptions{
+				"pre-create": {{Command: "true"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "command and job",
+			hooks: map[string][]HookOptions{
+				PostProvision: {{Command: "true", Job: "job.yaml"}},
+			},
+			expectError: true,
+		},
+		{
+			name: "neither command nor job",
+			hooks: map[string][]HookOptions{
+				PostDestroy: {{Name: "noop"}},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateHooks(tc.hooks)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProvisionRunsHooks(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		o := &Options{
+			SkipManifests: true,
+			Hooks: map[string][]HookOptions{
+				PreProvision: {
+					{Name: "drain", Command: `test "$KCM_HOOK_PHASE" = pre-provision && test "$NODE_GROUP" = workers`, Env: map[string]string{"NODE_GROUP": "workers"}},
+				},
+				PostProvision: {
+					{Command: "echo done"},
+				},
+			},
+		}
+
+		executor.ExpectCommand(`sh -c test "\$KCM_HOOK_PHASE" = pre-provision`).WillExecute()
+		executor.ExpectCommand("terraform apply --auto-approve")
+		executor.ExpectCommand("sh -c echo done")
+
+		require.NoError(t, createManager().Provision(context.Background(), o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	}, command.NewExecutor(nil))
+}
+
+func TestProvisionHookFailureAbortsProvisioning(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		o := &Options{
+			SkipManifests: true,
+			Hooks: map[string][]HookOptions{
+				PreProvision: {{Name: "backup", Command: "backup-etcd"}},
+			},
+		}
+
+		executor.ExpectCommand("sh -c backup-etcd").WillReturnError(errors.New("exit status 1"))
+
+		err := createManager().Provision(context.Background(), o)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pre-provision hook backup failed")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestProvisionSkipsHooks(t *testing.T) {
+	hooks := map[string][]HookOptions{
+		PreProvision:  {{Command: "backup-etcd"}},
+		PostProvision: {{Command: "echo done"}},
+	}
+
+	t.Run("no hooks", func(t *testing.T) {
+		commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+			o := &Options{SkipManifests: true, NoHooks: true, Hooks: hooks}
+
+			executor.ExpectCommand("terraform apply --auto-approve")
+
+			require.NoError(t, createManager().Provision(context.Background(), o))
+			assert.NoError(t, executor.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+			o := &Options{SkipManifests: true, DryRun: true, Hooks: hooks}
+
+			executor.ExpectCommand("terraform plan")
+
+			require.NoError(t, createManager().Provision(context.Background(), o))
+			assert.NoError(t, executor.ExpectationsWereMet())
+		})
+	})
+}
+
+func TestDestroyRunsJobHooks(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		job, _ := file.NewTempFile("job.yaml", []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: backup
+  namespace: kube-system
+`))
+		defer os.Remove(job.Name())
+
+		o := &Options{
+			SkipManifests: true,
+			Hooks: map[string][]HookOptions{
+				PreDestroy: {{Job: job.Name()}},
+			},
+		}
+
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl delete -f - --ignore-not-found --context test")
+		executor.ExpectCommand("kubectl apply -f - --context test")
+		// failed jobs are detected without waiting for the timeout
+		executor.ExpectCommand("kubectl get job.batch/backup --namespace kube-system --output json --context test").
+			WillReturn(`{"status":{"conditions":[{"type":"Failed","status":"True","message":"Job has reached the specified backoff limit"}]}}`)
+		executor.ExpectCommand("kubectl logs job.batch/backup --namespace kube-system").
+			WillReturn("etcdserver: request timed out\n")
+
+		err := createManager().Destroy(context.Background(), o)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "job.batch/backup failed: Job has reached the specified backoff limit")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestProvisionRunsJobHooksInDefaultNamespace(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		job, _ := file.NewTempFile("job.yaml", []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: drain
+`))
+		defer os.Remove(job.Name())
+
+		o := &Options{
+			SkipManifests: true,
+			Hooks: map[string][]HookOptions{
+				PreProvision: {{Job: job.Name(), Timeout: time.Hour}},
+			},
+		}
+
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl delete -f - --ignore-not-found --context test")
+		executor.ExpectCommand("kubectl apply -f - --context test")
+		executor.ExpectCommand("kubectl get job.batch/drain --namespace default --output json --context test").
+			WillReturn(`{"status":{"conditions":[{"type":"Complete","status":"True"}]}}`)
+		executor.ExpectCommand("terraform apply --auto-approve")
+
+		require.NoError(t, createManager().Provision(context.Background(), o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestProvisionServerDryRunValidatesJobHooks(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		job, _ := file.NewTempFile("job.yaml", []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: drain
+`))
+		defer os.Remove(job.Name())
+
+		o := &Options{
+			SkipManifests: true,
+			DryRun:        true,
+			ServerDryRun:  true,
+			Hooks: map[string][]HookOptions{
+				PreProvision: {
+					{Job: job.Name()},
+					{Command: "backup-etcd"},
+				},
+			},
+		}
+
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl apply -f - --dry-run=server --context test").
+			WillReturnError(errors.New(`Error from server (Forbidden): jobs.batch is forbidden: User "ci" cannot create resource "jobs"`))
+
+		err := createManager().Provision(context.Background(), o)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot create resource")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestProvisionJobHooksVerifyClusterIdentity(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		job, _ := file.NewTempFile("job.yaml", []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: drain
+`))
+		defer os.Remove(job.Name())
+
+		o := &Options{
+			SkipManifests: true,
+			Hooks: map[string][]HookOptions{
+				PreProvision: {{Job: job.Name()}},
+			},
+			ClusterIdentity: kubernetes.ClusterIdentity{
+				Server: "https://prod:6443",
+			},
+		}
+
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl config view --minify .* --context test").WillReturn("https://staging:6443")
+
+		err := createManager().Provision(context.Background(), o)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cluster identity mismatch")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestDestroyInvalidHooks(t *testing.T) {
+	o := &Options{
+		Hooks: map[string][]HookOptions{
+			"post-upgrade": {{Command: "true"}},
+		},
+	}
+
+	assert.Error(t, createManager().Destroy(context.Background(), o))
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/imdario/mergo"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/diff"
@@ -13,6 +16,7 @@ import (
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/log"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/provisioner"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/revision"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/template"
 	"github.com/pkg/errors"
@@ -22,6 +26,15 @@ import (
 
 const (
 	dirMode os.FileMode = 0775
+
+	// OutputsSnapshotFilename is the name of the file the provisioner outputs
+	// are written to if the SaveOutputs option is set. It is placed next to
+	// the values file.
+	OutputsSnapshotFilename = "outputs.json"
+
+	// DefaultInstanceID is the ID used to label applied resources if none is
+	// configured.
+	DefaultInstanceID = "kcm"
 )
 
 // Options are used to configure the cluster manager.
@@ -35,6 +48,88 @@ type Options struct {
 	NoSave        bool   `json:"noSave,omitempty" yaml:"noSave,omitempty"`
 	NoHooks       bool   `json:"noHooks,omitempty" yaml:"noHooks,omitempty"`
 	FullDiff      bool   `json:"fullDiff,omitempty" yaml:"fullDiff,omitempty"`
+
+	// TemplateOverlays are additional templates search paths that take
+	// precedence over TemplatesDir in the given order. They can add, replace
+	// or disable components.
+	TemplateOverlays []string `json:"templateOverlays,omitempty" yaml:"templateOverlays,omitempty"`
+
+	// ServerDryRun sends all resource changes and hooks to the API server
+	// using server-side dry run. It only has an effect if DryRun is set.
+	ServerDryRun bool `json:"serverDryRun,omitempty" yaml:"serverDryRun,omitempty"`
+
+	Wait        bool          `json:"wait,omitempty" yaml:"wait,omitempty"`
+	WaitTimeout time.Duration `json:"waitTimeout,omitempty" yaml:"waitTimeout,omitempty"`
+
+	SaveOutputs         bool `json:"saveOutputs,omitempty" yaml:"saveOutputs,omitempty"`
+	OutputsFromSnapshot bool `json:"outputsFromSnapshot,omitempty" yaml:"outputsFromSnapshot,omitempty"`
+
+	// KindOrder places additional kinds, e.g. custom resources, in the
+	// order in which resources are applied and deleted.
+	KindOrder []resource.KindPlacement `json:"kindOrder,omitempty" yaml:"kindOrder,omitempty"`
+
+	// InstanceID identifies this kcm instance. All applied resources are
+	// labeled with it, which allows pruning of orphaned resources.
+	InstanceID string `json:"instanceID,omitempty" yaml:"instanceID,omitempty"`
+
+	// IncludeComponents restricts the processed components to those whose
+	// name matches any of the glob patterns. All components are included if
+	// empty.
+	IncludeComponents []string `json:"includeComponents,omitempty" yaml:"includeComponents,omitempty"`
+
+	// ExcludeComponents skips components whose name matches any of the glob
+	// patterns.
+	ExcludeComponents []string `json:"excludeComponents,omitempty" yaml:"excludeComponents,omitempty"`
+
+	// ComponentSelector is a label selector, e.g. `tier=infra,team!=ops`,
+	// which is matched against the labels of the components.
+	ComponentSelector string `json:"componentSelector,omitempty" yaml:"componentSelector,omitempty"`
+
+	// Hooks contains cluster hooks keyed by the phase they run in.
+	Hooks map[string][]HookOptions `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+
+	// Components contains options for individual components, keyed by
+	// component name.
+	Components map[string]ComponentOptions `json:"components,omitempty" yaml:"components,omitempty"`
+
+	// ClusterIdentity is verified before any changes are made to the
+	// cluster to avoid applying manifests to the wrong cluster.
+	ClusterIdentity kubernetes.ClusterIdentity `json:"clusterIdentity,omitempty" yaml:"clusterIdentity,omitempty"`
+}
+
+// ComponentOptions configure a single component.
+type ComponentOptions struct {
+	// Namespace is set on all namespaced resources of the component that do
+	// not specify a namespace.
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// AllowedNamespaces restricts the namespaces the resources of the
+	// component may target. All namespaces are allowed if empty.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty" yaml:"allowedNamespaces,omitempty"`
+
+	// ClusterScopedKinds are custom resource kinds that are not namespaced
+	// and are not defined by a CustomResourceDefinition within the
+	// component.
+	ClusterScopedKinds []string `json:"clusterScopedKinds,omitempty" yaml:"clusterScopedKinds,omitempty"`
+
+	// Labels are matched against the component selector.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// WaitTimeout overrides the global wait timeout for the resources of
+	// the component.
+	WaitTimeout time.Duration `json:"waitTimeout,omitempty" yaml:"waitTimeout,omitempty"`
+}
+
+// TemplateSearchPaths returns the templates dir followed by the template
+// overlays.
+func (o *Options) TemplateSearchPaths() []string {
+	return append([]string{o.TemplatesDir}, o.TemplateOverlays...)
+}
+
+// OutputsSnapshotFile returns the path of the provisioner outputs snapshot
+// file which resides next to the values file.
+func (o *Options) OutputsSnapshotFile() string {
+	return filepath.Join(filepath.Dir(o.Values), OutputsSnapshotFilename)
 }
 
 // Manager is a Kubernetes cluster manager that will orchestrate changes to the
@@ -42,18 +137,23 @@ type Options struct {
 type Manager struct {
 	credentialSource credentials.Source
 	provisioner      provisioner.Provisioner
+	outputter        provisioner.Outputter
 	renderer         template.Renderer
 }
 
-// NewManager creates a new cluster manager.
+// NewManager creates a new cluster manager. The outputter is used to obtain
+// the infrastructure output values and may be nil if the provisioner does not
+// produce any output.
 func NewManager(
 	credentialSource credentials.Source,
 	provisioner provisioner.Provisioner,
+	outputter provisioner.Outputter,
 	renderer template.Renderer,
 ) *Manager {
 	return &Manager{
 		credentialSource: credentialSource,
 		provisioner:      provisioner,
+		outputter:        outputter,
 		renderer:         renderer,
 	}
 }
@@ -62,8 +162,16 @@ func NewManager(
 // the required infrastructure. If a cluster already exists, it should
 // update it if there are pending changes to be rolled out. Depending on
 // the options it may or may not perform a dry run of the pending changes.
+// The pre-provision and post-provision hooks run around the provisioner.
 func (m *Manager) Provision(ctx context.Context, o *Options) error {
-	var err error
+	if err := validateHooks(o.Hooks); err != nil {
+		return err
+	}
+
+	err := m.runHooks(ctx, o, PreProvision)
+	if err != nil {
+		return err
+	}
 
 	if !o.DryRun {
 		err = m.provisioner.Provision(ctx)
@@ -71,16 +179,48 @@ func (m *Manager) Provision(ctx context.Context, o *Options) error {
 		err = r.Reconcile(ctx)
 	}
 
+	// The infrastructure changed, so cached outputs may be stale now.
+	if r, ok := m.outputter.(provisioner.Resetter); ok {
+		r.Reset()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.saveOutputs(ctx, o); err != nil {
+		return err
+	}
+
+	err = m.runHooks(ctx, o, PostProvision)
 	if err != nil || o.SkipManifests {
 		return err
 	}
 
-	return m.ApplyManifests(ctx, o)
+	return m.applyManifests(ctx, o)
 }
 
 // ApplyManifests applies all manifests to the cluster.
 func (m *Manager) ApplyManifests(ctx context.Context, o *Options) error {
-	values, err := m.readValues(ctx, o.Values)
+	if err := m.saveOutputs(ctx, o); err != nil {
+		return err
+	}
+
+	return m.applyManifests(ctx, o)
+}
+
+func (m *Manager) applyManifests(ctx context.Context, o *Options) error {
+	upgraderOptions, err := buildUpgraderOptions(o)
+	if err != nil {
+		return err
+	}
+
+	selector, err := newComponentSelector(o)
+	if err != nil {
+		return err
+	}
+
+	values, err := m.readValues(ctx, o)
 	if err != nil {
 		return err
 	}
@@ -90,7 +230,7 @@ func (m *Manager) ApplyManifests(ctx context.Context, o *Options) error {
 		return err
 	}
 
-	nextManifests, err := manifest.RenderDir(m.renderer, o.TemplatesDir, values)
+	nextManifests, err := renderSelected(m.renderer, selector, o, values)
 	if err != nil {
 		return err
 	}
@@ -100,7 +240,7 @@ func (m *Manager) ApplyManifests(ctx context.Context, o *Options) error {
 		return err
 	}
 
-	revisions := revision.NewSlice(currentManifests, nextManifests)
+	revisions := revision.NewSlice(selector.filter(currentManifests), nextManifests)
 
 	creds, err := m.readCredentials(ctx, o)
 	if err != nil {
@@ -108,6 +248,7 @@ func (m *Manager) ApplyManifests(ctx context.Context, o *Options) error {
 	}
 
 	kubectl := kubernetes.NewKubectl(creds)
+	defer kubectl.Close()
 
 	if !o.DryRun {
 		if err := os.MkdirAll(o.ManifestsDir, dirMode); err != nil {
@@ -119,63 +260,85 @@ func (m *Manager) ApplyManifests(ctx context.Context, o *Options) error {
 		if err := kubectl.WaitForCluster(ctx); err != nil {
 			return err
 		}
-	}
-
-	upgrader := revision.NewUpgrader(kubectl, &revision.UpgraderOptions{
-		DryRun:           o.DryRun,
-		ManifestsDir:     o.ManifestsDir,
-		NoSave:           o.NoSave,
-		IncludeUnchanged: o.AllManifests,
-		NoHooks:          o.NoHooks,
-		FullDiff:         o.FullDiff,
-	})
 
-	for _, revision := range revisions {
-		if err = upgrader.Upgrade(ctx, revision); err != nil {
+		if err := verifyClusterIdentity(ctx, kubectl, o, true); err != nil {
+			return err
+		}
+	} else if o.ServerDryRun {
+		if err := checkClusterForServerDryRun(ctx, kubectl, o); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if err := applyComponentOptions(ctx, kubectl, nextManifests, o); err != nil {
+		return err
+	}
+
+	upgrader := revision.NewUpgrader(kubectl, upgraderOptions)
+
+	return upgradeRevisions(ctx, upgrader, revisions, o)
 }
 
 // Destroy deletes all applied manifests from a cluster and tears down the
 // cluster infrastructure. Depending on the options it may or may not
-// perform a dry run of the destruction process.
+// perform a dry run of the destruction process. The pre-destroy and
+// post-destroy hooks run around the teardown of the infrastructure.
 func (m *Manager) Destroy(ctx context.Context, o *Options) error {
+	if o.selectsComponents() {
+		return errors.New("component selection is not supported when destroying a cluster, all components are deleted")
+	}
+
+	if err := validateHooks(o.Hooks); err != nil {
+		return err
+	}
+
 	if !o.SkipManifests {
 		if err := m.DeleteManifests(ctx, o); err != nil {
 			return err
 		}
 	}
 
+	if err := m.runHooks(ctx, o, PreDestroy); err != nil {
+		return err
+	}
+
 	if o.DryRun {
 		logrus.Warn("would destroy cluster infrastructure")
-		return nil
+	} else if err := m.provisioner.Destroy(ctx); err != nil {
+		return err
 	}
 
-	return m.provisioner.Destroy(ctx)
+	return m.runHooks(ctx, o, PostDestroy)
 }
 
 // DeleteManifests deletes all manifests from the cluster in reverse apply
 // order.
 func (m *Manager) DeleteManifests(ctx context.Context, o *Options) error {
 	var manifests []*manifest.Manifest
-	var err error
+
+	upgraderOptions, err := buildUpgraderOptions(o)
+	if err != nil {
+		return err
+	}
+
+	selector, err := newComponentSelector(o)
+	if err != nil {
+		return err
+	}
 
 	if o.AllManifests {
 		// To be able to attempt the deletion of manifests that are already
 		// removed from the manifests dir we render them again.
 		var values map[string]interface{}
 
-		values, err = m.readValues(ctx, o.Values)
+		values, err = m.readValues(ctx, o)
 		if err != nil {
 			return err
 		}
 
-		manifests, err = manifest.RenderDir(template.NewRenderer(), o.TemplatesDir, values)
+		manifests, err = renderSelected(template.NewRenderer(), selector, o, values)
 	} else {
-		manifests, err = manifest.ReadDir(o.ManifestsDir)
+		manifests, err = readSelected(selector, o)
 	}
 
 	if err != nil {
@@ -190,24 +353,92 @@ func (m *Manager) DeleteManifests(ctx context.Context, o *Options) error {
 	}
 
 	kubectl := kubernetes.NewKubectl(creds)
+	defer kubectl.Close()
 
 	if !o.DryRun {
 		if _, err := kubectl.ClusterInfo(ctx); err != nil {
 			return err
 		}
+
+		if err := verifyClusterIdentity(ctx, kubectl, o, false); err != nil {
+			return err
+		}
+	} else if o.ServerDryRun {
+		if err := checkClusterForServerDryRun(ctx, kubectl, o); err != nil {
+			return err
+		}
+	}
+
+	// Manifests read from the manifests dir already had the component
+	// options applied when they were rendered.
+	if o.AllManifests {
+		if err := applyComponentOptions(ctx, kubectl, manifests, o); err != nil {
+			return err
+		}
 	}
 
-	upgrader := revision.NewUpgrader(kubectl, &revision.UpgraderOptions{
-		DryRun:           o.DryRun,
-		ManifestsDir:     o.ManifestsDir,
-		NoSave:           o.NoSave,
-		IncludeUnchanged: o.AllManifests,
-		NoHooks:          o.NoHooks,
-		FullDiff:         o.FullDiff,
-	})
+	upgrader := revision.NewUpgrader(kubectl, upgraderOptions)
+
+	return upgradeRevisions(ctx, upgrader, revisions.Reverse(), o)
+}
 
-	for _, revision := range revisions.Reverse() {
-		if err = upgrader.Upgrade(ctx, revision); err != nil {
+// upgradeRevisions performs the upgrades of all revisions in order and stops
+// at the first error. During a server-side dry run all revisions are
+// processed and the errors are collected to produce a full report.
+func upgradeRevisions(ctx context.Context, upgrader revision.Upgrader, revisions revision.Slice, o *Options) error {
+	errs := &multierror.Error{}
+
+	for _, rev := range revisions {
+		err := upgrader.Upgrade(ctx, rev)
+		if err == nil {
+			continue
+		}
+
+		if !o.DryRun || !o.ServerDryRun {
+			return err
+		}
+
+		errs = multierror.Append(errs, errors.Wrapf(err, "component %s", rev.Manifest().Name))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// checkClusterForServerDryRun verifies that the cluster is reachable and
+// matches the configured identity before server-side dry-run requests are
+// sent to it.
+func checkClusterForServerDryRun(ctx context.Context, kubectl *kubernetes.Kubectl, o *Options) error {
+	if _, err := kubectl.ClusterInfo(ctx); err != nil {
+		return err
+	}
+
+	return verifyClusterIdentity(ctx, kubectl, o, false)
+}
+
+// applyComponentOptions sets the default namespace of the components and
+// verifies that their resources only target allowed namespaces. The
+// cluster-scoped kinds are discovered from the cluster, the kinds configured
+// per component are considered cluster-scoped in addition.
+func applyComponentOptions(ctx context.Context, kubectl *kubernetes.Kubectl, manifests []*manifest.Manifest, o *Options) error {
+	if !o.hasNamespaceOptions() {
+		return nil
+	}
+
+	discovered, err := discoverClusterScopedKinds(ctx, kubectl, o)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		co := o.Components[m.Name]
+
+		kinds := append(append([]string{}, discovered...), co.ClusterScopedKinds...)
+
+		if err := m.SetDefaultNamespace(co.Namespace, kinds); err != nil {
+			return err
+		}
+
+		if err := m.CheckNamespaces(co.AllowedNamespaces, kinds); err != nil {
 			return err
 		}
 	}
@@ -215,6 +446,90 @@ func (m *Manager) DeleteManifests(ctx context.Context, o *Options) error {
 	return nil
 }
 
+// hasNamespaceOptions returns true if the default namespace or the allowed
+// namespaces are configured for any component.
+func (o *Options) hasNamespaceOptions() bool {
+	for _, co := range o.Components {
+		if co.Namespace != "" || len(co.AllowedNamespaces) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// discoverClusterScopedKinds returns the cluster-scoped kinds served by the
+// cluster. In client-side dry runs the cluster is not contacted, so only the
+// built-in and configured cluster-scoped kinds are known.
+func discoverClusterScopedKinds(ctx context.Context, kubectl *kubernetes.Kubectl, o *Options) ([]string, error) {
+	if o.DryRun && !o.ServerDryRun {
+		logrus.Debug("skipping discovery of cluster-scoped resource types due to dry run")
+		return nil, nil
+	}
+
+	kinds, err := kubectl.ClusterScopedKinds(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to discover cluster-scoped resource types")
+	}
+
+	return kinds, nil
+}
+
+// buildUpgraderOptions creates the revision.UpgraderOptions from o. The apply
+// and delete orders are extended with the configured kind placements.
+func buildUpgraderOptions(o *Options) (*revision.UpgraderOptions, error) {
+	applyOrder, err := resource.ApplyOrder.Extend(o.KindOrder)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid kind order")
+	}
+
+	deleteOrder, err := resource.DeleteOrder.Extend(o.KindOrder)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid kind order")
+	}
+
+	logrus.Debugf("resolved apply order: %s", applyOrder)
+	logrus.Debugf("resolved delete order: %s", deleteOrder)
+
+	waitTimeouts := make(map[string]time.Duration)
+
+	for name, co := range o.Components {
+		if co.WaitTimeout > 0 {
+			waitTimeouts[name] = co.WaitTimeout
+		}
+	}
+
+	return &revision.UpgraderOptions{
+		DryRun:                o.DryRun,
+		ManifestsDir:          o.ManifestsDir,
+		NoSave:                o.NoSave,
+		IncludeUnchanged:      o.AllManifests,
+		NoHooks:               o.NoHooks,
+		FullDiff:              o.FullDiff,
+		Wait:                  o.Wait,
+		WaitTimeout:           o.WaitTimeout,
+		ComponentWaitTimeouts: waitTimeouts,
+		ApplyOrder:            applyOrder,
+		DeleteOrder:           deleteOrder,
+		InstanceID:            o.InstanceID,
+		ServerDryRun:          o.ServerDryRun,
+	}, nil
+}
+
+// verifyClusterIdentity aborts if the cluster kubectl talks to does not
+// match the configured cluster identity. If createMarker is true, a missing
+// identity marker is written into the cluster once the API server or the
+// kube-system namespace UID has been verified.
+func verifyClusterIdentity(ctx context.Context, kubectl *kubernetes.Kubectl, o *Options, createMarker bool) error {
+	if o.ClusterIdentity.Empty() {
+		return nil
+	}
+
+	logrus.Debug("verifying cluster identity")
+
+	return kubectl.VerifyClusterIdentity(ctx, &o.ClusterIdentity, createMarker)
+}
+
 func (m *Manager) updateValuesFile(filename string, v map[string]interface{}, o *Options) error {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil && !os.IsNotExist(err) {
@@ -241,34 +556,58 @@ func (m *Manager) updateValuesFile(filename string, v map[string]interface{}, o
 	return ioutil.WriteFile(filename, buf, 0660)
 }
 
-func (m *Manager) readValues(ctx context.Context, filename string) (v map[string]interface{}, err error) {
-	if err = file.ReadYAML(filename, &v); err != nil {
+func (m *Manager) readValues(ctx context.Context, o *Options) (v map[string]interface{}, err error) {
+	if err = file.ReadYAML(o.Values, &v); err != nil {
 		return
 	}
 
-	if o, ok := m.provisioner.(provisioner.Outputter); ok {
-		var values map[string]interface{}
+	if m.outputter == nil {
+		return
+	}
 
-		values, err = o.Output(ctx)
-		if err == nil && len(values) > 0 {
-			logrus.Info("merging values from provisioner")
-			err = mergo.Merge(&v, values, mergo.WithOverride)
-		}
+	values, err := m.outputter.Output(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) > 0 {
+		logrus.Info("merging values from provisioner")
+		err = mergo.Merge(&v, values, mergo.WithOverride)
 	}
 
 	return
 }
 
+// saveOutputs writes the provisioner outputs to the snapshot file if the
+// SaveOutputs option is set.
+func (m *Manager) saveOutputs(ctx context.Context, o *Options) error {
+	if m.outputter == nil || !o.SaveOutputs || o.OutputsFromSnapshot || o.DryRun || o.NoSave {
+		return nil
+	}
+
+	values, err := m.outputter.Output(ctx)
+	if err != nil {
+		return err
+	}
+
+	filename := o.OutputsSnapshotFile()
+
+	logrus.Infof("saving provisioner outputs to %s", filename)
+
+	return provisioner.WriteOutputFile(filename, values)
+}
+
 func (m *Manager) readCredentials(ctx context.Context, o *Options) (*credentials.Credentials, error) {
 	creds, err := m.credentialSource.GetCredentials(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if !o.DryRun && creds.Empty() {
+	if (!o.DryRun || o.ServerDryRun) && creds.Empty() {
 		return nil, errors.New("empty kubernetes credentials found, " +
 			"provide `kubeconfig` (and optionally `context`) or " +
-			"`server` and `token` via the provisioner or set the corresponding --cluster-* flags")
+			"`server` and `token` via the provisioner or set the corresponding --cluster-* flags " +
+			"or KCM_CLUSTER_* environment variables")
 	}
 
 	c := *creds
@@ -276,11 +615,21 @@ func (m *Manager) readCredentials(ctx context.Context, o *Options) (*credentials
 		c.Token = "<sensitive>"
 	}
 
+	if c.ClientKeyData != "" {
+		c.ClientKeyData = "<sensitive>"
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"kubeconfig": c.Kubeconfig,
-		"context":    c.Context,
-		"server":     c.Server,
-		"token":      c.Token,
+		"kubeconfig":            c.Kubeconfig,
+		"context":               c.Context,
+		"server":                c.Server,
+		"token":                 c.Token,
+		"certificateAuthority":  c.CertificateAuthority,
+		"clientCertificate":     c.ClientCertificate,
+		"clientKey":             c.ClientKey,
+		"clientKeyData":         c.ClientKeyData,
+		"insecureSkipTLSVerify": c.InsecureSkipTLSVerify,
+		"exec":                  c.Exec.Command,
 	}).Debugf("using kubernetes credentials")
 
 	return creds, nil
@@ -2,24 +2,34 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/provisioner"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/revision"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/template"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createManager() *Manager {
+	p := provisioner.NewTerraform(&provisioner.Options{})
+
 	m := NewManager(
 		credentials.NewStaticSource(&credentials.Credentials{Context: "test"}),
-		provisioner.NewTerraform(&provisioner.Options{}),
+		p,
+		provisioner.NewOutputCache(p.(provisioner.Outputter)),
 		template.NewRenderer(),
 	)
 
@@ -165,3 +175,303 @@ func TestReadCredentials(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, creds)
 }
+
+func TestApplyManifestsCachesAndSavesOutputs(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		dir, _ := ioutil.TempDir("", "cluster")
+		defer os.RemoveAll(dir)
+
+		values := filepath.Join(dir, "values.yaml")
+
+		o := &Options{
+			Values:       values,
+			ManifestsDir: filepath.Join(dir, "manifests"),
+			TemplatesDir: "testdata/charts",
+			SaveOutputs:  true,
+		}
+
+		p := provisioner.NewTerraform(&provisioner.Options{})
+		outputter := provisioner.NewOutputCache(p.(provisioner.Outputter))
+
+		m := NewManager(
+			credentials.NewProvisionerOutputSource(outputter),
+			p,
+			outputter,
+			template.NewRenderer(),
+		)
+
+		executor.ExpectCommand("terraform output --json").WillReturn(`{"context":{"value": "test"}}`)
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl apply -f - --context test")
+
+		assert.NoError(t, m.ApplyManifests(context.Background(), o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+
+		snapshot, err := provisioner.NewFileOutputter(filepath.Join(dir, "outputs.json")).Output(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"context": "test"}, snapshot)
+	})
+}
+
+func TestProvisionSavesOutputsWithSkipManifests(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		dir, _ := ioutil.TempDir("", "cluster")
+		defer os.RemoveAll(dir)
+
+		o := &Options{
+			Values:        filepath.Join(dir, "values.yaml"),
+			SaveOutputs:   true,
+			SkipManifests: true,
+		}
+
+		p := provisioner.NewTerraform(&provisioner.Options{})
+		outputter := provisioner.NewOutputCache(p.(provisioner.Outputter))
+
+		m := NewManager(
+			credentials.NewProvisionerOutputSource(outputter),
+			p,
+			outputter,
+			template.NewRenderer(),
+		)
+
+		executor.ExpectCommand("terraform apply --auto-approve")
+		executor.ExpectCommand("terraform output --json").WillReturn(`{"context":{"value": "test"}}`)
+
+		assert.NoError(t, m.Provision(context.Background(), o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+
+		snapshot, err := provisioner.NewFileOutputter(filepath.Join(dir, "outputs.json")).Output(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"context": "test"}, snapshot)
+	})
+}
+
+func TestApplyManifestsVerifiesClusterIdentity(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		dir, _ := ioutil.TempDir("", "cluster")
+		defer os.RemoveAll(dir)
+
+		o := &Options{
+			Values:       filepath.Join(dir, "values.yaml"),
+			ManifestsDir: filepath.Join(dir, "manifests"),
+			TemplatesDir: "testdata/charts",
+			ClusterIdentity: kubernetes.ClusterIdentity{
+				Server: "https://prod:6443",
+			},
+		}
+
+		m := createManager()
+
+		executor.ExpectCommand("terraform output --json").WillReturn("{}")
+		executor.ExpectCommand("kubectl cluster-info --context test")
+		executor.ExpectCommand("kubectl config view --minify .* --context test").WillReturn("https://staging:6443")
+
+		err := m.ApplyManifests(context.Background(), o)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cluster identity mismatch")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestApplyManifestsSkipsUnselectedComponents(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		dir, _ := ioutil.TempDir("", "cluster")
+		defer os.RemoveAll(dir)
+
+		manifestsDir := filepath.Join(dir, "manifests")
+		require.NoError(t, os.MkdirAll(manifestsDir, 0755))
+
+		removed := filepath.Join(manifestsDir, "removed.yaml")
+		require.NoError(t, ioutil.WriteFile(removed, []byte("---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: removed\n"), 0644))
+
+		// Unselected components are not rendered, so broken templates do
+		// not fail the run.
+		overlay := filepath.Join(dir, "overlay")
+		require.NoError(t, os.MkdirAll(filepath.Join(overlay, "broken", "templates"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(overlay, "broken", "Chart.yaml"), []byte("name: broken\nversion: 0.1.0\n"), 0644))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(overlay, "broken", "templates", "broken.yaml"), []byte("{{ .Values.foo "), 0644))
+
+		o := &Options{
+			Values:            filepath.Join(dir, "values.yaml"),
+			ManifestsDir:      manifestsDir,
+			TemplatesDir:      "testdata/charts",
+			TemplateOverlays:  []string{overlay},
+			ExcludeComponents: []string{"test*", "removed", "broken"},
+		}
+
+		m := createManager()
+
+		executor.ExpectCommand("terraform output --json").WillReturn("{}")
+		executor.ExpectCommand("kubectl cluster-info --context test")
+
+		require.NoError(t, m.ApplyManifests(context.Background(), o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+
+		assert.FileExists(t, removed)
+
+		_, err := os.Stat(filepath.Join(manifestsDir, "testchart.yaml"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestDestroyRejectsComponentSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{name: "include patterns", options: Options{IncludeComponents: []string{"cert-*"}}},
+		{name: "exclude patterns", options: Options{ExcludeComponents: []string{"cert-*"}}},
+		{name: "label selector", options: Options{ComponentSelector: "tier=infra"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := createManager().Destroy(context.Background(), &test.options)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "component selection is not supported when destroying a cluster")
+		})
+	}
+}
+
+func TestApplyManifestsInvalidComponentSelector(t *testing.T) {
+	o := &Options{
+		ComponentSelector: "=infra",
+	}
+
+	err := createManager().ApplyManifests(context.Background(), o)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid component selector")
+}
+
+func TestApplyManifestsInvalidKindOrder(t *testing.T) {
+	o := &Options{
+		KindOrder: []resource.KindPlacement{
+			{Kind: "Issuer", Before: "Certificate"},
+		},
+	}
+
+	err := createManager().ApplyManifests(context.Background(), o)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid kind order")
+}
+
+func TestBuildUpgraderOptions(t *testing.T) {
+	o := &Options{
+		KindOrder: []resource.KindPlacement{
+			{Kind: "Issuer", Before: "Ingress"},
+		},
+		Components: map[string]ComponentOptions{
+			"foo": {WaitTimeout: 10 * time.Minute},
+			"bar": {Namespace: "bar"},
+		},
+	}
+
+	uo, err := buildUpgraderOptions(o)
+	require.NoError(t, err)
+
+	assert.Contains(t, uo.ApplyOrder.String(), "Job, CronJob, Issuer, Ingress, APIService")
+	assert.Contains(t, uo.DeleteOrder.String(), "APIService, Ingress, Issuer, Service")
+	assert.True(t, uo.DeleteOrder.Delete)
+	assert.Equal(t, map[string]time.Duration{"foo": 10 * time.Minute}, uo.ComponentWaitTimeouts)
+}
+
+func TestApplyComponentOptions(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m, err := manifest.New("foo", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+---
+apiVersion: cert-manager.io/v1
+kind: ClusterIssuer
+metadata:
+  name: letsencrypt
+---
+apiVersion: example.com/v1
+kind: Quota
+metadata:
+  name: global
+`))
+		require.NoError(t, err)
+
+		o := &Options{
+			Components: map[string]ComponentOptions{
+				"foo": {Namespace: "bar", AllowedNamespaces: []string{"bar"}, ClusterScopedKinds: []string{"Quota"}},
+			},
+		}
+
+		kubectl := kubernetes.NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl api-resources --namespaced=false --no-headers --context test").
+			WillReturn("clusterissuers    cert-manager.io/v1    false    ClusterIssuer\n")
+
+		require.NoError(t, applyComponentOptions(context.Background(), kubectl, []*manifest.Manifest{m}, o))
+		assert.Equal(t, "bar", m.Resources[0].Namespace)
+		assert.Equal(t, "", m.Resources[1].Namespace)
+		assert.Equal(t, "", m.Resources[2].Namespace)
+
+		o.Components["foo"] = ComponentOptions{Namespace: "baz", AllowedNamespaces: []string{"kube-system"}}
+
+		executor.ExpectCommand("kubectl api-resources --namespaced=false --no-headers --context test")
+
+		assert.Error(t, applyComponentOptions(context.Background(), kubectl, []*manifest.Manifest{m}, o))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestApplyComponentOptionsClientDryRun(t *testing.T) {
+	m, err := manifest.New("foo", []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"))
+	require.NoError(t, err)
+
+	o := &Options{
+		DryRun: true,
+		Components: map[string]ComponentOptions{
+			"foo": {Namespace: "bar"},
+		},
+	}
+
+	// the cluster is not contacted in client-side dry runs
+	kubectl := kubernetes.NewKubectl(&credentials.Credentials{})
+
+	require.NoError(t, applyComponentOptions(context.Background(), kubectl, []*manifest.Manifest{m}, o))
+	assert.Equal(t, "bar", m.Resources[0].Namespace)
+}
+
+type failingUpgrader struct {
+	upgraded []string
+}
+
+func (u *failingUpgrader) Upgrade(ctx context.Context, rev *revision.Revision) error {
+	u.upgraded = append(u.upgraded, rev.Manifest().Name)
+	return errors.New("rejected")
+}
+
+func TestUpgradeRevisions(t *testing.T) {
+	revisions := revision.NewSlice(nil, []*manifest.Manifest{{Name: "bar"}, {Name: "foo"}})
+
+	t.Run("stops at first error", func(t *testing.T) {
+		u := &failingUpgrader{}
+
+		err := upgradeRevisions(context.Background(), u, revisions, &Options{ServerDryRun: true})
+
+		require.Error(t, err)
+		assert.Equal(t, []string{"bar"}, u.upgraded)
+	})
+
+	t.Run("server dry run collects errors", func(t *testing.T) {
+		u := &failingUpgrader{}
+
+		err := upgradeRevisions(context.Background(), u, revisions, &Options{DryRun: true, ServerDryRun: true})
+
+		require.Error(t, err)
+		assert.Equal(t, []string{"bar", "foo"}, u.upgraded)
+		assert.Contains(t, err.Error(), "component bar: rejected")
+		assert.Contains(t, err.Error(), "component foo: rejected")
+	})
+}
@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/log"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ConfirmFunc is called with the resources that are about to be deleted.
+// Deletion only proceeds if it returns true.
+type ConfirmFunc func(resource.Slice) (bool, error)
+
+// Prune deletes resources from the cluster that are labeled with the
+// instance ID of o, but are not part of any rendered manifest. The manifests
+// are rendered from the templates instead of being read from the manifests
+// dir, so that resources can be found even if the manifests dir was lost.
+// Nothing is deleted if confirm returns false or if dry run is enabled.
+// Component selection is rejected, since resources of unselected components
+// would be considered orphaned.
+func (m *Manager) Prune(ctx context.Context, o *Options, confirm ConfirmFunc) error {
+	if o.InstanceID == "" {
+		return errors.New("pruning requires an instance ID")
+	}
+
+	if o.selectsComponents() {
+		return errors.New("component selection is not supported when pruning, the resources of all components are considered")
+	}
+
+	if o.InstanceID == DefaultInstanceID {
+		logrus.Warnf(
+			"pruning resources with the default instance ID %q, resources applied by other kcm setups with the default instance ID to the same cluster are considered orphaned, use --instance-id to set a unique ID",
+			DefaultInstanceID,
+		)
+	}
+
+	ownership := resource.Ownership{InstanceID: o.InstanceID}
+
+	if err := m.saveOutputs(ctx, o); err != nil {
+		return err
+	}
+
+	values, err := m.readValues(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := manifest.RenderDirs(m.renderer, o.TemplateSearchPaths(), values)
+	if err != nil {
+		return err
+	}
+
+	creds, err := m.readCredentials(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	kubectl := kubernetes.NewKubectl(creds)
+	defer kubectl.Close()
+
+	if _, err := kubectl.ClusterInfo(ctx); err != nil {
+		return err
+	}
+
+	if err := verifyClusterIdentity(ctx, kubectl, o, false); err != nil {
+		return err
+	}
+
+	if err := applyComponentOptions(ctx, kubectl, manifests, o); err != nil {
+		return err
+	}
+
+	live, err := kubectl.ListOwnedResources(ctx, ownership)
+	if err != nil {
+		return err
+	}
+
+	orphans := findOrphans(live, manifests).Sort(resource.DeleteOrder)
+
+	if len(orphans) == 0 {
+		logrus.Info("no orphaned resources found")
+		return nil
+	}
+
+	logrus.Warn("found orphaned resources")
+
+	resource.NewPrinter(log.LineWriter(logrus.Info)).PrintSlice(orphans.WithHint(resource.Removal))
+
+	if o.DryRun {
+		logrus.Debug("skipping resource deletions due to dry run")
+		return nil
+	}
+
+	ok, err := confirm(orphans)
+	if err != nil || !ok {
+		return err
+	}
+
+	for _, r := range orphans {
+		if err := kubectl.DeleteResource(ctx, r.Head()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findOrphans returns all resources in live that are not part of any of the
+// manifests. Rendered resources without namespace match live resources in
+// any namespace, since it is unknown where they were applied to.
+func findOrphans(live resource.Slice, manifests []*manifest.Manifest) resource.Slice {
+	known := make(resource.Slice, 0)
+
+	for _, m := range manifests {
+		known = append(known, m.AllResources()...)
+	}
+
+	orphans := make(resource.Slice, 0)
+
+	for _, r := range live {
+		if !containsResource(known, r) {
+			orphans = append(orphans, r)
+		}
+	}
+
+	return orphans
+}
+
+func containsResource(haystack resource.Slice, needle *resource.Resource) bool {
+	for _, r := range haystack {
+		if r.Kind != needle.Kind || r.Name != needle.Name {
+			continue
+		}
+
+		if r.Namespace != "" && r.Namespace != needle.Namespace {
+			continue
+		}
+
+		if r.APIVersion == "" || resource.SameGroup(r.Kind, r.Group(), needle.Group()) {
+			return true
+		}
+	}
+
+	return false
+}
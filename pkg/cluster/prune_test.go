@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pruneTestConfigMapList = `{"items":[
+  {"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"test","namespace":"kube-system","uid":"1","annotations":{"kcm/revision":"abc"}}},
+  {"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"orphan","namespace":"default","uid":"3","annotations":{"kcm/revision":"abc"}}}
+]}`
+
+const pruneTestServiceList = `{"items":[
+  {"apiVersion":"v1","kind":"Service","metadata":{"name":"my-service","namespace":"default","uid":"2","annotations":{"kcm/revision":"abc"}}}
+]}`
+
+func expectPruneListCommands(executor commandtest.MockExecutor) {
+	executor.ExpectCommand("terraform output --json").WillReturn("{}")
+	executor.ExpectCommand("kubectl cluster-info --context test")
+	executor.ExpectCommand("kubectl api-resources .* --context test").WillReturn("configmaps\nservices\n")
+	executor.ExpectCommand("kubectl get configmaps --all-namespaces --selector kcm/instance=kcm .*").
+		WillReturn(pruneTestConfigMapList)
+	executor.ExpectCommand("kubectl get services --all-namespaces --selector kcm/instance=kcm .*").
+		WillReturn(pruneTestServiceList)
+}
+
+func TestPrune(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		o := &Options{TemplatesDir: "testdata/charts", InstanceID: DefaultInstanceID}
+
+		expectPruneListCommands(executor)
+		executor.ExpectCommand("kubectl delete configmap orphan --namespace default --ignore-not-found --context test")
+
+		var confirmed resource.Slice
+
+		err := createManager().Prune(context.Background(), o, func(r resource.Slice) (bool, error) {
+			confirmed = r
+			return true, nil
+		})
+
+		require.NoError(t, err)
+		require.Len(t, confirmed, 1)
+		assert.Equal(t, "default/configmap/orphan", confirmed[0].String())
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestPruneNotConfirmed(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		o := &Options{TemplatesDir: "testdata/charts", InstanceID: DefaultInstanceID}
+
+		expectPruneListCommands(executor)
+
+		err := createManager().Prune(context.Background(), o, func(r resource.Slice) (bool, error) {
+			return false, nil
+		})
+
+		require.NoError(t, err)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestPruneDryRun(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		o := &Options{TemplatesDir: "testdata/charts", InstanceID: DefaultInstanceID, DryRun: true}
+
+		expectPruneListCommands(executor)
+
+		err := createManager().Prune(context.Background(), o, func(r resource.Slice) (bool, error) {
+			t.Fatal("confirmation must not be requested in dry run mode")
+			return false, nil
+		})
+
+		require.NoError(t, err)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestPruneRejectsComponentSelection(t *testing.T) {
+	o := &Options{TemplatesDir: "testdata/charts", InstanceID: DefaultInstanceID, IncludeComponents: []string{"foo"}}
+
+	err := createManager().Prune(context.Background(), o, func(r resource.Slice) (bool, error) {
+		t.Fatal("confirmation must not be requested if components are selected")
+		return false, nil
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "component selection is not supported when pruning")
+}
+
+func TestFindOrphans(t *testing.T) {
+	m, err := manifest.New("foo", []byte(`---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: foo
+  namespace: bar
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+`))
+	require.NoError(t, err)
+
+	live := resource.Slice{
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo", Namespace: "bar"},
+		{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "foo", Namespace: "bar"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo", Namespace: "baz"},
+		{APIVersion: "v1", Kind: "Service", Name: "foo", Namespace: "qux"},
+		{APIVersion: "v1", Kind: "Service", Name: "bar", Namespace: "qux"},
+	}
+
+	expected := resource.Slice{live[2], live[4]}
+
+	assert.Equal(t, expected, findOrphans(live, []*manifest.Manifest{m}))
+}
@@ -0,0 +1,257 @@
+package cluster
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/template"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// componentSelector decides which components are processed. A component is
+// selected if its name matches any of the include patterns (or no include
+// patterns are given), does not match any of the exclude patterns and its
+// labels match all label requirements. Labels are read from the metadata
+// file of the component dir and from the component options, the latter take
+// precedence.
+type componentSelector struct {
+	include      []string
+	exclude      []string
+	requirements []labelRequirement
+	labels       map[string]map[string]string
+}
+
+// labelRequirement is a single requirement of a label selector.
+type labelRequirement struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+// newComponentSelector creates a componentSelector from o. Returns an error if
+// any of the patterns or the label selector is invalid.
+func newComponentSelector(o *Options) (*componentSelector, error) {
+	for _, patterns := range [][]string{o.IncludeComponents, o.ExcludeComponents} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, errors.Wrapf(err, "invalid component pattern %q", pattern)
+			}
+		}
+	}
+
+	requirements, err := parseLabelSelector(o.ComponentSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]map[string]string, len(o.Components))
+	for name, co := range o.Components {
+		labels[name] = make(map[string]string, len(co.Labels))
+
+		for key, value := range co.Labels {
+			labels[name][key] = value
+		}
+	}
+
+	s := &componentSelector{
+		include:      o.IncludeComponents,
+		exclude:      o.ExcludeComponents,
+		requirements: requirements,
+		labels:       labels,
+	}
+
+	return s, nil
+}
+
+// selectsComponents returns true if o restricts the processed components.
+func (o *Options) selectsComponents() bool {
+	return len(o.IncludeComponents) > 0 || len(o.ExcludeComponents) > 0 || strings.TrimSpace(o.ComponentSelector) != ""
+}
+
+// hasLabelRequirements returns true if s needs component labels to decide
+// which components are selected.
+func (s *componentSelector) hasLabelRequirements() bool {
+	return len(s.requirements) > 0
+}
+
+// loadLabels reads the labels from the metadata files of components. Labels
+// that are already known from the component options are not overridden.
+func (s *componentSelector) loadLabels(components []manifest.ComponentDir) error {
+	for _, c := range components {
+		metadata, err := c.Metadata()
+		if err != nil {
+			return err
+		}
+
+		if s.labels[c.Name] == nil {
+			s.labels[c.Name] = make(map[string]string, len(metadata.Labels))
+		}
+
+		for key, value := range metadata.Labels {
+			if _, ok := s.labels[c.Name][key]; !ok {
+				s.labels[c.Name][key] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseLabelSelector parses a comma separated list of label requirements.
+// Supported requirements are `key=value`, `key==value`, `key!=value`, `key`
+// (label exists) and `!key` (label does not exist).
+func parseLabelSelector(selector string) ([]labelRequirement, error) {
+	requirements := make([]labelRequirement, 0)
+
+	if strings.TrimSpace(selector) == "" {
+		return requirements, nil
+	}
+
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+
+		var req labelRequirement
+
+		switch {
+		case strings.Contains(part, "!="):
+			parts := strings.SplitN(part, "!=", 2)
+			req = labelRequirement{key: parts[0], value: parts[1], negate: true}
+		case strings.Contains(part, "=="):
+			parts := strings.SplitN(part, "==", 2)
+			req = labelRequirement{key: parts[0], value: parts[1]}
+		case strings.Contains(part, "="):
+			parts := strings.SplitN(part, "=", 2)
+			req = labelRequirement{key: parts[0], value: parts[1]}
+		case strings.HasPrefix(part, "!"):
+			req = labelRequirement{key: part[1:], exists: true, negate: true}
+		default:
+			req = labelRequirement{key: part, exists: true}
+		}
+
+		req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+
+		if req.key == "" || strings.ContainsAny(req.key+req.value, "=! ") {
+			return nil, errors.Errorf("invalid component selector %q", selector)
+		}
+
+		requirements = append(requirements, req)
+	}
+
+	return requirements, nil
+}
+
+// matches returns true if labels satisfy r.
+func (r labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+
+	if r.exists {
+		return ok != r.negate
+	}
+
+	return (ok && value == r.value) != r.negate
+}
+
+// selected returns true if the component with name should be processed.
+func (s *componentSelector) selected(name string) bool {
+	if len(s.include) > 0 && !matchesAny(s.include, name) {
+		return false
+	}
+
+	if matchesAny(s.exclude, name) {
+		return false
+	}
+
+	for _, req := range s.requirements {
+		if !req.matches(s.labels[name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter returns the manifests of all selected components. Manifests of
+// unselected components are dropped, so that these components are neither
+// diffed nor applied, deleted or saved.
+func (s *componentSelector) filter(manifests []*manifest.Manifest) []*manifest.Manifest {
+	selected := make([]*manifest.Manifest, 0, len(manifests))
+
+	for _, m := range manifests {
+		if !s.selected(m.Name) {
+			logrus.Debugf("skipping unselected component %s", m.Name)
+			continue
+		}
+
+		selected = append(selected, m)
+	}
+
+	return selected
+}
+
+// filterDirs returns the dirs of all selected components. Unselected
+// components are dropped before rendering, so that they cannot fail the run,
+// e.g. because of broken templates.
+func (s *componentSelector) filterDirs(components []manifest.ComponentDir) []manifest.ComponentDir {
+	selected := make([]manifest.ComponentDir, 0, len(components))
+
+	for _, c := range components {
+		if !s.selected(c.Name) {
+			logrus.Debugf("skipping unselected component %s", c.Name)
+			continue
+		}
+
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renderSelected renders the manifests of all components selected by s.
+func renderSelected(r template.Renderer, s *componentSelector, o *Options, values map[string]interface{}) ([]*manifest.Manifest, error) {
+	components, err := manifest.ResolveComponentDirs(o.TemplateSearchPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadLabels(components); err != nil {
+		return nil, err
+	}
+
+	return manifest.RenderComponentDirs(r, s.filterDirs(components), values)
+}
+
+// readSelected reads the manifests of all components selected by s from the
+// manifests dir. If s has label requirements, the component labels are read
+// from the component dirs.
+func readSelected(s *componentSelector, o *Options) ([]*manifest.Manifest, error) {
+	if s.hasLabelRequirements() {
+		components, err := manifest.ResolveComponentDirs(o.TemplateSearchPaths())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.loadLabels(components); err != nil {
+			return nil, err
+		}
+	}
+
+	manifests, err := manifest.ReadDir(o.ManifestsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.filter(manifests), nil
+}
@@ -0,0 +1,183 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponentSelector(t *testing.T) {
+	components := map[string]ComponentOptions{
+		"cert-manager":  {Labels: map[string]string{"tier": "infra", "team": "platform"}},
+		"ingress-nginx": {Labels: map[string]string{"tier": "infra", "team": "network"}},
+		"shop":          {Labels: map[string]string{"tier": "app"}},
+	}
+
+	tests := []struct {
+		name     string
+		options  Options
+		expected []string
+	}{
+		{
+			name:     "all components selected by default",
+			expected: []string{"cert-manager", "ingress-nginx", "monitoring", "shop"},
+		},
+		{
+			name:     "include patterns",
+			options:  Options{IncludeComponents: []string{"cert-*", "shop"}},
+			expected: []string{"cert-manager", "shop"},
+		},
+		{
+			name:     "exclude patterns",
+			options:  Options{ExcludeComponents: []string{"*-*"}},
+			expected: []string{"monitoring", "shop"},
+		},
+		{
+			name:     "exclude takes precedence",
+			options:  Options{IncludeComponents: []string{"*"}, ExcludeComponents: []string{"shop"}},
+			expected: []string{"cert-manager", "ingress-nginx", "monitoring"},
+		},
+		{
+			name:     "label equality",
+			options:  Options{ComponentSelector: "tier=infra"},
+			expected: []string{"cert-manager", "ingress-nginx"},
+		},
+		{
+			name:     "label inequality",
+			options:  Options{ComponentSelector: "tier==infra, team!=network"},
+			expected: []string{"cert-manager"},
+		},
+		{
+			name:     "label inequality matches components without label",
+			options:  Options{ComponentSelector: "team!=network"},
+			expected: []string{"cert-manager", "monitoring", "shop"},
+		},
+		{
+			name:     "label existence",
+			options:  Options{ComponentSelector: "team"},
+			expected: []string{"cert-manager", "ingress-nginx"},
+		},
+		{
+			name:     "label absence",
+			options:  Options{ComponentSelector: "!tier"},
+			expected: []string{"monitoring"},
+		},
+		{
+			name:     "patterns and labels",
+			options:  Options{IncludeComponents: []string{"*e*"}, ComponentSelector: "tier=infra"},
+			expected: []string{"cert-manager", "ingress-nginx"},
+		},
+	}
+
+	manifests := []*manifest.Manifest{
+		{Name: "cert-manager"},
+		{Name: "ingress-nginx"},
+		{Name: "monitoring"},
+		{Name: "shop"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Components = components
+
+			s, err := newComponentSelector(&test.options)
+			require.NoError(t, err)
+
+			names := make([]string, 0)
+			for _, m := range s.filter(manifests) {
+				names = append(names, m.Name)
+			}
+
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func TestComponentSelectorLoadLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "components")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, metadata := range map[string]string{
+		"cert-manager": "labels:\n  tier: infra\n  team: platform\n",
+		"shop":         "labels:\n  tier: infra\n",
+		"monitoring":   "",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+
+		if metadata != "" {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, manifest.ComponentMetadataFilename), []byte(metadata), 0644))
+		}
+	}
+
+	components, err := manifest.ResolveComponentDirs([]string{dir})
+	require.NoError(t, err)
+
+	o := &Options{
+		ComponentSelector: "tier=infra",
+		Components: map[string]ComponentOptions{
+			// component options take precedence over the metadata file
+			"shop": {Labels: map[string]string{"tier": "app"}},
+		},
+	}
+
+	s, err := newComponentSelector(o)
+	require.NoError(t, err)
+	require.NoError(t, s.loadLabels(components))
+
+	names := make([]string, 0)
+	for _, c := range s.filterDirs(components) {
+		names = append(names, c.Name)
+	}
+
+	assert.Equal(t, []string{"cert-manager"}, names)
+	assert.Equal(t, map[string]string{"tier": "app"}, o.Components["shop"].Labels)
+}
+
+func TestNewComponentSelectorErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{
+			name:     "invalid include pattern",
+			options:  Options{IncludeComponents: []string{"[foo"}},
+			expected: `invalid component pattern "[foo"`,
+		},
+		{
+			name:     "invalid exclude pattern",
+			options:  Options{ExcludeComponents: []string{"[foo"}},
+			expected: `invalid component pattern "[foo"`,
+		},
+		{
+			name:     "missing label key",
+			options:  Options{ComponentSelector: "=infra"},
+			expected: `invalid component selector "=infra"`,
+		},
+		{
+			name:     "invalid label value",
+			options:  Options{ComponentSelector: "tier=in=fra"},
+			expected: `invalid component selector "tier=in=fra"`,
+		},
+		{
+			name:     "empty requirement",
+			options:  Options{ComponentSelector: "tier=infra,"},
+			expected: `invalid component selector "tier=infra,"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newComponentSelector(&test.options)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+}
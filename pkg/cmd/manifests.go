@@ -39,6 +39,7 @@ func newApplyCommand() *cobra.Command {
 	o.AddFlags(cmd)
 
 	cmd.Flags().BoolVar(&o.ManagerOptions.AllManifests, "all-manifests", false, "Apply all manifests, even unchanged")
+	cmd.Flags().BoolVar(&o.ManagerOptions.OutputsFromSnapshot, "outputs-from-snapshot", false, "Read provisioner outputs from the snapshot next to the values file instead of invoking the provisioner")
 
 	return cmd
 }
@@ -61,6 +62,7 @@ func newDeleteCommand() *cobra.Command {
 	o.AddFlags(cmd)
 
 	cmd.Flags().BoolVar(&o.ManagerOptions.AllManifests, "all-manifests", false, "Attempt to delete all manifests, even the ones already absent")
+	cmd.Flags().BoolVar(&o.ManagerOptions.OutputsFromSnapshot, "outputs-from-snapshot", false, "Read provisioner outputs from the snapshot next to the values file instead of invoking the provisioner")
 
 	return cmd
 }
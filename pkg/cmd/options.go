@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/imdario/mergo"
@@ -19,13 +20,40 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	credentialSourceFlags       = "flags"
+	credentialSourceEnv         = "env"
+	credentialSourceProvisioner = "provisioner"
+	credentialSourceKubeconfig  = "kubeconfig"
+)
+
+// defaultCredentialSources is the default order in which credential sources
+// are consulted. The current context of the default kubeconfig is not
+// consulted unless explicitly configured to avoid making changes to whatever
+// cluster happens to be active.
+var defaultCredentialSources = []string{
+	credentialSourceFlags,
+	credentialSourceEnv,
+	credentialSourceProvisioner,
+}
+
+// validCredentialSources contains all valid credential sources.
+var validCredentialSources = []string{
+	credentialSourceFlags,
+	credentialSourceEnv,
+	credentialSourceProvisioner,
+	credentialSourceKubeconfig,
+}
+
 type Options struct {
 	Provisioner string `json:"provisioner,omitempty" yaml:"provisioner,omitempty"`
 	WorkingDir  string `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
 
-	Credentials        credentials.Credentials `json:"credentials,omitempty" yaml:"credentials,omitempty"`
-	ManagerOptions     cluster.Options         `json:"managerOptions,omitempty" yaml:"managerOptions,omitempty"`
-	ProvisionerOptions provisioner.Options     `json:"provisionerOptions,omitempty" yaml:"provisionerOptions,omitempty"`
+	Credentials        credentials.Credentials  `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	CredentialSources  []string                 `json:"credentialSources,omitempty" yaml:"credentialSources,omitempty"`
+	ManagerOptions     cluster.Options          `json:"managerOptions,omitempty" yaml:"managerOptions,omitempty"`
+	ProvisionerOptions provisioner.Options      `json:"provisionerOptions,omitempty" yaml:"provisionerOptions,omitempty"`
+	OutputSchema       provisioner.OutputSchema `json:"outputSchema,omitempty" yaml:"outputSchema,omitempty"`
 }
 
 func (o *Options) AddFlags(cmd *cobra.Command) {
@@ -36,6 +64,15 @@ func (o *Options) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&o.Credentials.Context, "cluster-context", "", "Kubeconfig context")
 	cmd.Flags().StringVar(&o.Credentials.Server, "cluster-server", "", "Kubernetes API server address")
 	cmd.Flags().StringVar(&o.Credentials.Token, "cluster-token", "", "Bearer token for authentication to the Kubernetes API server")
+	cmd.Flags().StringVar(&o.Credentials.CertificateAuthority, "cluster-certificate-authority", "", "Path to a CA bundle file for the Kubernetes API server")
+	cmd.Flags().StringVar(&o.Credentials.ClientCertificate, "cluster-client-certificate", "", "Path to a client certificate file for TLS authentication")
+	cmd.Flags().StringVar(&o.Credentials.ClientKey, "cluster-client-key", "", "Path to a client key file for TLS authentication")
+	cmd.Flags().BoolVar(&o.Credentials.InsecureSkipTLSVerify, "cluster-insecure-skip-tls-verify", false, "Do not verify the Kubernetes API server's certificate")
+	cmd.Flags().StringVar(&o.Credentials.Exec.Command, "cluster-exec-command", "", "Command of an exec auth plugin, e.g. aws")
+	cmd.Flags().StringArrayVar(&o.Credentials.Exec.Args, "cluster-exec-arg", nil, "Arg to pass to the exec auth plugin. Can be specified multiple times")
+	cmd.Flags().StringToStringVar(&o.Credentials.Exec.Env, "cluster-exec-env", nil, "Environment variables for the exec auth plugin in the form KEY=value")
+	cmd.Flags().StringVar(&o.Credentials.Exec.APIVersion, "cluster-exec-api-version", "", "API version of the exec auth plugin config")
+	cmd.Flags().StringSliceVar(&o.CredentialSources, "credential-sources", nil, "Comma separated list of credential sources to consult in order. Valid sources are flags, env, provisioner and kubeconfig (default: flags,env,provisioner)")
 
 	cmdutil.AddConfigFlag(cmd)
 	cmdutil.BindManagerFlags(cmd, &o.ManagerOptions)
@@ -118,14 +155,75 @@ func (o *Options) createManager() (*cluster.Manager, error) {
 		return nil, err
 	}
 
-	var credentialSource credentials.Source
-	if !o.Credentials.Empty() {
-		credentialSource = credentials.NewStaticSource(&o.Credentials)
-	} else if outputter, ok := infraProvisioner.(provisioner.Outputter); ok {
-		credentialSource = credentials.NewProvisionerOutputSource(outputter)
-	} else {
+	if err := o.OutputSchema.Validate(); err != nil {
+		return nil, err
+	}
+
+	var outputter provisioner.Outputter
+	if o.ManagerOptions.OutputsFromSnapshot {
+		filename := o.ManagerOptions.OutputsSnapshotFile()
+		log.Infof("reading provisioner outputs from snapshot %s", filename)
+		outputter = provisioner.NewFileOutputter(filename)
+	} else if po, ok := infraProvisioner.(provisioner.Outputter); ok {
+		outputter = po
+	}
+
+	if outputter != nil && len(o.OutputSchema) > 0 {
+		outputter = provisioner.NewSchemaOutputter(outputter, o.OutputSchema)
+	}
+
+	if outputter != nil && !o.ManagerOptions.OutputsFromSnapshot {
+		outputter = provisioner.NewOutputCache(outputter)
+	}
+
+	credentialSource, err := o.createCredentialSource(outputter)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.NewManager(credentialSource, infraProvisioner, outputter, template.NewRenderer()), nil
+}
+
+// createCredentialSource creates a credentials.Source which consults the
+// configured credential sources in order.
+func (o *Options) createCredentialSource(outputter provisioner.Outputter) (credentials.Source, error) {
+	names := o.CredentialSources
+	if len(names) == 0 {
+		names = defaultCredentialSources
+	}
+
+	sources := make([]credentials.NamedSource, 0, len(names))
+
+	for _, name := range names {
+		var source credentials.Source
+
+		switch name {
+		case credentialSourceFlags:
+			source = credentials.NewStaticSource(&o.Credentials)
+		case credentialSourceEnv:
+			source = credentials.NewEnvSource()
+		case credentialSourceProvisioner:
+			if outputter == nil {
+				continue
+			}
+
+			source = credentials.NewProvisionerOutputSource(outputter)
+		case credentialSourceKubeconfig:
+			source = credentials.NewCurrentContextSource()
+		default:
+			return nil, errors.Errorf(
+				"invalid credential source %q, valid sources are: %s",
+				name,
+				strings.Join(validCredentialSources, ", "),
+			)
+		}
+
+		sources = append(sources, credentials.NamedSource{Name: name, Source: source})
+	}
+
+	if len(sources) == 0 {
 		return nil, errors.New("please provide valid kubernetes credentials via the --cluster-* flags")
 	}
 
-	return cluster.NewManager(credentialSource, infraProvisioner, template.NewRenderer()), nil
+	return credentials.NewChainSource(sources...), nil
 }
@@ -2,13 +2,17 @@ package cmd
 
 import (
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/cluster"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/provisioner"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOptionsComplete(t *testing.T) {
@@ -63,10 +67,26 @@ func TestOptionsCreateManager(t *testing.T) {
 			expectError: true,
 		},
 		{
-			name:        "missing cluster options",
-			o:           &Options{Provisioner: "null"},
+			name: "no usable credential source",
+			o: &Options{
+				Provisioner:       "null",
+				CredentialSources: []string{"provisioner"},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid credential source",
+			o: &Options{
+				Provisioner:       "null",
+				CredentialSources: []string{"flags", "foo"},
+			},
 			expectError: true,
 		},
+		{
+			name:        "fallback credential sources",
+			o:           &Options{Provisioner: "null"},
+			expectError: false,
+		},
 		{
 			name: "valid cluster options",
 			o: &Options{
@@ -84,6 +104,37 @@ func TestOptionsCreateManager(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "outputs from snapshot",
+			o: &Options{
+				Provisioner: "null",
+				ManagerOptions: cluster.Options{
+					Values:              "/tmp/values.yaml",
+					OutputsFromSnapshot: true,
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "valid output schema",
+			o: &Options{
+				Provisioner: "terraform",
+				OutputSchema: provisioner.OutputSchema{
+					"kubeconfig": {Type: "string", Required: true},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid output schema",
+			o: &Options{
+				Provisioner: "terraform",
+				OutputSchema: provisioner.OutputSchema{
+					"kubeconfig": {Type: "foo"},
+				},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -98,3 +149,39 @@ func TestOptionsCreateManager(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionsDryRunFlag(t *testing.T) {
+	cases := []struct {
+		flags        []string
+		dryRun       bool
+		serverDryRun bool
+		expectError  bool
+	}{
+		{flags: []string{}},
+		{flags: []string{"--dry-run"}, dryRun: true},
+		{flags: []string{"--dry-run=true"}, dryRun: true},
+		{flags: []string{"--dry-run=client"}, dryRun: true},
+		{flags: []string{"--dry-run=server"}, dryRun: true, serverDryRun: true},
+		{flags: []string{"--dry-run=server", "--dry-run=none"}},
+		{flags: []string{"--dry-run=foo"}, expectError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.flags, " "), func(t *testing.T) {
+			o := &Options{}
+
+			cmd := &cobra.Command{}
+			o.AddFlags(cmd)
+
+			err := cmd.ParseFlags(tc.flags)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.dryRun, o.ManagerOptions.DryRun)
+			assert.Equal(t, tc.serverDryRun, o.ManagerOptions.ServerDryRun)
+		})
+	}
+}
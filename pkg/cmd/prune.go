@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	pluralize "github.com/gertd/go-pluralize"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/cluster"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/cmdutil"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewPruneCommand(r io.Reader, w io.Writer) *cobra.Command {
+	o := &Options{}
+
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Deletes orphaned resources from a cluster",
+		Long: "Finds resources in the cluster that are labeled with the instance ID\n" +
+			"but are not part of any rendered manifest and deletes them after confirmation.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(cmd))
+			cmdutil.CheckErr(o.Run(func(ctx context.Context, m *cluster.Manager, o *cluster.Options) error {
+				confirm := newConfirmFunc(r, w)
+				if yes {
+					confirm = func(resource.Slice) (bool, error) { return true, nil }
+				}
+
+				return m.Prune(ctx, o, confirm)
+			}))
+		},
+	}
+
+	o.AddFlags(cmd)
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete orphaned resources without asking for confirmation")
+	cmd.Flags().BoolVar(&o.ManagerOptions.OutputsFromSnapshot, "outputs-from-snapshot", false, "Read provisioner outputs from the snapshot next to the values file instead of invoking the provisioner")
+
+	return cmd
+}
+
+// newConfirmFunc creates a cluster.ConfirmFunc that asks for confirmation on
+// w and reads the answer from r.
+func newConfirmFunc(r io.Reader, w io.Writer) cluster.ConfirmFunc {
+	return func(resources resource.Slice) (bool, error) {
+		fmt.Fprintf(w, "Delete %s? [y/N]: ", pluralize.Pluralize("resource", len(resources), true))
+
+		answer, err := bufio.NewReader(r).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, errors.WithStack(err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		default:
+			fmt.Fprintln(w, "Aborted.")
+			return false, nil
+		}
+	}
+}
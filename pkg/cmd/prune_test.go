@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmFunc(t *testing.T) {
+	cases := []struct {
+		answer   string
+		expected bool
+	}{
+		{answer: "y\n", expected: true},
+		{answer: "YES\n", expected: true},
+		{answer: "n\n"},
+		{answer: "\n"},
+		{answer: ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.answer, func(t *testing.T) {
+			var w bytes.Buffer
+
+			confirm := newConfirmFunc(strings.NewReader(tc.answer), &w)
+
+			ok, err := confirm(resource.Slice{{Kind: "ConfigMap", Name: "foo"}, {Kind: "ConfigMap", Name: "bar"}})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, ok)
+			assert.Contains(t, w.String(), "Delete 2 resources? [y/N]: ")
+		})
+	}
+}
@@ -3,6 +3,8 @@ package cmdutil
 import (
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/cluster"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/provisioner"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/revision"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -25,15 +27,67 @@ func AddConfigFlag(cmd *cobra.Command) {
 // BindProvisionerFlags binds flags to provisioner options.
 func BindProvisionerFlags(cmd *cobra.Command, o *provisioner.Options) {
 	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 0, "Number of parallel provisioner resource operations")
+	cmd.Flags().StringVar(&o.Binary, "provisioner-binary", "", "Name or path of the provisioner binary, e.g. tofu instead of terraform")
+	cmd.Flags().StringArrayVar(&o.Args, "provisioner-arg", nil, "Global arg to pass to the provisioner binary. Can be specified multiple times")
+	cmd.Flags().StringToStringVar(&o.Env, "provisioner-env", nil, "Additional environment variables for the provisioner binary in the form KEY=value")
 }
 
 // BindManagerFlags binds flags to options.
 func BindManagerFlags(cmd *cobra.Command, o *cluster.Options) {
-	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Do not make any changes")
+	dryRun := cmd.Flags().VarPF(&dryRunValue{o}, "dry-run", "", `Do not make any changes. Must be "none", "client" or "server". With "server", resource changes and hooks are sent to the API server using server-side dry run`)
+	dryRun.NoOptDefVal = "client"
 	cmd.Flags().StringVar(&o.ManifestsDir, "manifests-dir", "./manifests", "Path to rendered manifests")
 	cmd.Flags().StringVar(&o.TemplatesDir, "templates-dir", "./templates", "Path to components containing manifest templates")
+	cmd.Flags().StringArrayVar(&o.TemplateOverlays, "template-overlay", nil, "Path to components that add, replace or disable components of the templates dir. Can be specified multiple times, later overlays take precedence")
 	cmd.Flags().StringVar(&o.Values, "values", "values.yaml", `Values file path`)
 	cmd.Flags().BoolVar(&o.NoSave, "no-save", false, "Do not save file changes")
 	cmd.Flags().BoolVar(&o.NoHooks, "no-hooks", false, "Skip executing hooks")
 	cmd.Flags().BoolVar(&o.FullDiff, "full-diff", false, "Display full component diff if there are changes")
+	cmd.Flags().BoolVar(&o.Wait, "wait", false, "Wait for applied workloads to become ready before a component upgrade is considered successful")
+	cmd.Flags().DurationVar(&o.WaitTimeout, "wait-timeout", revision.DefaultWaitTimeout, "Maximum time to wait for the resources of a component to become ready")
+	cmd.Flags().StringVar(&o.InstanceID, "instance-id", cluster.DefaultInstanceID, "ID of the kcm instance that is used to label applied resources")
+	cmd.Flags().StringArrayVar(&o.IncludeComponents, "component", nil, "Only process components whose name matches the glob pattern. Can be specified multiple times")
+	cmd.Flags().StringArrayVar(&o.ExcludeComponents, "exclude-component", nil, "Skip components whose name matches the glob pattern. Can be specified multiple times")
+	cmd.Flags().StringVar(&o.ComponentSelector, "component-selector", "", "Only process components whose labels match the selector, e.g. tier=infra,team!=ops")
+	cmd.Flags().BoolVar(&o.SaveOutputs, "save-outputs", false, "Save a snapshot of the provisioner outputs next to the values file")
+}
+
+// dryRunValue implements pflag.Value for the dry-run flag. It sets the
+// DryRun and ServerDryRun manager options.
+type dryRunValue struct {
+	o *cluster.Options
+}
+
+// String implements pflag.Value.
+func (v *dryRunValue) String() string {
+	switch {
+	case v.o.DryRun && v.o.ServerDryRun:
+		return "server"
+	case v.o.DryRun:
+		return "client"
+	default:
+		return "none"
+	}
+}
+
+// Set implements pflag.Value. For backwards compatibility, "true" and
+// "false" are accepted as well.
+func (v *dryRunValue) Set(s string) error {
+	switch s {
+	case "none", "false":
+		v.o.DryRun, v.o.ServerDryRun = false, false
+	case "client", "true":
+		v.o.DryRun, v.o.ServerDryRun = true, false
+	case "server":
+		v.o.DryRun, v.o.ServerDryRun = true, true
+	default:
+		return errors.Errorf(`invalid dry run mode %q, must be "none", "client" or "server"`, s)
+	}
+
+	return nil
+}
+
+// Type implements pflag.Value.
+func (v *dryRunValue) Type() string {
+	return "string"
 }
@@ -113,7 +113,7 @@ func (e *executor) RunSilentlyWithContext(ctx context.Context, cmd *exec.Cmd) (s
 }
 
 func (e *executor) run(ctx context.Context, buf *bytes.Buffer, cmd *exec.Cmd) (string, error) {
-	e.logger.WithField("args", cmd.Args).Debugf("executing command")
+	e.logger.WithField("args", RedactArgs(cmd.Args)).Debugf("executing command")
 
 	if err := cmd.Start(); err != nil {
 		return "", err
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces secret values in redacted args.
+const RedactedValue = "<redacted>"
+
+// secretFlagRegexp matches flag names that usually carry secret values.
+var secretFlagRegexp = regexp.MustCompile(`(?i)^--?[a-z0-9-]*(token|password|passwd|secret|api-?key|private-?key|certificate-key)[a-z0-9-]*$`)
+
+// RedactArgs returns a copy of args where the values of secret-looking flags
+// like `--token` or `--password` are replaced by RedactedValue. Both the
+// `--flag value` and `--flag=value` forms are supported. It is intended to
+// be used to make command lines safe for logging.
+func RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 && secretFlagRegexp.MatchString(parts[0]) {
+			redacted[i] = parts[0] + "=" + RedactedValue
+			continue
+		}
+
+		redacted[i] = arg
+
+		if secretFlagRegexp.MatchString(arg) && i+1 < len(args) {
+			i++
+			redacted[i] = RedactedValue
+		}
+	}
+
+	return redacted
+}
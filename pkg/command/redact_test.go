@@ -0,0 +1,50 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactArgs(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "no secrets",
+			args:     []string{"kubectl", "apply", "-f", "-", "--context", "test"},
+			expected: []string{"kubectl", "apply", "-f", "-", "--context", "test"},
+		},
+		{
+			name:     "separate values",
+			args:     []string{"kubectl", "--token", "foo", "--server", "https://localhost", "--password", "bar"},
+			expected: []string{"kubectl", "--token", "<redacted>", "--server", "https://localhost", "--password", "<redacted>"},
+		},
+		{
+			name:     "inline values",
+			args:     []string{"kubeadm", "join", "--discovery-token=abc", "--certificate-key=def", "--node-name=foo"},
+			expected: []string{"kubeadm", "join", "--discovery-token=<redacted>", "--certificate-key=<redacted>", "--node-name=foo"},
+		},
+		{
+			name:     "trailing flag without value",
+			args:     []string{"foo", "--client-secret"},
+			expected: []string{"foo", "--client-secret"},
+		},
+		{
+			name:     "positional args are untouched",
+			args:     []string{"echo", "token", "password=foo"},
+			expected: []string{"echo", "token", "password=foo"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{}, tc.args...)
+
+			require.Equal(t, tc.expected, RedactArgs(tc.args))
+			require.Equal(t, args, tc.args)
+		})
+	}
+}
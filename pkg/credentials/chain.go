@@ -0,0 +1,136 @@
+package credentials
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// NamedSource is a Source with a name. The name is used in log messages.
+type NamedSource struct {
+	Name string
+	Source
+}
+
+// ChainSource is a Source that tries multiple sources in order and merges
+// the credentials they provide. Fields that were already supplied by an
+// earlier source are not overridden by later ones. Once the merged
+// credentials contain a kubeconfig or a server, the remaining sources are
+// not consulted anymore, so that e.g. a fallback kubeconfig does not shadow
+// a server provided by an earlier source.
+type ChainSource struct {
+	sources []NamedSource
+}
+
+// NewChainSource creates a new ChainSource which consults sources in given
+// order.
+func NewChainSource(sources ...NamedSource) Source {
+	return &ChainSource{sources: sources}
+}
+
+// GetCredentials implements Source. Returns an error if a kubeconfig and
+// inline cluster config were supplied by different sources, e.g. a token via
+// flags and a kubeconfig via a later source, since the inline config would
+// be ignored.
+func (s *ChainSource) GetCredentials(ctx context.Context) (*Credentials, error) {
+	c := &Credentials{}
+
+	suppliedBy := make(map[string]string)
+
+	for _, source := range s.sources {
+		if c.complete() {
+			break
+		}
+
+		creds, err := source.GetCredentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, field := range mergeCredentials(c, creds) {
+			log.Debugf("credential field %s was supplied by %s source", field, source.Name)
+			suppliedBy[field] = source.Name
+		}
+	}
+
+	if err := checkMixedSources(suppliedBy); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// checkMixedSources returns an error if the kubeconfig was supplied by
+// another source than any of the inline cluster config fields.
+func checkMixedSources(suppliedBy map[string]string) error {
+	kubeconfigSource, ok := suppliedBy["kubeconfig"]
+	if !ok {
+		return nil
+	}
+
+	fields := make([]string, 0, len(suppliedBy))
+	for field := range suppliedBy {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if field == "kubeconfig" || field == "context" || suppliedBy[field] == kubeconfigSource {
+			continue
+		}
+
+		return errors.Errorf(
+			"credential field %s supplied by %s source cannot be combined with the kubeconfig supplied by %s source",
+			field,
+			suppliedBy[field],
+			kubeconfigSource,
+		)
+	}
+
+	return nil
+}
+
+// complete returns true if c contains enough information to select a
+// cluster.
+func (c *Credentials) complete() bool {
+	return c.Kubeconfig != "" || c.Server != ""
+}
+
+// mergeCredentials sets all fields of dst that are empty to the values of
+// src. Returns the names of the fields that were set.
+func mergeCredentials(dst, src *Credentials) []string {
+	fields := make([]string, 0)
+
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+
+	for i := 0; i < dstValue.NumField(); i++ {
+		if isEmptyField(dstValue.Field(i)) && !isEmptyField(srcValue.Field(i)) {
+			dstValue.Field(i).Set(srcValue.Field(i))
+			fields = append(fields, fieldName(dstValue.Type().Field(i)))
+		}
+	}
+
+	return fields
+}
+
+func isEmptyField(v reflect.Value) bool {
+	if e, ok := v.Addr().Interface().(interface{ Empty() bool }); ok {
+		return e.Empty()
+	}
+
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+
+	return f.Name
+}
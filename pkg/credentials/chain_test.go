@@ -0,0 +1,126 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errorSource struct{}
+
+func (errorSource) GetCredentials(ctx context.Context) (*Credentials, error) {
+	return nil, errors.New("whoops")
+}
+
+func TestChainSource(t *testing.T) {
+	cases := []struct {
+		name        string
+		sources     []NamedSource
+		expected    *Credentials
+		expectError bool
+	}{
+		{
+			name:     "no sources",
+			expected: &Credentials{},
+		},
+		{
+			name: "merges fields, earlier sources win",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Token: "flagtoken"})},
+				{"env", NewStaticSource(&Credentials{Token: "envtoken", CertificateAuthority: "/tmp/ca.crt"})},
+				{"provisioner", NewStaticSource(&Credentials{Server: "https://localhost:6443"})},
+				{"kubeconfig", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig"})},
+			},
+			expected: &Credentials{
+				Server:               "https://localhost:6443",
+				Token:                "flagtoken",
+				CertificateAuthority: "/tmp/ca.crt",
+			},
+		},
+		{
+			name: "context from flags and kubeconfig from provisioner",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Context: "prod"})},
+				{"provisioner", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig", Context: "default"})},
+			},
+			expected: &Credentials{
+				Kubeconfig: "/tmp/kubeconfig",
+				Context:    "prod",
+			},
+		},
+		{
+			name: "falls back to later sources",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{})},
+				{"kubeconfig", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig", Context: "default"})},
+			},
+			expected: &Credentials{
+				Kubeconfig: "/tmp/kubeconfig",
+				Context:    "default",
+			},
+		},
+		{
+			name: "exec config is merged as a whole",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Exec: ExecConfig{Args: []string{}}})},
+				{"provisioner", NewStaticSource(&Credentials{Server: "https://localhost:6443", Exec: ExecConfig{Command: "aws"}})},
+			},
+			expected: &Credentials{
+				Server: "https://localhost:6443",
+				Exec:   ExecConfig{Command: "aws"},
+			},
+		},
+		{
+			name: "inline config and kubeconfig from different sources",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Token: "flagtoken"})},
+				{"kubeconfig", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig", Context: "default"})},
+			},
+			expectError: true,
+		},
+		{
+			name: "inline config and kubeconfig from the same source",
+			sources: []NamedSource{
+				{"provisioner", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig", Token: "token"})},
+			},
+			expected: &Credentials{
+				Kubeconfig: "/tmp/kubeconfig",
+				Token:      "token",
+			},
+		},
+		{
+			name: "source error",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Context: "prod"})},
+				{"provisioner", errorSource{}},
+			},
+			expectError: true,
+		},
+		{
+			name: "later sources are not consulted if credentials are complete",
+			sources: []NamedSource{
+				{"flags", NewStaticSource(&Credentials{Kubeconfig: "/tmp/kubeconfig"})},
+				{"provisioner", errorSource{}},
+			},
+			expected: &Credentials{Kubeconfig: "/tmp/kubeconfig"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewChainSource(tc.sources...)
+
+			creds, err := s.GetCredentials(context.Background())
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, creds)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package credentials
 
-import "context"
+import (
+	"context"
+	"reflect"
+)
 
 var (
 	// Empty are empty credentials.
@@ -21,9 +24,63 @@ type Credentials struct {
 	Token      string `json:"token,omitempty" yaml:"token,omitempty"`
 	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
 	Context    string `json:"context,omitempty" yaml:"context,omitempty"`
+
+	// CertificateAuthority is the path to a CA bundle file.
+	// CertificateAuthorityData is the CA bundle, either PEM encoded or base64
+	// encoded PEM as found in kubeconfig files.
+	CertificateAuthority     string `json:"certificateAuthority,omitempty" yaml:"certificateAuthority,omitempty"`
+	CertificateAuthorityData string `json:"certificateAuthorityData,omitempty" yaml:"certificateAuthorityData,omitempty"`
+
+	// ClientCertificate and ClientKey are paths to the client certificate and
+	// key files used for TLS client authentication. The *Data fields hold
+	// their contents and support the same encodings as
+	// CertificateAuthorityData.
+	ClientCertificate     string `json:"clientCertificate,omitempty" yaml:"clientCertificate,omitempty"`
+	ClientCertificateData string `json:"clientCertificateData,omitempty" yaml:"clientCertificateData,omitempty"`
+	ClientKey             string `json:"clientKey,omitempty" yaml:"clientKey,omitempty"`
+	ClientKeyData         string `json:"clientKeyData,omitempty" yaml:"clientKeyData,omitempty"`
+
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty" yaml:"insecureSkipTLSVerify,omitempty"`
+
+	// Exec configures an exec-based auth plugin, e.g. `aws eks get-token`.
+	Exec ExecConfig `json:"exec,omitempty" yaml:"exec,omitempty"`
+}
+
+// ExecConfig configures a command that is executed by kubectl to obtain
+// credentials for the cluster.
+type ExecConfig struct {
+	Command    string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Args       []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Env        map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	APIVersion string            `json:"apiVersion,omitempty" yaml:"apiVersion,omitempty"`
+}
+
+// Empty returns true if the exec config is empty.
+func (e *ExecConfig) Empty() bool {
+	return e.Command == ""
 }
 
 // Empty returns true if the credentials are empty.
 func (c *Credentials) Empty() bool {
-	return *c == Empty
+	if !c.Exec.Empty() {
+		return false
+	}
+
+	other := *c
+	other.Exec = ExecConfig{}
+
+	return reflect.DeepEqual(other, Empty)
+}
+
+// HasInlineConfig returns true if the credentials contain cluster connection
+// details that are not read from a kubeconfig file, e.g. server and token.
+func (c *Credentials) HasInlineConfig() bool {
+	if c.Kubeconfig != "" {
+		return false
+	}
+
+	inline := *c
+	inline.Context = ""
+
+	return !inline.Empty()
 }
@@ -0,0 +1,50 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsEmpty(t *testing.T) {
+	assert.True(t, (&Credentials{}).Empty())
+	assert.True(t, (&Credentials{Exec: ExecConfig{Args: []string{}}}).Empty())
+	assert.False(t, (&Credentials{Context: "foo"}).Empty())
+	assert.False(t, (&Credentials{Exec: ExecConfig{Command: "aws"}}).Empty())
+}
+
+func TestCredentialsHasInlineConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		c        Credentials
+		expected bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "context only",
+			c:    Credentials{Context: "foo"},
+		},
+		{
+			name: "kubeconfig",
+			c:    Credentials{Kubeconfig: "/tmp/kubeconfig", Server: "https://localhost"},
+		},
+		{
+			name:     "server and token",
+			c:        Credentials{Server: "https://localhost", Token: "foo"},
+			expected: true,
+		},
+		{
+			name:     "exec",
+			c:        Credentials{Exec: ExecConfig{Command: "aws"}},
+			expected: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.c.HasInlineConfig())
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// CurrentContextSource is a Source that provides the current context of the
+// user's kubeconfig. The kubeconfig is located via the KUBECONFIG
+// environment variable and defaults to ~/.kube/config. Empty credentials are
+// returned if there is no kubeconfig.
+type CurrentContextSource struct {
+	filename string
+}
+
+// NewCurrentContextSource creates a new CurrentContextSource.
+func NewCurrentContextSource() Source {
+	return &CurrentContextSource{}
+}
+
+// GetCredentials implements Source.
+func (s *CurrentContextSource) GetCredentials(ctx context.Context) (*Credentials, error) {
+	filename, err := s.kubeconfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &Credentials{}, nil
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var config struct {
+		CurrentContext string `yaml:"current-context"`
+	}
+
+	if err := yaml.Unmarshal(buf, &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse kubeconfig %s", filename)
+	}
+
+	return &Credentials{Kubeconfig: filename, Context: config.CurrentContext}, nil
+}
+
+func (s *CurrentContextSource) kubeconfigFile() (string, error) {
+	if s.filename != "" {
+		return s.filename, nil
+	}
+
+	// For simplicity we only consider the first file if KUBECONFIG contains
+	// a list of files.
+	if files := filepath.SplitList(os.Getenv("KUBECONFIG")); len(files) > 0 && files[0] != "" {
+		return files[0], nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return filepath.Join(home, ".kube", "config"), nil
+}
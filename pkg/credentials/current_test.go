@@ -0,0 +1,45 @@
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentContextSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config")
+
+	s := &CurrentContextSource{filename: filename}
+
+	creds, err := s.GetCredentials(context.Background())
+
+	require.NoError(t, err)
+	assert.True(t, creds.Empty())
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("apiVersion: v1\nkind: Config\ncurrent-context: prod\n"), 0600))
+
+	creds, err = s.GetCredentials(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, &Credentials{Kubeconfig: filename, Context: "prod"}, creds)
+}
+
+func TestCurrentContextSourceKubeconfigEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"KUBECONFIG": "/tmp/foo" + string(os.PathListSeparator) + "/tmp/bar",
+	})()
+
+	filename, err := (&CurrentContextSource{}).kubeconfigFile()
+
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/foo", filename)
+}
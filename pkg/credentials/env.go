@@ -0,0 +1,62 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EnvPrefix is the prefix of the environment variables read by EnvSource.
+const EnvPrefix = "KCM_CLUSTER_"
+
+// EnvSource is a Source that reads credentials from KCM_CLUSTER_*
+// environment variables, e.g. KCM_CLUSTER_SERVER or KCM_CLUSTER_TOKEN. The
+// variable names correspond to the --cluster-* flags.
+type EnvSource struct{}
+
+// NewEnvSource creates a new EnvSource.
+func NewEnvSource() Source {
+	return &EnvSource{}
+}
+
+// GetCredentials implements Source.
+func (s *EnvSource) GetCredentials(ctx context.Context) (*Credentials, error) {
+	c := &Credentials{}
+
+	stringValues := map[string]*string{
+		"SERVER":                     &c.Server,
+		"TOKEN":                      &c.Token,
+		"KUBECONFIG":                 &c.Kubeconfig,
+		"CONTEXT":                    &c.Context,
+		"CERTIFICATE_AUTHORITY":      &c.CertificateAuthority,
+		"CERTIFICATE_AUTHORITY_DATA": &c.CertificateAuthorityData,
+		"CLIENT_CERTIFICATE":         &c.ClientCertificate,
+		"CLIENT_CERTIFICATE_DATA":    &c.ClientCertificateData,
+		"CLIENT_KEY":                 &c.ClientKey,
+		"CLIENT_KEY_DATA":            &c.ClientKeyData,
+		"EXEC_COMMAND":               &c.Exec.Command,
+		"EXEC_API_VERSION":           &c.Exec.APIVersion,
+	}
+
+	for name, ptr := range stringValues {
+		*ptr = os.Getenv(EnvPrefix + name)
+	}
+
+	if args := os.Getenv(EnvPrefix + "EXEC_ARGS"); args != "" {
+		c.Exec.Args = strings.Fields(args)
+	}
+
+	if insecure := os.Getenv(EnvPrefix + "INSECURE_SKIP_TLS_VERIFY"); insecure != "" {
+		value, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %sINSECURE_SKIP_TLS_VERIFY", EnvPrefix)
+		}
+
+		c.InsecureSkipTLSVerify = value
+	}
+
+	return c, nil
+}
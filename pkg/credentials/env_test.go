@@ -0,0 +1,55 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	for name, value := range env {
+		require.NoError(t, os.Setenv(name, value))
+	}
+
+	return func() {
+		for name := range env {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"KCM_CLUSTER_SERVER":                   "https://localhost:6443",
+		"KCM_CLUSTER_CERTIFICATE_AUTHORITY":    "/tmp/ca.crt",
+		"KCM_CLUSTER_INSECURE_SKIP_TLS_VERIFY": "true",
+		"KCM_CLUSTER_EXEC_COMMAND":             "aws",
+		"KCM_CLUSTER_EXEC_ARGS":                "eks get-token --cluster-name foo",
+	})()
+
+	creds, err := NewEnvSource().GetCredentials(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, &Credentials{
+		Server:                "https://localhost:6443",
+		CertificateAuthority:  "/tmp/ca.crt",
+		InsecureSkipTLSVerify: true,
+		Exec: ExecConfig{
+			Command: "aws",
+			Args:    []string{"eks", "get-token", "--cluster-name", "foo"},
+		},
+	}, creds)
+}
+
+func TestEnvSourceInvalidBool(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"KCM_CLUSTER_INSECURE_SKIP_TLS_VERIFY": "maybe",
+	})()
+
+	_, err := NewEnvSource().GetCredentials(context.Background())
+
+	require.Error(t, err)
+}
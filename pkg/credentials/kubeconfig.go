@@ -0,0 +1,210 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	kubeconfigName = "kcm"
+
+	// DefaultExecAPIVersion is the api version of the exec auth plugin
+	// config if none is specified.
+	DefaultExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+)
+
+type kubeconfig struct {
+	APIVersion     string              `yaml:"apiVersion"`
+	Kind           string              `yaml:"kind"`
+	Clusters       []kubeconfigCluster `yaml:"clusters"`
+	Users          []kubeconfigUser    `yaml:"users"`
+	Contexts       []kubeconfigContext `yaml:"contexts"`
+	CurrentContext string              `yaml:"current-context"`
+}
+
+type kubeconfigCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server,omitempty"`
+		CertificateAuthority     string `yaml:"certificate-authority,omitempty"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+		InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+	} `yaml:"cluster"`
+}
+
+type kubeconfigUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Token                 string          `yaml:"token,omitempty"`
+		ClientCertificate     string          `yaml:"client-certificate,omitempty"`
+		ClientCertificateData string          `yaml:"client-certificate-data,omitempty"`
+		ClientKey             string          `yaml:"client-key,omitempty"`
+		ClientKeyData         string          `yaml:"client-key-data,omitempty"`
+		Exec                  *kubeconfigExec `yaml:"exec,omitempty"`
+	} `yaml:"user"`
+}
+
+type kubeconfigExec struct {
+	APIVersion string                 `yaml:"apiVersion"`
+	Command    string                 `yaml:"command"`
+	Args       []string               `yaml:"args,omitempty"`
+	Env        []kubeconfigExecEnvVar `yaml:"env,omitempty"`
+}
+
+type kubeconfigExecEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type kubeconfigContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	} `yaml:"context"`
+}
+
+// WriteTempKubeconfig writes a kubeconfig file containing the inline cluster
+// config of c (e.g. server, token and certificates) to a temporary location
+// and returns its filename. The file is only readable by the current user.
+// The caller is responsible for removing the file once it is not needed
+// anymore.
+func WriteTempKubeconfig(c *Credentials) (string, error) {
+	config, err := buildKubeconfig(c)
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := yaml.Marshal(config)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return WriteTempKubeconfigContent(buf)
+}
+
+// WriteTempKubeconfigContent writes the kubeconfig content buf to a
+// temporary location and returns its filename. The file is only readable by
+// the current user. The caller is responsible for removing the file once it
+// is not needed anymore.
+func WriteTempKubeconfigContent(buf []byte) (string, error) {
+	f, err := file.NewTempFile("kubeconfig", buf)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write temporary kubeconfig")
+	}
+
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", errors.WithStack(err)
+	}
+
+	return f.Name(), nil
+}
+
+func buildKubeconfig(c *Credentials) (*kubeconfig, error) {
+	var err error
+
+	cluster := kubeconfigCluster{Name: kubeconfigName}
+	cluster.Cluster.Server = c.Server
+	cluster.Cluster.CertificateAuthorityData = encodeData(c.CertificateAuthorityData)
+	cluster.Cluster.InsecureSkipTLSVerify = c.InsecureSkipTLSVerify
+
+	user := kubeconfigUser{Name: kubeconfigName}
+	user.User.Token = c.Token
+	user.User.ClientCertificateData = encodeData(c.ClientCertificateData)
+	user.User.ClientKeyData = encodeData(c.ClientKeyData)
+
+	// Relative paths in kubeconfig files are resolved relative to the
+	// kubeconfig itself, which resides in a temporary directory, so we have
+	// to make them absolute.
+	if cluster.Cluster.CertificateAuthority, err = absPath(c.CertificateAuthority); err != nil {
+		return nil, err
+	}
+
+	if user.User.ClientCertificate, err = absPath(c.ClientCertificate); err != nil {
+		return nil, err
+	}
+
+	if user.User.ClientKey, err = absPath(c.ClientKey); err != nil {
+		return nil, err
+	}
+
+	if !c.Exec.Empty() {
+		user.User.Exec = buildKubeconfigExec(&c.Exec)
+	}
+
+	context := kubeconfigContext{Name: kubeconfigName}
+	context.Context.Cluster = kubeconfigName
+	context.Context.User = kubeconfigName
+
+	config := &kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []kubeconfigCluster{cluster},
+		Users:          []kubeconfigUser{user},
+		Contexts:       []kubeconfigContext{context},
+		CurrentContext: kubeconfigName,
+	}
+
+	return config, nil
+}
+
+func buildKubeconfigExec(e *ExecConfig) *kubeconfigExec {
+	exec := &kubeconfigExec{
+		APIVersion: e.APIVersion,
+		Command:    e.Command,
+		Args:       e.Args,
+	}
+
+	if exec.APIVersion == "" {
+		exec.APIVersion = DefaultExecAPIVersion
+	}
+
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		exec.Env = append(exec.Env, kubeconfigExecEnvVar{Name: name, Value: e.Env[name]})
+	}
+
+	return exec
+}
+
+// encodeData base64 encodes PEM data. Data that is not PEM encoded is
+// expected to be base64 encoded already and is returned as is.
+func encodeData(data string) string {
+	if !strings.Contains(data, "-----BEGIN ") {
+		return data
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(data))
+}
+
+func absPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	path, err = filepath.Abs(path)
+
+	return path, errors.WithStack(err)
+}
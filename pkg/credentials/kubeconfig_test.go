@@ -0,0 +1,108 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTempKubeconfig(t *testing.T) {
+	c := &Credentials{
+		Server: "https://localhost:6443",
+		Token:  "sometoken",
+	}
+
+	filename, err := WriteTempKubeconfig(c)
+	require.NoError(t, err)
+	defer os.Remove(filename)
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	buf, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	expected := `apiVersion: v1
+kind: Config
+clusters:
+- name: kcm
+  cluster:
+    server: https://localhost:6443
+users:
+- name: kcm
+  user:
+    token: sometoken
+contexts:
+- name: kcm
+  context:
+    cluster: kcm
+    user: kcm
+current-context: kcm
+`
+
+	assert.Equal(t, expected, string(buf))
+}
+
+func TestWriteTempKubeconfigTLSAndExec(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	c := &Credentials{
+		Server:                   "https://localhost:6443",
+		CertificateAuthorityData: "-----BEGIN CERTIFICATE-----\nfoo\n-----END CERTIFICATE-----\n",
+		ClientCertificate:        "client.crt",
+		ClientKeyData:            "a2V5",
+		InsecureSkipTLSVerify:    true,
+		Exec: ExecConfig{
+			Command: "aws",
+			Args:    []string{"eks", "get-token"},
+			Env:     map[string]string{"B": "2", "A": "1"},
+		},
+	}
+
+	filename, err := WriteTempKubeconfig(c)
+	require.NoError(t, err)
+	defer os.Remove(filename)
+
+	buf, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	expected := `apiVersion: v1
+kind: Config
+clusters:
+- name: kcm
+  cluster:
+    server: https://localhost:6443
+    certificate-authority-data: LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCmZvbwotLS0tLUVORCBDRVJUSUZJQ0FURS0tLS0tCg==
+    insecure-skip-tls-verify: true
+users:
+- name: kcm
+  user:
+    client-certificate: ` + filepath.Join(cwd, "client.crt") + `
+    client-key-data: a2V5
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: aws
+      args:
+      - eks
+      - get-token
+      env:
+      - name: A
+        value: "1"
+      - name: B
+        value: "2"
+contexts:
+- name: kcm
+  context:
+    cluster: kcm
+    user: kcm
+current-context: kcm
+`
+
+	assert.Equal(t, expected, string(buf))
+}
@@ -2,6 +2,7 @@ package credentials
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/provisioner"
 )
@@ -17,7 +18,9 @@ func NewProvisionerOutputSource(o provisioner.Outputter) Source {
 	return &ProvisionerOutputSource{o}
 }
 
-// GetCredentials implements Source.
+// GetCredentials implements Source. The output keys are the same as the
+// field names of Credentials in config files, e.g. `server` or
+// `certificateAuthorityData`.
 func (s *ProvisionerOutputSource) GetCredentials(ctx context.Context) (*Credentials, error) {
 	v, err := s.o.Output(ctx)
 	if err != nil {
@@ -26,21 +29,59 @@ func (s *ProvisionerOutputSource) GetCredentials(ctx context.Context) (*Credenti
 
 	c := &Credentials{}
 
-	if server, ok := v["server"].(string); ok {
-		c.Server = server
+	stringValues := map[string]*string{
+		"server":                   &c.Server,
+		"token":                    &c.Token,
+		"kubeconfig":               &c.Kubeconfig,
+		"context":                  &c.Context,
+		"certificateAuthority":     &c.CertificateAuthority,
+		"certificateAuthorityData": &c.CertificateAuthorityData,
+		"clientCertificate":        &c.ClientCertificate,
+		"clientCertificateData":    &c.ClientCertificateData,
+		"clientKey":                &c.ClientKey,
+		"clientKeyData":            &c.ClientKeyData,
 	}
 
-	if token, ok := v["token"].(string); ok {
-		c.Token = token
+	for key, ptr := range stringValues {
+		if value, ok := v[key].(string); ok {
+			*ptr = value
+		}
 	}
 
-	if kubeconfig, ok := v["kubeconfig"].(string); ok {
-		c.Kubeconfig = kubeconfig
+	if insecure, ok := v["insecureSkipTLSVerify"].(bool); ok {
+		c.InsecureSkipTLSVerify = insecure
 	}
 
-	if context, ok := v["context"].(string); ok {
-		c.Context = context
+	if exec, ok := v["exec"].(map[string]interface{}); ok {
+		c.Exec = parseExecConfig(exec)
 	}
 
 	return c, nil
 }
+
+func parseExecConfig(v map[string]interface{}) ExecConfig {
+	e := ExecConfig{}
+
+	if command, ok := v["command"].(string); ok {
+		e.Command = command
+	}
+
+	if apiVersion, ok := v["apiVersion"].(string); ok {
+		e.APIVersion = apiVersion
+	}
+
+	if args, ok := v["args"].([]interface{}); ok {
+		for _, arg := range args {
+			e.Args = append(e.Args, fmt.Sprint(arg))
+		}
+	}
+
+	if env, ok := v["env"].(map[string]interface{}); ok {
+		e.Env = make(map[string]string, len(env))
+		for name, value := range env {
+			e.Env[name] = fmt.Sprint(value)
+		}
+	}
+
+	return e
+}
@@ -23,3 +23,40 @@ func TestProvisionerOutputSource(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "/tmp/kubeconfig", credentials.Kubeconfig)
 }
+
+type mapOutputter map[string]interface{}
+
+func (o mapOutputter) Output(ctx context.Context) (map[string]interface{}, error) {
+	return o, nil
+}
+
+func TestProvisionerOutputSourceTLSAndExec(t *testing.T) {
+	p := NewProvisionerOutputSource(mapOutputter{
+		"server":                   "https://localhost:6443",
+		"certificateAuthorityData": "Y2E=",
+		"clientCertificate":        "/tmp/client.crt",
+		"clientKey":                "/tmp/client.key",
+		"insecureSkipTLSVerify":    true,
+		"exec": map[string]interface{}{
+			"command": "aws",
+			"args":    []interface{}{"eks", "get-token", "--cluster-name", "foo"},
+			"env":     map[string]interface{}{"AWS_PROFILE": "prod"},
+		},
+	})
+
+	credentials, err := p.GetCredentials(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Credentials{
+		Server:                   "https://localhost:6443",
+		CertificateAuthorityData: "Y2E=",
+		ClientCertificate:        "/tmp/client.crt",
+		ClientKey:                "/tmp/client.key",
+		InsecureSkipTLSVerify:    true,
+		Exec: ExecConfig{
+			Command: "aws",
+			Args:    []string{"eks", "get-token", "--cluster-name", "foo"},
+			Env:     map[string]string{"AWS_PROFILE": "prod"},
+		},
+	}, credentials)
+}
@@ -15,7 +15,9 @@ func NewTempFile(prefix string, content []byte) (*os.File, error) {
 	}
 
 	if _, err := f.Write(content); err != nil {
-		return nil, os.Remove(f.Name())
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
 	}
 
 	return f, nil
@@ -1,6 +1,7 @@
 package hook
 
 import (
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +15,14 @@ const (
 	// an optional condition to wait for with the timeout specified in
 	// WaitTimeoutAnnotation. The PolicyAnnotation can contain policies that
 	// should be enforced, e.g. deletion of the hook resource after the wait
-	// condition was met.
+	// condition was met. Hooks of the same type are executed in groups
+	// ordered by the integer in WeightAnnotation. Hooks with the same weight
+	// are executed in parallel.
 	Annotation            = "kcm/hook"
 	WaitForAnnotation     = "kcm/hook-wait-for"
 	WaitTimeoutAnnotation = "kcm/hook-wait-timeout"
 	PolicyAnnotation      = "kcm/hook-policy"
+	WeightAnnotation      = "kcm/hook-weight"
 
 	// Types of hooks.
 	PreCreate   = "pre-create"
@@ -28,8 +32,20 @@ const (
 	PostDelete  = "post-delete"
 	PostUpgrade = "post-upgrade"
 
-	// Policies for hooks.
+	// DefaultWaitTimeout is the time to wait for hooks that use the default
+	// wait condition of their kind and do not specify the
+	// WaitTimeoutAnnotation.
+	DefaultWaitTimeout = 30 * time.Minute
+
+	// Policies for hooks. Hooks are always deleted before their creation,
+	// DeleteBeforeCreationPolicy only makes this explicit.
+	// DeleteAfterCompletionPolicy is kept for compatibility, it is an alias
+	// of DeleteOnSuccessPolicy.
+	DeleteBeforeCreationPolicy  = "delete-before-creation"
+	DeleteOnSuccessPolicy       = "delete-on-success"
 	DeleteAfterCompletionPolicy = "delete-after-completion"
+	KeepOnFailurePolicy         = "keep-on-failure"
+	IgnoreFailurePolicy         = "ignore-failure"
 )
 
 var (
@@ -50,7 +66,19 @@ var (
 
 	// Policies contains all valid hook policies.
 	Policies = []string{
+		DeleteBeforeCreationPolicy,
+		DeleteOnSuccessPolicy,
 		DeleteAfterCompletionPolicy,
+		KeepOnFailurePolicy,
+		IgnoreFailurePolicy,
+	}
+
+	// DefaultWaitConditions contains the conditions that are waited for if
+	// a hook of given kind does not specify the WaitForAnnotation. Hooks of
+	// other kinds are not waited for by default.
+	DefaultWaitConditions = map[string]string{
+		resource.Job: "condition=complete",
+		resource.Pod: "jsonpath={.status.phase}=Succeeded",
 	}
 )
 
@@ -60,34 +88,48 @@ type Pair struct {
 	Pre, Post string
 }
 
-// Hook is a resource that is applied during revision upgrade.
+// Hook is a resource that is applied during revision upgrade. Failed hooks
+// are deleted after their logs were captured unless KeepOnFailure is set.
 type Hook struct {
 	Resource              *resource.Resource
 	Type                  string
 	WaitFor               string
 	WaitTimeout           time.Duration
+	DeleteBeforeCreation  bool
 	DeleteAfterCompletion bool
+	KeepOnFailure         bool
+	IgnoreFailure         bool
+	Weight                int
 }
 
 // New creates a new hook with given resource and annotations. Will return an
-// error if the annotations are invalid or the resource does not match any of
-// the allowed hook kinds.
+// error if the annotations are invalid. If no wait condition is specified,
+// the default wait condition for the resource kind is used together with
+// DefaultWaitTimeout, unless a wait timeout is specified.
 func New(r *resource.Resource, annotations map[string]string) (*Hook, error) {
 	var err error
 
-	if r.Kind != resource.Job {
-		return nil, errors.Errorf(`unsupported hook kind %q, currently only %q is supported.`, r.Kind, resource.Job)
-	}
-
 	typ := annotations[Annotation]
 	if !isValidType(typ) {
 		return nil, errors.Errorf(`invalid hook type %q, allowed values: %s`, typ, strings.Join(Types, ", "))
 	}
 
 	h := &Hook{
-		Resource: r,
-		Type:     typ,
-		WaitFor:  annotations[WaitForAnnotation],
+		Resource:             r,
+		Type:                 typ,
+		WaitFor:              annotations[WaitForAnnotation],
+		DeleteBeforeCreation: true,
+	}
+
+	if h.WaitFor == "" {
+		h.WaitFor = DefaultWaitConditions[r.Kind]
+	}
+
+	if weight, ok := annotations[WeightAnnotation]; ok {
+		h.Weight, err = strconv.Atoi(weight)
+		if err != nil {
+			return nil, errors.Errorf("invalid value %q for annotation %s: must be an integer", weight, WeightAnnotation)
+		}
 	}
 
 	wt, ok := annotations[WaitTimeoutAnnotation]
@@ -96,24 +138,32 @@ func New(r *resource.Resource, annotations map[string]string) (*Hook, error) {
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to parse annotation %s: %s", WaitTimeoutAnnotation, wt)
 		}
+	} else if annotations[WaitForAnnotation] == "" && h.WaitFor != "" {
+		h.WaitTimeout = DefaultWaitTimeout
 	}
 
 	ps, ok := annotations[PolicyAnnotation]
-	if ok {
-		policies := strings.Split(ps, ",")
-		for _, p := range policies {
-			if !isValidPolicy(p) {
-				return nil, errors.Errorf(`invalid hook policy %q, allowed values: %s`, p, strings.Join(Policies, ", "))
-			}
+	if !ok {
+		return h, nil
+	}
 
-			switch p {
-			case DeleteAfterCompletionPolicy:
-				if h.WaitFor == "" {
-					return nil, errors.Errorf(`policy %q requires to also specify the %s annotation with a valid condition`, p, WaitForAnnotation)
-				}
+	policies := strings.Split(ps, ",")
+	for _, p := range policies {
+		if !isValidPolicy(p) {
+			return nil, errors.Errorf(`invalid hook policy %q, allowed values: %s`, p, strings.Join(Policies, ", "))
+		}
 
-				h.DeleteAfterCompletion = true
+		switch p {
+		case DeleteOnSuccessPolicy, DeleteAfterCompletionPolicy:
+			if h.WaitFor == "" {
+				return nil, errors.Errorf(`policy %q requires to also specify the %s annotation with a valid condition`, p, WaitForAnnotation)
 			}
+
+			h.DeleteAfterCompletion = true
+		case KeepOnFailurePolicy:
+			h.KeepOnFailure = true
+		case IgnoreFailurePolicy:
+			h.IgnoreFailure = true
 		}
 	}
 
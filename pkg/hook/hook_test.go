@@ -18,8 +18,65 @@ func TestNew(t *testing.T) {
 		expectError bool
 	}{
 		{
-			description: "unsupported resource kind",
-			resource:    &resource.Resource{Name: "foo", Kind: resource.StatefulSet},
+			description: "job hook with default wait condition",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{Annotation: PreCreate},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                 PreCreate,
+				WaitFor:              "condition=complete",
+				WaitTimeout:          DefaultWaitTimeout,
+				DeleteBeforeCreation: true,
+			},
+		},
+		{
+			description: "job hook with default wait condition and timeout",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{
+				Annotation:            PreCreate,
+				WaitTimeoutAnnotation: "1h",
+			},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                 PreCreate,
+				WaitFor:              "condition=complete",
+				WaitTimeout:          time.Hour,
+				DeleteBeforeCreation: true,
+			},
+		},
+		{
+			description: "pod hook with default wait condition",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Pod},
+			annotations: map[string]string{Annotation: PreCreate},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Pod},
+				Type:                 PreCreate,
+				WaitFor:              "jsonpath={.status.phase}=Succeeded",
+				WaitTimeout:          DefaultWaitTimeout,
+				DeleteBeforeCreation: true,
+			},
+		},
+		{
+			description: "hook of arbitrary kind with weight",
+			resource:    &resource.Resource{Name: "foo", Kind: "ConfigMap"},
+			annotations: map[string]string{
+				Annotation:       PreUpgrade,
+				WeightAnnotation: "-5",
+			},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: "ConfigMap"},
+				Type:                 PreUpgrade,
+				Weight:               -5,
+				DeleteBeforeCreation: true,
+			},
+		},
+		{
+			description: "invalid weight",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{
+				Annotation:       PreCreate,
+				WeightAnnotation: "first",
+			},
 			expectError: true,
 		},
 		{
@@ -50,9 +107,10 @@ func TestNew(t *testing.T) {
 				WaitForAnnotation: "condition=complete",
 			},
 			expected: &Hook{
-				Resource: &resource.Resource{Name: "foo", Kind: resource.Job},
-				Type:     PreCreate,
-				WaitFor:  "condition=complete",
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                 PreCreate,
+				WaitFor:              "condition=complete",
+				DeleteBeforeCreation: true,
 			},
 		},
 		{
@@ -64,10 +122,11 @@ func TestNew(t *testing.T) {
 				WaitTimeoutAnnotation: "100s",
 			},
 			expected: &Hook{
-				Resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
-				Type:        PreCreate,
-				WaitFor:     "condition=complete",
-				WaitTimeout: 100 * time.Second,
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                 PreCreate,
+				WaitFor:              "condition=complete",
+				WaitTimeout:          100 * time.Second,
+				DeleteBeforeCreation: true,
 			},
 		},
 		{
@@ -85,11 +144,77 @@ func TestNew(t *testing.T) {
 				WaitFor:               "condition=complete",
 				WaitTimeout:           100 * time.Second,
 				DeleteAfterCompletion: true,
+				DeleteBeforeCreation:  true,
 			},
 		},
 		{
-			description: "missing wait-for condition when delete-after-completion policy defined",
+			description: "delete-on-success and keep-on-failure policies",
 			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{
+				Annotation:       PreCreate,
+				PolicyAnnotation: DeleteOnSuccessPolicy + "," + KeepOnFailurePolicy,
+			},
+			expected: &Hook{
+				Resource:              &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                  PreCreate,
+				WaitFor:               "condition=complete",
+				WaitTimeout:           DefaultWaitTimeout,
+				DeleteBeforeCreation:  true,
+				DeleteAfterCompletion: true,
+				KeepOnFailure:         true,
+			},
+		},
+		{
+			description: "ignore-failure policy implies delete-before-creation",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{
+				Annotation:       PreCreate,
+				PolicyAnnotation: IgnoreFailurePolicy,
+			},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                 PreCreate,
+				WaitFor:              "condition=complete",
+				WaitTimeout:          DefaultWaitTimeout,
+				DeleteBeforeCreation: true,
+				IgnoreFailure:        true,
+			},
+		},
+		{
+			description: "delete-before-creation and ignore-failure policies",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Pod},
+			annotations: map[string]string{
+				Annotation:       PostUpgrade,
+				PolicyAnnotation: DeleteBeforeCreationPolicy + "," + IgnoreFailurePolicy,
+			},
+			expected: &Hook{
+				Resource:             &resource.Resource{Name: "foo", Kind: resource.Pod},
+				Type:                 PostUpgrade,
+				WaitFor:              "jsonpath={.status.phase}=Succeeded",
+				WaitTimeout:          DefaultWaitTimeout,
+				DeleteBeforeCreation: true,
+				IgnoreFailure:        true,
+			},
+		},
+		{
+			description: "job hook with delete-after-completion policy uses default wait condition",
+			resource:    &resource.Resource{Name: "foo", Kind: resource.Job},
+			annotations: map[string]string{
+				Annotation:       PreCreate,
+				PolicyAnnotation: DeleteAfterCompletionPolicy,
+			},
+			expected: &Hook{
+				Resource:              &resource.Resource{Name: "foo", Kind: resource.Job},
+				Type:                  PreCreate,
+				WaitFor:               "condition=complete",
+				WaitTimeout:           DefaultWaitTimeout,
+				DeleteBeforeCreation:  true,
+				DeleteAfterCompletion: true,
+			},
+		},
+		{
+			description: "missing wait-for condition when delete-after-completion policy defined",
+			resource:    &resource.Resource{Name: "foo", Kind: "ConfigMap"},
 			annotations: map[string]string{
 				Annotation:       PreCreate,
 				PolicyAnnotation: DeleteAfterCompletionPolicy,
@@ -14,6 +14,23 @@ func (s Slice) Sort() Slice {
 	return sortHooks(s)
 }
 
+// Groups splits the sorted slice into groups of hooks with the same weight.
+// The groups are ordered by weight and are meant to be executed one after
+// another, while the hooks of a group can be executed in parallel.
+func (s Slice) Groups() []Slice {
+	groups := make([]Slice, 0)
+
+	for i, h := range s {
+		if i == 0 || h.Weight != s[i-1].Weight {
+			groups = append(groups, Slice{})
+		}
+
+		groups[len(groups)-1] = append(groups[len(groups)-1], h)
+	}
+
+	return groups
+}
+
 // String implements fmt.Stringer
 func (s Slice) String() string {
 	names := make([]string, len(s))
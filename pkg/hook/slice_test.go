@@ -21,3 +21,21 @@ pre-upgrade/job/baz (wait-for=condition=complete,wait-timeout=10s)`
 
 	assert.Equal(t, expected, s.String())
 }
+
+func TestSlice_Groups(t *testing.T) {
+	s := Slice{
+		{Weight: -1, Resource: &resource.Resource{Kind: resource.Job, Name: "foo"}},
+		{Resource: &resource.Resource{Kind: resource.Pod, Name: "bar"}},
+		{Resource: &resource.Resource{Kind: "ConfigMap", Name: "baz"}},
+		{Weight: 2, Resource: &resource.Resource{Kind: resource.Job, Name: "qux"}},
+	}
+
+	expected := []Slice{
+		{s[0]},
+		{s[1], s[2]},
+		{s[3]},
+	}
+
+	assert.Equal(t, expected, s.Groups())
+	assert.Empty(t, Slice{}.Groups())
+}
@@ -26,6 +26,10 @@ func (s *hookSorter) Swap(i, j int) {
 func (s *hookSorter) Less(i, j int) bool {
 	a, b := s.hooks[i], s.hooks[j]
 
+	if a.Weight != b.Weight {
+		return a.Weight < b.Weight
+	}
+
 	if a.Resource.Name == b.Resource.Name {
 		return a.WaitFor < b.WaitFor
 	}
@@ -12,15 +12,19 @@ var unsorted = SliceMap{
 		{WaitFor: "condition=baz", Resource: &resource.Resource{Kind: resource.Job, Name: "foo"}},
 		{WaitFor: "condition=foo", Resource: &resource.Resource{Kind: resource.Job, Name: "baz"}},
 		{WaitFor: "condition=bar", Resource: &resource.Resource{Kind: resource.Job, Name: "foo"}},
+		{Weight: -1, Resource: &resource.Resource{Kind: resource.Job, Name: "qux"}},
+		{Weight: 1, Resource: &resource.Resource{Kind: resource.Job, Name: "bar"}},
 	},
 }
 
 func TestSlice_Sort(t *testing.T) {
 	expected := SliceMap{
 		PreCreate: Slice{
+			{Weight: -1, Resource: &resource.Resource{Kind: resource.Job, Name: "qux"}},
 			{WaitFor: "condition=foo", Resource: &resource.Resource{Kind: resource.Job, Name: "baz"}},
 			{WaitFor: "condition=bar", Resource: &resource.Resource{Kind: resource.Job, Name: "foo"}},
 			{WaitFor: "condition=baz", Resource: &resource.Resource{Kind: resource.Job, Name: "foo"}},
+			{Weight: 1, Resource: &resource.Resource{Kind: resource.Job, Name: "bar"}},
 		},
 	}
 
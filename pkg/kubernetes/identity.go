@@ -0,0 +1,179 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// IdentityConfigMapName is the name of the ConfigMap holding the cluster
+	// identity marker.
+	IdentityConfigMapName = "kcm-cluster-identity"
+
+	// IdentityConfigMapNamespace is the namespace of the ConfigMap holding
+	// the cluster identity marker.
+	IdentityConfigMapNamespace = "kube-system"
+
+	identityMarkerKey = "marker"
+)
+
+// ClusterIdentity describes the expected identity of a cluster. All
+// non-empty fields are verified.
+type ClusterIdentity struct {
+	// Server is the expected URL of the API server.
+	Server string `json:"server,omitempty" yaml:"server,omitempty"`
+
+	// KubeSystemUID is the expected UID of the kube-system namespace, which
+	// is unique per cluster.
+	KubeSystemUID string `json:"kubeSystemUID,omitempty" yaml:"kubeSystemUID,omitempty"`
+
+	// Marker is the expected value of the marker in the kcm-cluster-identity
+	// ConfigMap in the kube-system namespace.
+	Marker string `json:"marker,omitempty" yaml:"marker,omitempty"`
+}
+
+// Empty returns true if no identity is configured.
+func (i *ClusterIdentity) Empty() bool {
+	return *i == ClusterIdentity{}
+}
+
+// VerifyClusterIdentity verifies that the cluster matches the identity. If
+// createMarker is true and the marker ConfigMap does not exist yet, it is
+// created, but only if the API server or the kube-system namespace UID is
+// configured and matches. Otherwise a missing marker is treated as a
+// mismatch, as the marker alone cannot tell the right cluster from the wrong
+// one on the first apply.
+func (k *Kubectl) VerifyClusterIdentity(ctx context.Context, identity *ClusterIdentity, createMarker bool) error {
+	if identity.Server != "" {
+		server, err := k.ServerURL(ctx)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSuffix(server, "/") != strings.TrimSuffix(identity.Server, "/") {
+			return errors.Errorf("cluster identity mismatch: expected API server %q, got %q", identity.Server, server)
+		}
+	}
+
+	if identity.KubeSystemUID != "" {
+		uid, err := k.NamespaceUID(ctx, IdentityConfigMapNamespace)
+		if err != nil {
+			return err
+		}
+
+		if uid != identity.KubeSystemUID {
+			return errors.Errorf("cluster identity mismatch: expected kube-system namespace UID %q, got %q", identity.KubeSystemUID, uid)
+		}
+	}
+
+	if identity.Marker == "" {
+		return nil
+	}
+
+	marker, found, err := k.ConfigMapValue(ctx, IdentityConfigMapNamespace, IdentityConfigMapName, identityMarkerKey)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case found && marker != identity.Marker:
+		return errors.Errorf("cluster identity mismatch: expected marker %q, got %q", identity.Marker, marker)
+	case found:
+		return nil
+	case !createMarker:
+		return errors.Errorf(
+			"cluster identity mismatch: marker ConfigMap %s/%s not found",
+			IdentityConfigMapNamespace,
+			IdentityConfigMapName,
+		)
+	case identity.Server == "" && identity.KubeSystemUID == "":
+		return errors.Errorf(
+			"cluster identity mismatch: marker ConfigMap %s/%s not found, it is only created if the API server or kube-system namespace UID is configured and matches",
+			IdentityConfigMapNamespace,
+			IdentityConfigMapName,
+		)
+	}
+
+	log.Infof("writing cluster identity marker %q", identity.Marker)
+
+	manifest, err := identityConfigMap(identity.Marker)
+	if err != nil {
+		return err
+	}
+
+	return k.ApplyManifest(ctx, manifest)
+}
+
+// ServerURL returns the URL of the API server of the selected cluster.
+func (k *Kubectl) ServerURL(ctx context.Context) (string, error) {
+	out, err := k.get(ctx, "config", "view", "--minify", "--output", "jsonpath={.clusters[0].cluster.server}")
+
+	return strings.TrimSpace(out), err
+}
+
+// NamespaceUID returns the UID of given namespace.
+func (k *Kubectl) NamespaceUID(ctx context.Context, namespace string) (string, error) {
+	out, err := k.get(ctx, "get", "namespace", namespace, "--output", "jsonpath={.metadata.uid}")
+
+	return strings.TrimSpace(out), err
+}
+
+// ConfigMapValue returns the value of key in a ConfigMap. The second return
+// value is false if the ConfigMap or the key do not exist.
+func (k *Kubectl) ConfigMapValue(ctx context.Context, namespace, name, key string) (string, bool, error) {
+	out, err := k.get(ctx, "get", "configmap", name, "--namespace", namespace, "--ignore-not-found", "--output", "json")
+	if err != nil || strings.TrimSpace(out) == "" {
+		return "", false, err
+	}
+
+	var configMap struct {
+		Data map[string]string `json:"data"`
+	}
+
+	if err := json.Unmarshal([]byte(out), &configMap); err != nil {
+		return "", false, errors.Wrapf(err, "failed to parse ConfigMap %s/%s", namespace, name)
+	}
+
+	value, ok := configMap.Data[key]
+
+	return value, ok, nil
+}
+
+// get runs a kubectl command that only reads data and returns its output.
+func (k *Kubectl) get(ctx context.Context, args ...string) (string, error) {
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return "", err
+	}
+
+	args = append(args, credentialArgs...)
+
+	cmd := exec.Command("kubectl", args...)
+
+	return command.RunSilentlyWithContext(ctx, cmd)
+}
+
+func identityConfigMap(marker string) ([]byte, error) {
+	configMap := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      IdentityConfigMapName,
+			"namespace": IdentityConfigMapNamespace,
+		},
+		"data": map[string]string{
+			identityMarkerKey: marker,
+		},
+	}
+
+	buf, err := yaml.Marshal(configMap)
+
+	return buf, errors.WithStack(err)
+}
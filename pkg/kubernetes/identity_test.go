@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyClusterIdentity(t *testing.T) {
+	cases := []struct {
+		name         string
+		identity     ClusterIdentity
+		createMarker bool
+		setup        func(commandtest.MockExecutor)
+		expectError  bool
+	}{
+		{
+			name:     "matching server and uid",
+			identity: ClusterIdentity{Server: "https://localhost:6443/", KubeSystemUID: "abc"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl config view --minify --output jsonpath=.* --context test").WillReturn("https://localhost:6443")
+				executor.ExpectCommand("kubectl get namespace kube-system --output jsonpath=.* --context test").WillReturn("abc")
+			},
+		},
+		{
+			name:     "server mismatch",
+			identity: ClusterIdentity{Server: "https://prod:6443", KubeSystemUID: "abc"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl config view --minify --output jsonpath=.* --context test").WillReturn("https://staging:6443")
+			},
+			expectError: true,
+		},
+		{
+			name:     "uid mismatch",
+			identity: ClusterIdentity{KubeSystemUID: "abc"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get namespace kube-system --output jsonpath=.* --context test").WillReturn("def")
+			},
+			expectError: true,
+		},
+		{
+			name:     "matching marker",
+			identity: ClusterIdentity{Marker: "prod"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get configmap kcm-cluster-identity --namespace kube-system --ignore-not-found --output json --context test").
+					WillReturn(`{"data":{"marker":"prod"}}`)
+			},
+		},
+		{
+			name:     "marker mismatch",
+			identity: ClusterIdentity{Marker: "prod"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get configmap kcm-cluster-identity .*").
+					WillReturn(`{"data":{"marker":"staging"}}`)
+			},
+			createMarker: true,
+			expectError:  true,
+		},
+		{
+			name:     "missing marker is created",
+			identity: ClusterIdentity{KubeSystemUID: "abc", Marker: "prod"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get namespace kube-system --output jsonpath=.* --context test").WillReturn("abc")
+				executor.ExpectCommand("kubectl get configmap kcm-cluster-identity .*")
+				executor.ExpectCommand("kubectl apply -f - --context test")
+			},
+			createMarker: true,
+		},
+		{
+			name:     "missing marker is not created without server or uid",
+			identity: ClusterIdentity{Marker: "prod"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get configmap kcm-cluster-identity .*")
+			},
+			createMarker: true,
+			expectError:  true,
+		},
+		{
+			name:     "missing marker",
+			identity: ClusterIdentity{Marker: "prod"},
+			setup: func(executor commandtest.MockExecutor) {
+				executor.ExpectCommand("kubectl get configmap kcm-cluster-identity .*")
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+				kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+				tc.setup(executor)
+
+				err := kubectl.VerifyClusterIdentity(context.Background(), &tc.identity, tc.createMarker)
+				if tc.expectError {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+
+				assert.NoError(t, executor.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestIdentityConfigMap(t *testing.T) {
+	buf, err := identityConfigMap("prod: cluster")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+data:
+  marker: 'prod: cluster'
+kind: ConfigMap
+metadata:
+  name: kcm-cluster-identity
+  namespace: kube-system
+`, string(buf))
+}
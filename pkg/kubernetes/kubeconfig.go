@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WriteTempKubeconfig writes a self-contained kubeconfig for the cluster
+// selected by the credentials of k to a temporary location and returns its
+// filename. If the credentials refer to a kubeconfig, the selected context
+// is flattened into the file and pinned as its current context, so that
+// other tools using the file talk to the same cluster as k. The caller is
+// responsible for removing the file once it is not needed anymore.
+func (k *Kubectl) WriteTempKubeconfig(ctx context.Context) (string, error) {
+	if k.credentials.HasInlineConfig() {
+		return credentials.WriteTempKubeconfig(k.credentials)
+	}
+
+	out, err := k.get(ctx, "config", "view", "--minify", "--flatten", "--output", "yaml")
+	if err != nil {
+		return "", err
+	}
+
+	var config map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(out), &config); err != nil {
+		return "", errors.Wrap(err, "failed to parse kubeconfig")
+	}
+
+	if k.credentials.Context != "" {
+		config["current-context"] = k.credentials.Context
+	}
+
+	buf, err := yaml.Marshal(config)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return credentials.WriteTempKubeconfigContent(buf)
+}
@@ -0,0 +1,53 @@
+package kubernetes
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubectl_WriteTempKubeconfig(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Kubeconfig: "/tmp/kubeconfig", Context: "prod"})
+
+		executor.ExpectCommand("kubectl config view --minify --flatten --output yaml --context prod --kubeconfig /tmp/kubeconfig").
+			WillReturn(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod:6443
+current-context: staging
+`)
+
+		filename, err := kubectl.WriteTempKubeconfig(context.Background())
+		require.NoError(t, err)
+		defer os.Remove(filename)
+
+		buf, err := ioutil.ReadFile(filename)
+		require.NoError(t, err)
+
+		assert.Contains(t, string(buf), "current-context: prod")
+		assert.Contains(t, string(buf), "server: https://prod:6443")
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestKubectl_WriteTempKubeconfigInlineConfig(t *testing.T) {
+	kubectl := NewKubectl(&credentials.Credentials{Server: "https://localhost:6443", Token: "mytoken"})
+
+	filename, err := kubectl.WriteTempKubeconfig(context.Background())
+	require.NoError(t, err)
+	defer os.Remove(filename)
+
+	buf, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(buf), "token: mytoken")
+}
@@ -3,14 +3,17 @@ package kubernetes
 import (
 	"bytes"
 	"context"
+	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/cenkalti/backoff"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -20,6 +23,10 @@ const (
 	// DefaultNamespace is the namespace that should be used where namespace is
 	// omitted.
 	DefaultNamespace = "default"
+
+	// immutableFieldPattern matches the messages of errors that are caused
+	// by changes to immutable fields.
+	immutableFieldPattern = `field is immutable|updates to statefulset spec for fields other than`
 )
 
 var (
@@ -28,15 +35,41 @@ var (
 
 	// permanentErrorRegexp is used to detect errors that are not fixable by
 	// just retrying. If we hit one of those errors, we can abort early.
-	permanentErrorRegexp = regexp.MustCompile(`(ValidationError|no matches for kind|the server doesn't have a resource type)`)
+	permanentErrorRegexp = regexp.MustCompile(`(ValidationError|no matches for kind|the server doesn't have a resource type|admission webhook .* denied the request|` + immutableFieldPattern + `)`)
+
+	// dryRunPermanentErrorRegexp matches errors that are permanent in
+	// server-side dry runs only, e.g. missing permissions. In real applies
+	// forbidden errors may be transient, e.g. when a quota is exceeded or a
+	// namespace is being terminated.
+	dryRunPermanentErrorRegexp = regexp.MustCompile(`forbidden`)
+
+	// namespaceNotFoundRegexp matches errors caused by a missing namespace
+	// and captures its name. In server-side dry runs these errors are
+	// permanent, since namespaces created in a dry run are never persisted.
+	namespaceNotFoundRegexp = regexp.MustCompile(`namespaces "([^"]+)" not found`)
+
+	// immutableFieldErrorRegexp matches errors about changed immutable
+	// fields and captures the kind and name of the affected resource. The
+	// kind may be qualified with its API group (e.g. `Job.batch`).
+	immutableFieldErrorRegexp = regexp.MustCompile(`\b([A-Z]\w*)(?:\.[\w.-]+)? "([^"]+)" is invalid: .*(` + immutableFieldPattern + `)`)
+
+	// objectNamespaceRegexp matches the name and namespace of the object
+	// that kubectl apply reports before the error when patching it fails.
+	objectNamespaceRegexp = regexp.MustCompile(`Name: "([^"]+)", Namespace: "([^"]*)"`)
 )
 
 // Kubectl defines a type for interacting with kubectl.
 type Kubectl struct {
 	credentials *credentials.Credentials
+
+	// tempKubeconfig is the kubeconfig file that is generated if the
+	// credentials contain a server and token. It is removed by Close.
+	tempKubeconfig string
+	mu             sync.Mutex
 }
 
-// NewKubectl create a new kubectl interactor.
+// NewKubectl create a new kubectl interactor. Close must be called once the
+// interactor is not needed anymore to clean up temporary files.
 func NewKubectl(c *credentials.Credentials) *Kubectl {
 	return &Kubectl{
 		credentials: c,
@@ -45,22 +78,44 @@ func NewKubectl(c *credentials.Credentials) *Kubectl {
 
 // ApplyManifest applies the manifest via kubectl.
 func (k *Kubectl) ApplyManifest(ctx context.Context, manifest []byte) error {
-	args := []string{
-		"kubectl",
-		"apply",
-		"-f",
-		"-",
+	return k.runManifestCommand(ctx, manifest, handlePermanentErrors, "apply", "-f", "-")
+}
+
+// ApplyManifestDryRun sends the manifest to the API server using a
+// server-side dry run of kubectl apply. This runs admission webhooks, schema
+// validation and authorization without persisting anything.
+func (k *Kubectl) ApplyManifestDryRun(ctx context.Context, manifest []byte) error {
+	return k.runManifestCommand(ctx, manifest, handleDryRunPermanentErrors, "apply", "-f", "-", "--dry-run=server")
+}
+
+// DeleteManifest deletes the manifest via kubectl.
+func (k *Kubectl) DeleteManifest(ctx context.Context, manifest []byte) error {
+	return k.runManifestCommand(ctx, manifest, handlePermanentErrors, "delete", "-f", "-", "--ignore-not-found")
+}
+
+// DeleteManifestDryRun sends the manifest to the API server using a
+// server-side dry run of kubectl delete.
+func (k *Kubectl) DeleteManifestDryRun(ctx context.Context, manifest []byte) error {
+	return k.runManifestCommand(ctx, manifest, handleDryRunPermanentErrors, "delete", "-f", "-", "--ignore-not-found", "--dry-run=server")
+}
+
+// runManifestCommand runs kubectl with args and passes manifest via stdin.
+// Failed commands are retried unless handleErr marks the error as permanent.
+func (k *Kubectl) runManifestCommand(ctx context.Context, manifest []byte, handleErr func(error) error, args ...string) error {
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return err
 	}
 
-	args = append(args, k.buildCredentialArgs()...)
+	args = append(args, credentialArgs...)
 
-	err := backoff.Retry(
+	err = backoff.Retry(
 		func() error {
-			cmd := exec.Command(args[0], args[1:]...)
+			cmd := exec.Command("kubectl", args...)
 			cmd.Stdin = bytes.NewBuffer(manifest)
 			_, err := command.RunWithContext(ctx, cmd)
 
-			return handlePermanentErrors(err)
+			return handleErr(err)
 		},
 		backoff.WithContext(backoffStrategy, ctx),
 	)
@@ -68,22 +123,33 @@ func (k *Kubectl) ApplyManifest(ctx context.Context, manifest []byte) error {
 	return err
 }
 
-// DeleteManifest deletes the manifest via kubectl.
-func (k *Kubectl) DeleteManifest(ctx context.Context, manifest []byte) error {
+// DeleteResource deletes a resource by its kind, name and namespace.
+func (k *Kubectl) DeleteResource(ctx context.Context, selector resource.Head) error {
+	namespace := selector.Metadata.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
 	args := []string{
 		"kubectl",
 		"delete",
-		"-f",
-		"-",
+		resourceType(selector),
+		selector.Metadata.Name,
+		"--namespace",
+		namespace,
 		"--ignore-not-found",
 	}
 
-	args = append(args, k.buildCredentialArgs()...)
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return err
+	}
 
-	err := backoff.Retry(
+	args = append(args, credentialArgs...)
+
+	err = backoff.Retry(
 		func() error {
 			cmd := exec.Command(args[0], args[1:]...)
-			cmd.Stdin = bytes.NewBuffer(manifest)
 			_, err := command.RunWithContext(ctx, cmd)
 
 			return handlePermanentErrors(err)
@@ -94,8 +160,9 @@ func (k *Kubectl) DeleteManifest(ctx context.Context, manifest []byte) error {
 	return err
 }
 
-// DeleteResource deletes a resource by its kind, name and namespace.
-func (k *Kubectl) DeleteResource(ctx context.Context, selector resource.Head) error {
+// RemoveLabels removes the labels with given keys from the resource
+// identified by selector.
+func (k *Kubectl) RemoveLabels(ctx context.Context, selector resource.Head, keys ...string) error {
 	namespace := selector.Metadata.Namespace
 	if namespace == "" {
 		namespace = DefaultNamespace
@@ -103,29 +170,44 @@ func (k *Kubectl) DeleteResource(ctx context.Context, selector resource.Head) er
 
 	args := []string{
 		"kubectl",
-		"delete",
-		strings.ToLower(selector.Kind),
+		"label",
+		resourceType(selector),
 		selector.Metadata.Name,
 		"--namespace",
 		namespace,
-		"--ignore-not-found",
 	}
 
-	args = append(args, k.buildCredentialArgs()...)
+	for _, key := range keys {
+		args = append(args, key+"-")
+	}
 
-	err := backoff.Retry(
-		func() error {
-			cmd := exec.Command(args[0], args[1:]...)
-			_, err := command.RunWithContext(ctx, cmd)
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return err
+	}
 
-			return handlePermanentErrors(err)
-		},
-		backoff.WithContext(backoffStrategy, ctx),
-	)
+	args = append(args, credentialArgs...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+
+	_, err = command.RunWithContext(ctx, cmd)
 
 	return err
 }
 
+// resourceType returns the resource type of selector in the form understood
+// by kubectl, e.g. "ingress.networking.k8s.io". The group is omitted for
+// resources of the core API group or if it is unknown.
+func resourceType(selector resource.Head) string {
+	kind := strings.ToLower(selector.Kind)
+
+	if group := resource.Group(selector.APIVersion); group != "" {
+		return kind + "." + group
+	}
+
+	return kind
+}
+
 // ClusterInfo fetches the kubernetes cluster info.
 func (k *Kubectl) ClusterInfo(ctx context.Context) (string, error) {
 	args := []string{
@@ -133,32 +215,141 @@ func (k *Kubectl) ClusterInfo(ctx context.Context) (string, error) {
 		"cluster-info",
 	}
 
-	args = append(args, k.buildCredentialArgs()...)
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return "", err
+	}
+
+	args = append(args, credentialArgs...)
 
 	cmd := exec.Command(args[0], args[1:]...)
 
 	return command.RunSilentlyWithContext(ctx, cmd)
 }
 
-// buildCredentialArgs builds kubectl args from credentials.
-func (k *Kubectl) buildCredentialArgs() (args []string) {
-	if k.credentials.Context != "" {
-		args = append(args, "--context", k.credentials.Context)
+// RefreshDiscovery invalidates kubectl's discovery cache so that subsequent
+// commands see API types that were added by CustomResourceDefinitions or
+// APIServices.
+func (k *Kubectl) RefreshDiscovery(ctx context.Context) error {
+	_, err := k.get(ctx, "api-resources", "--cached=false", "--output", "name")
+
+	return err
+}
+
+// Close removes the temporary kubeconfig file if one was created.
+func (k *Kubectl) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.tempKubeconfig == "" {
+		return nil
+	}
+
+	err := os.Remove(k.tempKubeconfig)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	k.tempKubeconfig = ""
+
+	return nil
+}
+
+// buildCredentialArgs builds kubectl args from credentials. Inline cluster
+// config like server and token is never passed as args as it would be
+// visible in the process list. Instead, a temporary kubeconfig is generated
+// from it.
+func (k *Kubectl) buildCredentialArgs() ([]string, error) {
+	c := k.credentials
+	args := make([]string, 0)
+
+	if !c.HasInlineConfig() {
+		if c.Context != "" {
+			args = append(args, "--context", c.Context)
+		}
+
+		if c.Kubeconfig != "" {
+			args = append(args, "--kubeconfig", c.Kubeconfig)
+		}
+
+		return args, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.tempKubeconfig == "" {
+		filename, err := credentials.WriteTempKubeconfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		k.tempKubeconfig = filename
+	}
+
+	return append(args, "--kubeconfig", k.tempKubeconfig), nil
+}
+
+// ImmutableFieldErrors returns the heads of all resources that failed to be
+// updated because immutable fields changed. The namespace of a resource is
+// only set if the error message contains it.
+func ImmutableFieldErrors(err error) []resource.Head {
+	if err == nil {
+		return nil
 	}
 
-	if k.credentials.Kubeconfig != "" {
-		args = append(args, "--kubeconfig", k.credentials.Kubeconfig)
-	} else {
-		if k.credentials.Server != "" {
-			args = append(args, "--server", k.credentials.Server)
+	msg := err.Error()
+
+	matches := immutableFieldErrorRegexp.FindAllStringSubmatchIndex(msg, -1)
+
+	heads := make([]resource.Head, len(matches))
+
+	offset := 0
+
+	for i, match := range matches {
+		name := msg[match[4]:match[5]]
+
+		heads[i] = resource.Head{
+			Kind: msg[match[2]:match[3]],
+			Metadata: resource.Metadata{
+				Name:      name,
+				Namespace: findObjectNamespace(msg[offset:match[0]], name),
+			},
 		}
 
-		if k.credentials.Token != "" {
-			args = append(args, "--token", k.credentials.Token)
+		offset = match[1]
+	}
+
+	return heads
+}
+
+// findObjectNamespace returns the namespace of the last object with name
+// that is mentioned in msg. Returns an empty string if there is none.
+func findObjectNamespace(msg, name string) string {
+	var namespace string
+
+	for _, match := range objectNamespaceRegexp.FindAllStringSubmatch(msg, -1) {
+		if match[1] == name {
+			namespace = match[2]
 		}
 	}
 
-	return args
+	return namespace
+}
+
+// MissingNamespace returns the name of the namespace if err was caused by
+// a missing namespace. Returns an empty string otherwise.
+func MissingNamespace(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	match := namespaceNotFoundRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
 }
 
 // handlePermanentErrors will wrap errors that are considered permanent with a
@@ -173,3 +364,18 @@ func handlePermanentErrors(err error) error {
 		return err
 	}
 }
+
+// handleDryRunPermanentErrors behaves like handlePermanentErrors, but also
+// considers errors about missing namespaces and forbidden requests as
+// permanent.
+func handleDryRunPermanentErrors(err error) error {
+	if MissingNamespace(err) != "" {
+		return backoff.Permanent(err)
+	}
+
+	if err != nil && dryRunPermanentErrorRegexp.MatchString(err.Error()) {
+		return backoff.Permanent(err)
+	}
+
+	return handlePermanentErrors(err)
+}
@@ -3,12 +3,15 @@ package kubernetes
 import (
 	"context"
 	"errors"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestApplyManifest(t *testing.T) {
@@ -20,10 +23,47 @@ func TestApplyManifest(t *testing.T) {
 
 		kubectl := NewKubectl(creds)
 
-		executor.ExpectCommand("kubectl apply -f - --server https://localhost:6443 --token sometoken")
+		executor.ExpectCommand("kubectl apply -f - --kubeconfig .*kubeconfig.*")
 
 		assert.NoError(t, kubectl.ApplyManifest(context.Background(), []byte{}))
 		assert.NoError(t, executor.ExpectationsWereMet())
+		assert.NoError(t, kubectl.Close())
+	})
+}
+
+func TestTempKubeconfig(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		creds := &credentials.Credentials{
+			Server: "https://localhost:6443",
+			Token:  "sometoken",
+		}
+
+		kubectl := NewKubectl(creds)
+
+		executor.ExpectCommand("kubectl cluster-info --kubeconfig .*")
+		executor.ExpectCommand("kubectl cluster-info --kubeconfig .*")
+
+		_, err := kubectl.ClusterInfo(context.Background())
+		require.NoError(t, err)
+
+		filename := kubectl.tempKubeconfig
+		require.NotEmpty(t, filename)
+
+		_, err = kubectl.ClusterInfo(context.Background())
+		require.NoError(t, err)
+
+		// the temporary kubeconfig is reused for subsequent commands
+		assert.Equal(t, filename, kubectl.tempKubeconfig)
+
+		buf, err := ioutil.ReadFile(filename)
+		require.NoError(t, err)
+		assert.Contains(t, string(buf), "token: sometoken")
+
+		require.NoError(t, kubectl.Close())
+
+		_, err = os.Stat(filename)
+		assert.True(t, os.IsNotExist(err))
+		assert.NoError(t, executor.ExpectationsWereMet())
 	})
 }
 
@@ -66,6 +106,45 @@ func TestDeleteResource(t *testing.T) {
 	})
 }
 
+func TestDeleteResourceWithAPIGroup(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Kubeconfig: "/tmp/kubeconfig"})
+
+		executor.ExpectCommand("kubectl delete ingress.networking.k8s.io foo --namespace bar --ignore-not-found --kubeconfig /tmp/kubeconfig")
+
+		res := resource.Head{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "Ingress",
+			Metadata: resource.Metadata{
+				Name:      "foo",
+				Namespace: "bar",
+			},
+		}
+
+		assert.NoError(t, kubectl.DeleteResource(context.Background(), res))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestRemoveLabels(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl label customresourcedefinition.apiextensions.k8s.io foo --namespace default kcm/instance- kcm/component- --context test")
+
+		res := resource.Head{
+			APIVersion: "apiextensions.k8s.io/v1",
+			Kind:       resource.CustomResourceDefinition,
+			Metadata: resource.Metadata{
+				Name: "foo",
+			},
+		}
+
+		assert.NoError(t, kubectl.RemoveLabels(context.Background(), res, resource.InstanceLabel, resource.ComponentLabel))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
 func TestValidationErrors(t *testing.T) {
 	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
 		kubectl := NewKubectl(&credentials.Credentials{})
@@ -102,3 +181,115 @@ func TestClusterInfo(t *testing.T) {
 		assert.NoError(t, executor.ExpectationsWereMet())
 	})
 }
+
+func TestRefreshDiscovery(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		creds := &credentials.Credentials{
+			Kubeconfig: "/tmp/kubeconfig",
+			Context:    "test",
+		}
+
+		kubectl := NewKubectl(creds)
+
+		executor.ExpectCommand("kubectl api-resources --cached=false --output name --context test --kubeconfig /tmp/kubeconfig")
+
+		assert.NoError(t, kubectl.RefreshDiscovery(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestImmutableFieldErrors(t *testing.T) {
+	err := errors.New(`command failed with output: service/foo unchanged
+The Job "pi" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable
+The StatefulSet "web" is invalid: spec: Forbidden: updates to statefulset spec for fields other than 'replicas', 'template', and 'updateStrategy' are forbidden`)
+
+	expected := []resource.Head{
+		{Kind: "Job", Metadata: resource.Metadata{Name: "pi"}},
+		{Kind: "StatefulSet", Metadata: resource.Metadata{Name: "web"}},
+	}
+
+	assert.Equal(t, expected, ImmutableFieldErrors(err))
+	assert.Empty(t, ImmutableFieldErrors(errors.New("connection refused")))
+	assert.Empty(t, ImmutableFieldErrors(nil))
+}
+
+func TestImmutableFieldErrorsWithNamespace(t *testing.T) {
+	err := errors.New(`command failed with output: Error from server (Invalid): error when applying patch:
+{"spec":{"template":{}}}
+to:
+Resource: "batch/v1, Resource=jobs", GroupVersionKind: "batch/v1, Kind=Job"
+Name: "pi", Namespace: "foo"
+for: "STDIN": Job.batch "pi" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable
+Error from server (Invalid): error when applying patch:
+{"spec":{"template":{}}}
+to:
+Resource: "batch/v1, Resource=jobs", GroupVersionKind: "batch/v1, Kind=Job"
+Name: "pi", Namespace: "bar"
+for: "STDIN": Job.batch "pi" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable`)
+
+	expected := []resource.Head{
+		{Kind: "Job", Metadata: resource.Metadata{Name: "pi", Namespace: "foo"}},
+		{Kind: "Job", Metadata: resource.Metadata{Name: "pi", Namespace: "bar"}},
+	}
+
+	assert.Equal(t, expected, ImmutableFieldErrors(err))
+	assert.Empty(t, ImmutableFieldErrors(nil))
+}
+
+func TestMissingNamespace(t *testing.T) {
+	assert.Equal(t, "foo", MissingNamespace(errors.New(`Error from server (NotFound): error when creating "STDIN": namespaces "foo" not found`)))
+	assert.Equal(t, "", MissingNamespace(errors.New(`configmaps "foo" not found`)))
+	assert.Equal(t, "", MissingNamespace(nil))
+}
+
+func TestApplyManifestDryRunMissingNamespaceIsPermanent(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{})
+
+		// only one attempt is expected, there are no retries
+		executor.ExpectCommand("kubectl apply -f - --dry-run=server").
+			WillReturnError(errors.New(`namespaces "foo" not found`))
+
+		assert.Error(t, kubectl.ApplyManifestDryRun(context.Background(), []byte{}))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestApplyManifestDryRunForbiddenErrorIsPermanent(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{})
+
+		// only one attempt is expected, there are no retries
+		executor.ExpectCommand("kubectl apply -f - --dry-run=server").
+			WillReturnError(errors.New(`Error from server (Forbidden): configmaps "foo" is forbidden: User "bar" cannot patch resource "configmaps"`))
+
+		assert.Error(t, kubectl.ApplyManifestDryRun(context.Background(), []byte{}))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestApplyManifestRetriesForbiddenErrors(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{})
+
+		executor.ExpectCommand("kubectl apply -f -").
+			WillReturnError(errors.New(`Error from server (Forbidden): pods "foo" is forbidden: exceeded quota: compute-resources`))
+		executor.ExpectCommand("kubectl apply -f -")
+
+		assert.NoError(t, kubectl.ApplyManifest(context.Background(), []byte{}))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestApplyManifestImmutableFieldErrorIsPermanent(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{})
+
+		// only one attempt is expected, there are no retries
+		executor.ExpectCommand("kubectl apply -f -").
+			WillReturnError(errors.New(`The Job "pi" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable`))
+
+		assert.Error(t, kubectl.ApplyManifest(context.Background(), []byte{}))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
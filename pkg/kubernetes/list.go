@@ -0,0 +1,137 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListOwnedResources returns all resources of the cluster that are owned by
+// the kcm instance of o. Only resource types that support the list and delete
+// verbs are considered. Resource types that cannot be listed, e.g. because
+// access is forbidden or their aggregated API is unavailable, are skipped
+// with a warning. The returned resources do not have any content.
+//
+// Controllers copy labels onto the objects they create, e.g. the labels of a
+// Service onto its Endpoints. Therefore only resources that carry the
+// revision annotation and do not have owner references are considered as
+// owned by kcm.
+func (k *Kubectl) ListOwnedResources(ctx context.Context, o resource.Ownership) (resource.Slice, error) {
+	out, err := k.get(ctx, "api-resources", "--verbs=list,delete", "--output", "name")
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make(resource.Slice, 0)
+
+	// Resources that are served by multiple API groups (e.g. events) are
+	// listed once per group.
+	seen := make(map[string]bool)
+
+	for _, resourceType := range strings.Fields(out) {
+		items, err := k.listItems(ctx, resourceType, o.Selector())
+		if err != nil {
+			log.Warnf("skipping resource type %s: %s", resourceType, err.Error())
+			continue
+		}
+
+		for _, item := range items {
+			if item.Metadata.UID != "" && seen[item.Metadata.UID] {
+				continue
+			}
+
+			seen[item.Metadata.UID] = true
+
+			if len(item.Metadata.OwnerReferences) > 0 {
+				continue
+			}
+
+			if _, ok := item.Metadata.Annotations[resource.RevisionAnnotation]; !ok {
+				continue
+			}
+
+			resources = append(resources, &resource.Resource{
+				APIVersion: item.APIVersion,
+				Kind:       item.Kind,
+				Name:       item.Metadata.Name,
+				Namespace:  item.Metadata.Namespace,
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+// ClusterScopedKinds returns the kinds of all resource types served by the
+// cluster that are not namespaced. This includes the kinds of aggregated APIs
+// and custom resources.
+func (k *Kubectl) ClusterScopedKinds(ctx context.Context) ([]string, error) {
+	out, err := k.get(ctx, "api-resources", "--namespaced=false", "--no-headers")
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make([]string, 0)
+
+	// The kind is always the last column, the columns before it differ
+	// between kubectl versions.
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		kinds = append(kinds, fields[len(fields)-1])
+	}
+
+	return kinds, nil
+}
+
+type listItem struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             string            `json:"uid"`
+		Annotations     map[string]string `json:"annotations"`
+		OwnerReferences []interface{}     `json:"ownerReferences"`
+	} `json:"metadata"`
+}
+
+// listItems lists all objects of resourceType in all namespaces that match
+// selector.
+func (k *Kubectl) listItems(ctx context.Context, resourceType, selector string) ([]listItem, error) {
+	out, err := k.get(
+		ctx,
+		"get",
+		resourceType,
+		"--all-namespaces",
+		"--selector",
+		selector,
+		"--ignore-not-found",
+		"--output",
+		"json",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return nil, nil
+	}
+
+	var list struct {
+		Items []listItem `json:"items"`
+	}
+
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, errors.Wrap(err, "failed to parse resource list")
+	}
+
+	return list.Items, nil
+}
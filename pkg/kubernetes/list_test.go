@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListOwnedResources(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl api-resources --verbs=list,delete --output name --context test").
+			WillReturn("configmaps\nevents\nevents.events.k8s.io\ndeployments.apps\nendpoints\nmetrics.example.com\n")
+		executor.ExpectCommand("kubectl get configmaps --all-namespaces --selector kcm/instance=prod --ignore-not-found --output json --context test").
+			WillReturn(`{"items":[
+  {"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"foo","namespace":"bar","uid":"1","annotations":{"kcm/revision":"abc"}}}
+]}`)
+		executor.ExpectCommand("kubectl get events --all-namespaces .*").
+			WillReturn(`{"items":[
+  {"apiVersion":"v1","kind":"Event","metadata":{"name":"baz","namespace":"bar","uid":"2","annotations":{"kcm/revision":"abc"}}}
+]}`)
+		executor.ExpectCommand("kubectl get events.events.k8s.io --all-namespaces .*").
+			WillReturn(`{"items":[
+  {"apiVersion":"events.k8s.io/v1","kind":"Event","metadata":{"name":"baz","namespace":"bar","uid":"2","annotations":{"kcm/revision":"abc"}}}
+]}`)
+		executor.ExpectCommand("kubectl get deployments.apps --all-namespaces .*").
+			WillReturn(`{"items":[
+  {"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"qux","namespace":"bar","uid":"3","annotations":{"kcm/revision":"abc"}}},
+  {"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"owned","namespace":"bar","uid":"4","annotations":{"kcm/revision":"abc"},"ownerReferences":[{"kind":"Foo","name":"foo"}]}}
+]}`)
+		executor.ExpectCommand("kubectl get endpoints --all-namespaces .*").
+			WillReturn(`{"items":[
+  {"apiVersion":"v1","kind":"Endpoints","metadata":{"name":"my-service","namespace":"bar","uid":"5","labels":{"kcm/instance":"prod"}}}
+]}`)
+		executor.ExpectCommand("kubectl get metrics.example.com --all-namespaces .*").
+			WillReturnError(errors.New("the server is currently unable to handle the request"))
+
+		resources, err := kubectl.ListOwnedResources(context.Background(), resource.Ownership{InstanceID: "prod"})
+		require.NoError(t, err)
+
+		expected := resource.Slice{
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "foo", Namespace: "bar"},
+			{APIVersion: "v1", Kind: "Event", Name: "baz", Namespace: "bar"},
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "qux", Namespace: "bar"},
+		}
+
+		assert.Equal(t, expected, resources)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestListOwnedResourcesEmpty(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl api-resources --verbs=list,delete --output name --context test").WillReturn("configmaps\n")
+		executor.ExpectCommand("kubectl get configmaps --all-namespaces .*")
+
+		resources, err := kubectl.ListOwnedResources(context.Background(), resource.Ownership{InstanceID: "prod"})
+		require.NoError(t, err)
+		assert.Empty(t, resources)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestClusterScopedKinds(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl api-resources --namespaced=false --no-headers --context test").
+			WillReturn(`namespaces        ns     v1                       false   Namespace
+nodes             no     v1                       false   Node
+clusterissuers           cert-manager.io/v1       false   ClusterIssuer
+`)
+
+		kinds, err := kubectl.ClusterScopedKinds(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Namespace", "Node", "ClusterIssuer"}, kinds)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
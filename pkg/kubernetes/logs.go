@@ -0,0 +1,33 @@
+package kubernetes
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+)
+
+// LogTailLines is the maximum number of log lines per container that are
+// fetched by Logs.
+const LogTailLines = 100
+
+// Logs returns the most recent logs of all containers of the pod described
+// by selector. If selector describes a workload resource like a Job, kubectl
+// picks one of its pods.
+func (k *Kubectl) Logs(ctx context.Context, selector resource.Head) (string, error) {
+	namespace := selector.Metadata.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	return k.get(
+		ctx,
+		"logs",
+		resourceType(selector)+"/"+selector.Metadata.Name,
+		"--namespace",
+		namespace,
+		"--all-containers=true",
+		"--tail",
+		strconv.Itoa(LogTailLines),
+	)
+}
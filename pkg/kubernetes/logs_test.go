@@ -0,0 +1,33 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogs(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{})
+
+		executor.ExpectCommand("kubectl logs job.batch/migrate --namespace kube-system --all-containers=true --tail 100").
+			WillReturn("migration failed\n")
+
+		head := resource.Head{
+			APIVersion: "batch/v1",
+			Kind:       resource.Job,
+			Metadata:   resource.Metadata{Name: "migrate", Namespace: "kube-system"},
+		}
+
+		out, err := kubectl.Logs(context.Background(), head)
+
+		require.NoError(t, err)
+		assert.Equal(t, "migration failed\n", out)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
@@ -2,8 +2,10 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -21,6 +23,10 @@ var (
 		backoff.NewConstantBackOff(pollingTimeout),
 		maxPollingRetries,
 	)
+
+	// jobPollInterval is the interval in which WaitForJob polls the status
+	// of a Job.
+	jobPollInterval = 2 * time.Second
 )
 
 // WaitOptions are passed to kubectl when waiting for a wait condition to be
@@ -54,11 +60,124 @@ func (k *Kubectl) Wait(ctx context.Context, o WaitOptions) error {
 		args = append(args, "--timeout", fmt.Sprintf("%ds", int64(o.Timeout.Seconds())))
 	}
 
-	args = append(args, k.buildCredentialArgs()...)
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return err
+	}
+
+	args = append(args, credentialArgs...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+
+	_, err = command.RunWithContext(ctx, cmd)
+
+	return err
+}
+
+// WaitForJob waits until the Job described by o completed. In contrast to
+// Wait, it returns as soon as the Job failed instead of waiting until the
+// timeout expired. The For field of o is ignored.
+func (k *Kubectl) WaitForJob(ctx context.Context, o WaitOptions) error {
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	job := "job.batch/" + o.Name
+
+	err := backoff.Retry(
+		func() error {
+			out, err := k.get(ctx, "get", job, "--namespace", namespace, "--output", "json")
+			if err != nil {
+				return err
+			}
+
+			var v struct {
+				Status struct {
+					Conditions []struct {
+						Type    string `json:"type"`
+						Status  string `json:"status"`
+						Message string `json:"message"`
+					} `json:"conditions"`
+				} `json:"status"`
+			}
+
+			if err := json.Unmarshal([]byte(out), &v); err != nil {
+				return backoff.Permanent(errors.Wrapf(err, "failed to parse status of %s", job))
+			}
+
+			for _, c := range v.Status.Conditions {
+				if c.Status != "True" {
+					continue
+				}
+
+				switch c.Type {
+				case "Complete":
+					return nil
+				case "Failed":
+					return backoff.Permanent(errors.Errorf("%s failed: %s", job, c.Message))
+				}
+			}
+
+			return errors.Errorf("%s did not complete yet", job)
+		},
+		backoff.WithContext(backoff.NewConstantBackOff(jobPollInterval), ctx),
+	)
+
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("timed out waiting for %s to complete after %s", job, o.Timeout)
+	}
+
+	return err
+}
+
+// RolloutStatusOptions are passed to kubectl when waiting for the rollout of
+// a workload resource to complete.
+type RolloutStatusOptions struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Timeout   time.Duration
+}
+
+// RolloutStatus waits until the rollout of the workload resource described by
+// the RolloutStatusOptions completed.
+func (k *Kubectl) RolloutStatus(ctx context.Context, o RolloutStatusOptions) error {
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	args := []string{
+		"kubectl",
+		"rollout",
+		"status",
+		"--namespace",
+		namespace,
+		fmt.Sprintf("%s/%s", strings.ToLower(o.Kind), o.Name),
+	}
+
+	if o.Timeout > 0 {
+		args = append(args, "--timeout", fmt.Sprintf("%ds", int64(o.Timeout.Seconds())))
+	}
+
+	credentialArgs, err := k.buildCredentialArgs()
+	if err != nil {
+		return err
+	}
+
+	args = append(args, credentialArgs...)
 
 	cmd := exec.Command(args[0], args[1:]...)
 
-	_, err := command.RunWithContext(ctx, cmd)
+	_, err = command.RunWithContext(ctx, cmd)
 
 	return err
 }
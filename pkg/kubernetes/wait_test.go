@@ -8,6 +8,7 @@ import (
 	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/credentials"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWait(t *testing.T) {
@@ -33,3 +34,60 @@ func TestWait(t *testing.T) {
 		assert.NoError(t, executor.ExpectationsWereMet())
 	})
 }
+
+func TestWaitForJob(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		executor.ExpectCommand("kubectl get job.batch/foo --namespace bar --output json --context test").
+			WillReturn(`{"status":{"active":1}}`)
+		executor.ExpectCommand("kubectl get job.batch/foo --namespace bar --output json --context test").
+			WillReturn(`{"status":{"conditions":[{"type":"Complete","status":"True"}]}}`)
+
+		opts := WaitOptions{Name: "foo", Namespace: "bar", Timeout: time.Minute}
+
+		assert.NoError(t, kubectl.WaitForJob(context.Background(), opts))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestWaitForJobFailed(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		kubectl := NewKubectl(&credentials.Credentials{Context: "test"})
+
+		// only one attempt is expected, failed jobs are not polled again
+		executor.ExpectCommand("kubectl get job.batch/foo --namespace default --output json --context test").
+			WillReturn(`{"status":{"conditions":[{"type":"Failed","status":"True","message":"Job has reached the specified backoff limit"}]}}`)
+
+		err := kubectl.WaitForJob(context.Background(), WaitOptions{Name: "foo", Timeout: time.Hour})
+
+		require.Error(t, err)
+		assert.Equal(t, "job.batch/foo failed: Job has reached the specified backoff limit", err.Error())
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestRolloutStatus(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		creds := &credentials.Credentials{
+			Kubeconfig: "/tmp/kubeconfig",
+			Context:    "test",
+		}
+
+		kubectl := NewKubectl(creds)
+
+		executor.ExpectCommand("kubectl rollout status --namespace default deployment/foo --timeout 300s --context test --kubeconfig /tmp/kubeconfig")
+
+		opts := RolloutStatusOptions{
+			Kind:    "Deployment",
+			Name:    "foo",
+			Timeout: 5 * time.Minute,
+		}
+
+		assert.NoError(t, kubectl.RolloutStatus(context.Background(), opts))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
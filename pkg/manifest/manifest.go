@@ -7,12 +7,25 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/hook"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/template"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DisabledExt is the extension of files that disable the component of
+	// the same name in a templates search path.
+	DisabledExt = ".disabled"
+
+	// ComponentMetadataFilename is the name of the optional file in a
+	// component dir that contains metadata about the component.
+	ComponentMetadataFilename = "component.yaml"
 )
 
 // Manifest contains a kubernetes manifest split into resources and hooks.
@@ -21,6 +34,10 @@ type Manifest struct {
 	Resources resource.Slice
 	Hooks     hook.SliceMap
 
+	// Source is the directory the manifest was rendered from. It is empty
+	// for manifests read from the manifests dir.
+	Source string
+
 	content []byte
 }
 
@@ -84,6 +101,18 @@ func (m *Manifest) Content() []byte {
 	return m.content
 }
 
+// AllResources returns the resources of m and the resources of its hooks.
+func (m *Manifest) AllResources() resource.Slice {
+	resources := make(resource.Slice, 0, len(m.Resources))
+	resources = append(resources, m.Resources...)
+
+	for _, hooks := range m.Hooks {
+		resources = append(resources, hooks.Resources()...)
+	}
+
+	return resources
+}
+
 // ReadDir reads dir and returns all found manifests. It will ignore
 // subdirectories.
 func ReadDir(dir string) ([]*Manifest, error) {
@@ -127,24 +156,44 @@ func ReadDir(dir string) ([]*Manifest, error) {
 	return manifests, nil
 }
 
-// RenderDir renders manifests for all subdirectories of dir.
+// RenderDir renders manifests for all subdirectories of dir. Components that
+// are disabled via `components.<name>.enabled: false` in v are skipped and
+// thus treated as if they did not exist.
 func RenderDir(r template.Renderer, dir string, v map[string]interface{}) ([]*Manifest, error) {
-	dirs, err := ioutil.ReadDir(dir)
+	return RenderDirs(r, []string{dir}, v)
+}
+
+// RenderDirs renders manifests for the components found in the search paths
+// dirs. See ResolveComponentDirs for how components are resolved. Components
+// that are disabled via `components.<name>.enabled: false` in v are skipped
+// and thus treated as if they did not exist.
+func RenderDirs(r template.Renderer, dirs []string, v map[string]interface{}) ([]*Manifest, error) {
+	components, err := ResolveComponentDirs(dirs)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to open component dir")
+		return nil, err
 	}
 
+	return RenderComponentDirs(r, components, v)
+}
+
+// RenderComponentDirs renders manifests for components. Components that are
+// disabled via `components.<name>.enabled: false` in v are skipped and thus
+// treated as if they did not exist.
+func RenderComponentDirs(r template.Renderer, components []ComponentDir, v map[string]interface{}) ([]*Manifest, error) {
 	manifests := make([]*Manifest, 0)
 
-	for _, d := range dirs {
-		if !d.IsDir() {
-			continue
+	for _, c := range components {
+		enabled, err := ComponentEnabled(v, c.Name)
+		if err != nil {
+			return nil, err
 		}
 
-		name := d.Name()
-		dirPath := filepath.Join(dir, name)
+		if !enabled {
+			log.Infof("skipping disabled component %s", c.Name)
+			continue
+		}
 
-		renderedTemplates, err := r.Render(dirPath, v)
+		renderedTemplates, err := r.Render(c.Dir, v)
 		if err != nil {
 			return nil, err
 		}
@@ -163,17 +212,119 @@ func RenderDir(r template.Renderer, dir string, v map[string]interface{}) ([]*Ma
 			buf.Write([]byte(content))
 		}
 
-		manifest, err := New(name, buf.Bytes())
+		manifest, err := New(c.Name, buf.Bytes())
 		if err != nil {
 			return nil, err
 		}
 
+		manifest.Source = c.Dir
+
 		manifests = append(manifests, manifest)
 	}
 
 	return manifests, nil
 }
 
+// ComponentDir is the directory a component is rendered from.
+type ComponentDir struct {
+	Name string
+	Dir  string
+}
+
+// ComponentMetadata contains metadata about a component.
+type ComponentMetadata struct {
+	// Labels are matched against component selectors.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Metadata reads the metadata of the component from the
+// ComponentMetadataFilename file in its dir. Returns empty metadata if the
+// file does not exist.
+func (c ComponentDir) Metadata() (*ComponentMetadata, error) {
+	var m ComponentMetadata
+
+	if err := file.ReadYAML(filepath.Join(c.Dir, ComponentMetadataFilename), &m); err != nil {
+		return nil, errors.Wrapf(err, "failed to read metadata of component %s", c.Name)
+	}
+
+	return &m, nil
+}
+
+// ResolveComponentDirs resolves the components found in the search paths
+// dirs. Each subdirectory of a search path is a component. Later search paths
+// take precedence over earlier ones: they can add components, replace
+// components of the same name or disable them via a file named
+// `<name>.disabled`. The result is sorted by component name.
+func ResolveComponentDirs(dirs []string) ([]ComponentDir, error) {
+	resolved := make(map[string]string)
+
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open component dir")
+		}
+
+		for _, e := range entries {
+			if e.IsDir() {
+				resolved[e.Name()] = filepath.Join(dir, e.Name())
+				continue
+			}
+
+			if filepath.Ext(e.Name()) == DisabledExt {
+				delete(resolved, strings.TrimSuffix(e.Name(), DisabledExt))
+			}
+		}
+	}
+
+	components := make([]ComponentDir, 0, len(resolved))
+	for name, dir := range resolved {
+		components = append(components, ComponentDir{Name: name, Dir: dir})
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	return components, nil
+}
+
+// ComponentEnabled returns false if the component with name is disabled via
+// `components.<name>.enabled: false` in v. Components are enabled unless
+// explicitly disabled. Returns an error if the value is not a boolean.
+func ComponentEnabled(v map[string]interface{}, name string) (bool, error) {
+	component, ok := lookup(v["components"], name)
+	if !ok {
+		return true, nil
+	}
+
+	value, ok := lookup(component, "enabled")
+	if !ok || value == nil {
+		return true, nil
+	}
+
+	enabled, ok := value.(bool)
+	if !ok {
+		return false, errors.Errorf("components.%s.enabled must be a boolean, got %T", name, value)
+	}
+
+	return enabled, nil
+}
+
+// lookup returns the value of key in v if v is a map. Values parsed from
+// yaml may contain maps of either type.
+func lookup(v interface{}, key string) (interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		value, ok := m[key]
+		return value, ok
+	case map[interface{}]interface{}:
+		value, ok := m[key]
+		return value, ok
+	default:
+		return nil, false
+	}
+}
+
 // FindMatching finds a manifest in a haystack. Matching is done by name.
 func FindMatching(haystack []*Manifest, needle *Manifest) (*Manifest, bool) {
 	for _, m := range haystack {
@@ -260,6 +260,157 @@ func TestRenderDir(t *testing.T) {
 	assert.Equal(t, "two", manifests[1].Name)
 }
 
+func TestRenderDirs(t *testing.T) {
+	r := &testRenderer{}
+
+	manifests, err := RenderDirs(r, []string{"testdata/components", "testdata/overlay"}, nil)
+
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+	assert.Equal(t, "three", manifests[0].Name)
+	assert.Equal(t, filepath.Join("testdata", "overlay", "three"), manifests[0].Source)
+	assert.Equal(t, "two", manifests[1].Name)
+	assert.Equal(t, filepath.Join("testdata", "overlay", "two"), manifests[1].Source)
+}
+
+func TestComponentDir_Metadata(t *testing.T) {
+	metadata, err := ComponentDir{Name: "three", Dir: "testdata/overlay/three"}.Metadata()
+
+	require.NoError(t, err)
+	assert.Equal(t, &ComponentMetadata{Labels: map[string]string{"tier": "infra"}}, metadata)
+
+	metadata, err = ComponentDir{Name: "one", Dir: "testdata/components/one"}.Metadata()
+
+	require.NoError(t, err)
+	assert.Equal(t, &ComponentMetadata{}, metadata)
+}
+
+func TestResolveComponentDirs(t *testing.T) {
+	tests := []struct {
+		name        string
+		dirs        []string
+		expected    []ComponentDir
+		expectedErr string
+	}{
+		{
+			name: "single search path",
+			dirs: []string{"testdata/components"},
+			expected: []ComponentDir{
+				{Name: "one", Dir: filepath.Join("testdata", "components", "one")},
+				{Name: "two", Dir: filepath.Join("testdata", "components", "two")},
+			},
+		},
+		{
+			name: "overlay adds, replaces and disables components",
+			dirs: []string{"testdata/components", "testdata/overlay"},
+			expected: []ComponentDir{
+				{Name: "three", Dir: filepath.Join("testdata", "overlay", "three")},
+				{Name: "two", Dir: filepath.Join("testdata", "overlay", "two")},
+			},
+		},
+		{
+			name: "order of search paths matters",
+			dirs: []string{"testdata/overlay", "testdata/components"},
+			expected: []ComponentDir{
+				{Name: "one", Dir: filepath.Join("testdata", "components", "one")},
+				{Name: "three", Dir: filepath.Join("testdata", "overlay", "three")},
+				{Name: "two", Dir: filepath.Join("testdata", "components", "two")},
+			},
+		},
+		{
+			name:        "nonexistent search path",
+			dirs:        []string{"testdata/components", "testdata/nonexistent"},
+			expectedErr: "failed to open component dir",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			components, err := ResolveComponentDirs(test.dirs)
+
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, components)
+		})
+	}
+}
+
+func TestRenderDirSkipsDisabledComponents(t *testing.T) {
+	r := &testRenderer{}
+
+	v := map[string]interface{}{
+		"components": map[interface{}]interface{}{
+			"one": map[interface{}]interface{}{"enabled": false},
+			"two": map[interface{}]interface{}{"enabled": true},
+		},
+	}
+
+	manifests, err := RenderDir(r, "testdata/components", v)
+
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, "two", manifests[0].Name)
+}
+
+func TestComponentEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      map[string]interface{}
+		expected    bool
+		expectedErr string
+	}{
+		{
+			name:     "no values",
+			expected: true,
+		},
+		{
+			name:     "no component values",
+			values:   map[string]interface{}{"components": map[string]interface{}{"bar": nil}},
+			expected: true,
+		},
+		{
+			name:     "enabled not set",
+			values:   map[string]interface{}{"components": map[string]interface{}{"foo": map[string]interface{}{"replicas": 2}}},
+			expected: true,
+		},
+		{
+			name:     "disabled",
+			values:   map[string]interface{}{"components": map[string]interface{}{"foo": map[string]interface{}{"enabled": false}}},
+			expected: false,
+		},
+		{
+			name:     "disabled in yaml map",
+			values:   map[string]interface{}{"components": map[interface{}]interface{}{"foo": map[interface{}]interface{}{"enabled": false}}},
+			expected: false,
+		},
+		{
+			name:        "not a boolean",
+			values:      map[string]interface{}{"components": map[string]interface{}{"foo": map[string]interface{}{"enabled": "no"}}},
+			expectedErr: "components.foo.enabled must be a boolean, got string",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enabled, err := ComponentEnabled(test.values, "foo")
+
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, enabled)
+		})
+	}
+}
+
 func TestFindMatching(t *testing.T) {
 	manifests := []*Manifest{
 		{Name: "foo"},
@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+)
+
+// SetDefaultNamespace sets namespace on all namespaced resources and hooks of
+// m that do not specify a namespace. Kinds are considered cluster-scoped if
+// they are contained in resource.ClusterScopedKinds or clusterScopedKinds or
+// if they are defined by a CustomResourceDefinition with cluster scope in m.
+func (m *Manifest) SetDefaultNamespace(namespace string, clusterScopedKinds []string) error {
+	if namespace == "" {
+		return nil
+	}
+
+	scoped, err := m.clusterScopedKinds(clusterScopedKinds)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range m.AllResources() {
+		if r.Namespace != "" || scoped[r.Kind] {
+			continue
+		}
+
+		if err := r.SetNamespace(namespace); err != nil {
+			return err
+		}
+	}
+
+	// Resource contents changed, the cached content needs to be rebuilt.
+	m.content = nil
+
+	return nil
+}
+
+// CheckNamespaces returns an error if any namespaced resource or hook of m
+// targets a namespace that is not contained in allowed. Resources without
+// namespace are rejected as well, since it is unknown where they will end up.
+// This is a no-op if allowed is empty.
+func (m *Manifest) CheckNamespaces(allowed []string, clusterScopedKinds []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	scoped, err := m.clusterScopedKinds(clusterScopedKinds)
+	if err != nil {
+		return err
+	}
+
+	allowedNamespaces := make(map[string]bool)
+	for _, namespace := range allowed {
+		allowedNamespaces[namespace] = true
+	}
+
+	for _, r := range m.AllResources() {
+		switch {
+		case scoped[r.Kind]:
+			continue
+		case r.Namespace == "":
+			return errors.Errorf("resource %s of component %s does not specify a namespace", r, m.Name)
+		case !allowedNamespaces[r.Namespace]:
+			return errors.Errorf("resource %s of component %s targets namespace %q which is not allowed", r, m.Name, r.Namespace)
+		}
+	}
+
+	return nil
+}
+
+// clusterScopedKinds returns a set of the kinds that are cluster-scoped.
+func (m *Manifest) clusterScopedKinds(extra []string) (map[string]bool, error) {
+	scoped := make(map[string]bool)
+
+	for _, kind := range resource.ClusterScopedKinds {
+		scoped[kind] = true
+	}
+
+	for _, kind := range extra {
+		scoped[kind] = true
+	}
+
+	for _, r := range m.Resources {
+		kind, scope, err := r.CustomResourceScope()
+		if err != nil {
+			return nil, err
+		}
+
+		if kind != "" && scope == "Cluster" {
+			scoped[kind] = true
+		}
+	}
+
+	return scoped, nil
+}
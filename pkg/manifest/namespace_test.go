@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var namespaceTestManifest = []byte(`---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterissuers.cert-manager.io
+spec:
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+---
+apiVersion: cert-manager.io/v1
+kind: ClusterIssuer
+metadata:
+  name: letsencrypt
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: bar
+  namespace: kube-system
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    kcm/hook: pre-create
+`)
+
+func TestManifest_SetDefaultNamespace(t *testing.T) {
+	m, err := New("foo", namespaceTestManifest)
+	require.NoError(t, err)
+
+	require.NoError(t, m.SetDefaultNamespace("cert-manager", nil))
+
+	namespaces := make(map[string]string)
+	for _, r := range m.AllResources() {
+		namespaces[r.Kind] = r.Namespace
+	}
+
+	expected := map[string]string{
+		"CustomResourceDefinition": "",
+		"ClusterIssuer":            "",
+		"ConfigMap":                "cert-manager",
+		"Secret":                   "kube-system",
+		"Job":                      "cert-manager",
+	}
+
+	assert.Equal(t, expected, namespaces)
+	assert.Contains(t, string(m.Content()), "namespace: cert-manager")
+}
+
+func TestManifest_CheckNamespaces(t *testing.T) {
+	cases := []struct {
+		name               string
+		namespace          string
+		allowed            []string
+		clusterScopedKinds []string
+		expectedErr        string
+	}{
+		{
+			name: "no allowlist",
+		},
+		{
+			name:        "missing namespace",
+			allowed:     []string{"kube-system"},
+			expectedErr: "resource configmap/foo of component foo does not specify a namespace",
+		},
+		{
+			name:        "namespace not allowed",
+			namespace:   "cert-manager",
+			allowed:     []string{"cert-manager"},
+			expectedErr: `resource kube-system/secret/bar of component foo targets namespace "kube-system" which is not allowed`,
+		},
+		{
+			name:      "all namespaces allowed",
+			namespace: "cert-manager",
+			allowed:   []string{"cert-manager", "kube-system"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := New("foo", namespaceTestManifest)
+			require.NoError(t, err)
+
+			require.NoError(t, m.SetDefaultNamespace(tc.namespace, tc.clusterScopedKinds))
+
+			err = m.CheckNamespaces(tc.allowed, tc.clusterScopedKinds)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErr, err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestManifest_SetDefaultNamespaceExtraClusterScopedKinds(t *testing.T) {
+	m, err := New("foo", []byte(`---
+apiVersion: example.com/v1
+kind: GlobalThing
+metadata:
+  name: foo
+`))
+	require.NoError(t, err)
+
+	require.NoError(t, m.SetDefaultNamespace("bar", []string{"GlobalThing"}))
+
+	assert.Equal(t, "", m.Resources[0].Namespace)
+}
@@ -87,8 +87,9 @@ spec: {}
 `),
 			expectedResources: resource.Slice{
 				{
-					Name: "cm",
-					Kind: "ConfigMap",
+					Name:       "cm",
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
 					Content: []byte(`apiVersion: v1
 data: {}
 kind: ConfigMap
@@ -97,8 +98,9 @@ metadata:
 `),
 				},
 				{
-					Name: "pod",
-					Kind: "Pod",
+					Name:       "pod",
+					APIVersion: "v1",
+					Kind:       "Pod",
 					Content: []byte(`apiVersion: v1
 kind: Pod
 metadata:
@@ -107,8 +109,9 @@ spec: {}
 `),
 				},
 				{
-					Name: "alertmanager",
-					Kind: "Alertmanager",
+					Name:       "alertmanager",
+					APIVersion: "v1",
+					Kind:       "Alertmanager",
 					Content: []byte(`apiVersion: v1
 kind: Alertmanager
 metadata:
@@ -117,8 +120,9 @@ spec: {}
 `),
 				},
 				{
-					Name: "another-prometheus",
-					Kind: "Prometheus",
+					Name:       "another-prometheus",
+					APIVersion: "v1",
+					Kind:       "Prometheus",
 					Content: []byte(`apiVersion: v1
 kind: Prometheus
 metadata:
@@ -127,8 +131,9 @@ spec: {}
 `),
 				},
 				{
-					Name: "prometheus",
-					Kind: "Prometheus",
+					Name:       "prometheus",
+					APIVersion: "v1",
+					Kind:       "Prometheus",
 					Content: []byte(`apiVersion: v1
 kind: Prometheus
 metadata:
@@ -156,8 +161,9 @@ spec: {}
 `),
 			expectedResources: resource.Slice{
 				{
-					Name: "some-statefulset",
-					Kind: "StatefulSet",
+					Name:       "some-statefulset",
+					APIVersion: "v1",
+					Kind:       "StatefulSet",
 					Content: []byte(`apiVersion: v1
 kind: StatefulSet
 metadata:
@@ -173,13 +179,14 @@ spec: {}
 			expectedHooks: hook.SliceMap{},
 		},
 		{
-			description: "unsupported hook resource kind",
+			description: "invalid hook weight",
 			buf: []byte(`
 apiVersion: v1
-kind: StatefulSet
+kind: Job
 metadata:
   annotations:
     kcm/hook: pre-delete
+    kcm/hook-weight: foo
   labels:
     app.kubernetes.io/instance: kcm
     app.kubernetes.io/name: chart
@@ -221,8 +228,9 @@ spec: {}
 				hook.PreDelete: hook.Slice{
 					{
 						Resource: &resource.Resource{
-							Name: "deletion-job",
-							Kind: "Job",
+							Name:       "deletion-job",
+							APIVersion: "v1",
+							Kind:       "Job",
 							Content: []byte(`apiVersion: v1
 kind: Job
 metadata:
@@ -236,12 +244,16 @@ metadata:
 spec: {}
 `),
 						},
-						Type: hook.PreDelete,
+						Type:                 hook.PreDelete,
+						WaitFor:              "condition=complete",
+						WaitTimeout:          hook.DefaultWaitTimeout,
+						DeleteBeforeCreation: true,
 					},
 					{
 						Resource: &resource.Resource{
-							Name: "deletion-job2",
-							Kind: "Job",
+							Name:       "deletion-job2",
+							APIVersion: "v1",
+							Kind:       "Job",
 							Content: []byte(`apiVersion: v1
 kind: Job
 metadata:
@@ -255,7 +267,10 @@ metadata:
 spec: {}
 `),
 						},
-						Type: hook.PreDelete,
+						Type:                 hook.PreDelete,
+						WaitFor:              "condition=complete",
+						WaitTimeout:          hook.DefaultWaitTimeout,
+						DeleteBeforeCreation: true,
 					},
 				},
 			},
@@ -0,0 +1,287 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Chain is a provisioner that runs multiple provisioners one after another,
+// e.g. to provision a network stack before the cluster itself. Every stage
+// has its own provisioner and working dir. The outputs of earlier stages
+// that a stage declares as inputs are passed to it if it implements
+// Inputter. Destroy runs the stages in reverse order.
+type Chain struct {
+	options []StageOptions
+	stages  []*chainStage
+}
+
+// chainStage is a single stage of a Chain.
+type chainStage struct {
+	name        string
+	inputs      []string
+	provisioner Provisioner
+}
+
+// NewChain creates a new Chain provisioner from the stages configured in o.
+func NewChain(o *Options) Provisioner {
+	return &Chain{
+		options: o.Stages,
+	}
+}
+
+// Provision implements Provision from the Provisioner interface. After a
+// stage was provisioned, its outputs are collected and passed to the
+// following stages.
+func (c *Chain) Provision(ctx context.Context) error {
+	stages, err := c.getStages()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+
+	for _, s := range stages {
+		log.Infof("provisioning stage %s", s.name)
+
+		err := s.run(values, func(p Provisioner) error {
+			return p.Provision(ctx)
+		})
+
+		if err != nil {
+			return errors.Wrapf(err, "provisioning stage %s failed", s.name)
+		}
+
+		if err := s.mergeOutput(ctx, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reconcile implements Reconciler. Stages that do not implement Reconciler
+// are skipped.
+func (c *Chain) Reconcile(ctx context.Context) error {
+	stages, err := c.getStages()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+
+	for _, s := range stages {
+		err := s.run(values, func(p Provisioner) error {
+			r, ok := p.(Reconciler)
+			if !ok {
+				return nil
+			}
+
+			log.Infof("reconciling stage %s", s.name)
+
+			return r.Reconcile(ctx)
+		})
+
+		if err != nil {
+			return errors.Wrapf(err, "reconciling stage %s failed", s.name)
+		}
+
+		if err := s.mergeOutput(ctx, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Output implements Outputter. The outputs of all stages are merged, values
+// of later stages take precedence.
+func (c *Chain) Output(ctx context.Context) (map[string]interface{}, error) {
+	stages, err := c.getStages()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+
+	for _, s := range stages {
+		if err := s.mergeOutput(ctx, values); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// Destroy implements Destroy from the Provisioner interface. The outputs of
+// all stages are collected first so that every stage receives the same inputs
+// as during provisioning. Afterwards the stages are destroyed in reverse
+// order.
+func (c *Chain) Destroy(ctx context.Context) error {
+	stages, err := c.getStages()
+	if err != nil {
+		return err
+	}
+
+	inputs := make([]map[string]interface{}, len(stages))
+	values := make(map[string]interface{})
+
+	for i, s := range stages {
+		inputs[i] = copyValues(values)
+
+		if err := s.mergeOutput(ctx, values); err != nil {
+			return err
+		}
+	}
+
+	for i := len(stages) - 1; i >= 0; i-- {
+		s := stages[i]
+
+		log.Infof("destroying stage %s", s.name)
+
+		err := s.run(inputs[i], func(p Provisioner) error {
+			return p.Destroy(ctx)
+		})
+
+		if err != nil {
+			return errors.Wrapf(err, "destroying stage %s failed", s.name)
+		}
+	}
+
+	return nil
+}
+
+// getStages lazily creates the provisioners for all configured stages.
+func (c *Chain) getStages() ([]*chainStage, error) {
+	if c.stages != nil {
+		return c.stages, nil
+	}
+
+	if len(c.options) == 0 {
+		return nil, errors.New("chain provisioner requires at least one stage")
+	}
+
+	stages := make([]*chainStage, len(c.options))
+
+	for i, o := range c.options {
+		name := o.Name
+		if name == "" {
+			name = fmt.Sprintf("%d-%s", i, o.Provisioner)
+		}
+
+		p, err := Create(o.Provisioner, &o.Options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create provisioner for stage %s", name)
+		}
+
+		if err := setWorkingDir(p, o.WorkingDir); err != nil {
+			return nil, errors.Wrapf(err, "failed to set working dir of stage %s", name)
+		}
+
+		stages[i] = &chainStage{
+			name:        name,
+			inputs:      o.Inputs,
+			provisioner: p,
+		}
+	}
+
+	c.stages = stages
+
+	return stages, nil
+}
+
+// setWorkingDir sets the working dir of p to dir. Relative dirs are resolved
+// against the working dir of the current process. Returns an error if dir is
+// set but p does not implement WorkingDirSetter.
+func setWorkingDir(p Provisioner, dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	s, ok := p.(WorkingDirSetter)
+	if !ok {
+		return errors.Errorf("provisioner %T does not support a working dir", p)
+	}
+
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return err
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.SetWorkingDir(dir)
+
+	return nil
+}
+
+// run calls f with the stage provisioner. If the provisioner implements
+// Inputter, the values the stage declares as inputs are passed to it
+// beforehand.
+func (s *chainStage) run(values map[string]interface{}, f func(Provisioner) error) error {
+	if i, ok := s.provisioner.(Inputter); ok {
+		if err := i.SetInputs(s.selectInputs(values)); err != nil {
+			return errors.Wrapf(err, "failed to pass inputs to stage %s", s.name)
+		}
+	}
+
+	return f(s.provisioner)
+}
+
+// selectInputs returns the values the stage declares as inputs. Inputs that
+// are not present in values are skipped with a warning, e.g. because the
+// stage that outputs them was not provisioned yet.
+func (s *chainStage) selectInputs(values map[string]interface{}) map[string]interface{} {
+	inputs := make(map[string]interface{}, len(s.inputs))
+
+	for _, name := range s.inputs {
+		value, ok := values[name]
+		if !ok {
+			log.Warnf("input %s of stage %s is not an output of any earlier stage", name, s.name)
+			continue
+		}
+
+		inputs[name] = value
+	}
+
+	return inputs
+}
+
+// mergeOutput merges the output of the stage's provisioner into values if it
+// implements Outputter. The provisioner receives the current values as inputs.
+func (s *chainStage) mergeOutput(ctx context.Context, values map[string]interface{}) error {
+	o, ok := s.provisioner.(Outputter)
+	if !ok {
+		return nil
+	}
+
+	return s.run(values, func(Provisioner) error {
+		v, err := o.Output(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch output of stage %s", s.name)
+		}
+
+		for key, value := range v {
+			values[key] = value
+		}
+
+		return nil
+	})
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+
+	for k, v := range values {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,211 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStageProvisioner struct {
+	name     string
+	calls    *[]string
+	outputs  map[string]interface{}
+	inputs   map[string]interface{}
+	err      error
+	inputErr error
+}
+
+func (p *testStageProvisioner) Provision(ctx context.Context) error {
+	*p.calls = append(*p.calls, "provision "+p.name)
+	return p.err
+}
+
+func (p *testStageProvisioner) Reconcile(ctx context.Context) error {
+	*p.calls = append(*p.calls, "reconcile "+p.name)
+	return p.err
+}
+
+func (p *testStageProvisioner) Destroy(ctx context.Context) error {
+	*p.calls = append(*p.calls, "destroy "+p.name)
+	return p.err
+}
+
+func (p *testStageProvisioner) Output(ctx context.Context) (map[string]interface{}, error) {
+	return p.outputs, nil
+}
+
+func (p *testStageProvisioner) SetInputs(inputs map[string]interface{}) error {
+	p.inputs = inputs
+	return p.inputErr
+}
+
+func newTestChain(calls *[]string) (*Chain, *testStageProvisioner, *testStageProvisioner, *testStageProvisioner) {
+	network := &testStageProvisioner{name: "network", calls: calls, outputs: map[string]interface{}{"vpc_id": "vpc-123"}}
+	eks := &testStageProvisioner{name: "eks", calls: calls, outputs: map[string]interface{}{"kubeconfig": "/tmp/kubeconfig", "vpc_id": "vpc-456"}}
+	nodes := &testStageProvisioner{name: "nodes", calls: calls}
+
+	c := &Chain{
+		stages: []*chainStage{
+			{name: "network", provisioner: network},
+			{name: "eks", provisioner: eks, inputs: []string{"vpc_id"}},
+			{name: "nodes", provisioner: nodes, inputs: []string{"vpc_id", "subnet_ids"}},
+		},
+	}
+
+	return c, network, eks, nodes
+}
+
+func TestChainProvision(t *testing.T) {
+	var calls []string
+
+	c, network, eks, nodes := newTestChain(&calls)
+
+	require.NoError(t, c.Provision(context.Background()))
+
+	assert.Equal(t, []string{"provision network", "provision eks", "provision nodes"}, calls)
+	assert.Equal(t, map[string]interface{}{}, network.inputs)
+	assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-123"}, eks.inputs)
+	assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-456"}, nodes.inputs)
+}
+
+func TestChainProvisionInputError(t *testing.T) {
+	var calls []string
+
+	c, _, eks, _ := newTestChain(&calls)
+
+	eks.inputErr = errors.New("whoops")
+
+	err := c.Provision(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to pass inputs to stage eks")
+	assert.Equal(t, []string{"provision network"}, calls)
+}
+
+func TestChainProvisionError(t *testing.T) {
+	var calls []string
+
+	c, _, eks, _ := newTestChain(&calls)
+
+	eks.err = errors.New("whoops")
+
+	require.Error(t, c.Provision(context.Background()))
+
+	assert.Equal(t, []string{"provision network", "provision eks"}, calls)
+}
+
+func TestChainReconcile(t *testing.T) {
+	var calls []string
+
+	c, _, _, _ := newTestChain(&calls)
+
+	require.NoError(t, c.Reconcile(context.Background()))
+
+	assert.Equal(t, []string{"reconcile network", "reconcile eks", "reconcile nodes"}, calls)
+}
+
+func TestChainOutput(t *testing.T) {
+	var calls []string
+
+	c, _, _, _ := newTestChain(&calls)
+
+	values, err := c.Output(context.Background())
+
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"kubeconfig": "/tmp/kubeconfig",
+		"vpc_id":     "vpc-456",
+	}
+
+	assert.Equal(t, expected, values)
+	assert.Empty(t, calls)
+}
+
+func TestChainDestroy(t *testing.T) {
+	var calls []string
+
+	c, network, eks, nodes := newTestChain(&calls)
+
+	require.NoError(t, c.Destroy(context.Background()))
+
+	assert.Equal(t, []string{"destroy nodes", "destroy eks", "destroy network"}, calls)
+	assert.Equal(t, map[string]interface{}{}, network.inputs)
+	assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-123"}, eks.inputs)
+	assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-456"}, nodes.inputs)
+}
+
+func TestChainStages(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		dir, err := ioutil.TempDir("", "chain")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "network"), 0755))
+
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+
+		c := NewChain(&Options{
+			Stages: []StageOptions{
+				{Name: "network", Provisioner: "terraform", WorkingDir: filepath.Join(dir, "network")},
+				{Provisioner: "null"},
+			},
+		})
+
+		executor.ExpectCommand("terraform apply --auto-approve")
+		executor.ExpectCommand("terraform output --json").WillReturn(`{"vpc_id":{"value":"vpc-123"}}`)
+
+		require.NoError(t, c.Provision(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+
+		cwd, err := os.Getwd()
+		require.NoError(t, err)
+		assert.Equal(t, wd, cwd)
+
+		stages, err := c.(*Chain).getStages()
+		require.NoError(t, err)
+
+		cmd := stages[0].provisioner.(*Terraform).command("plan")
+		assert.Equal(t, filepath.Join(dir, "network"), cmd.Dir)
+	})
+}
+
+func TestChainStagesError(t *testing.T) {
+	cases := []struct {
+		name    string
+		options *Options
+	}{
+		{
+			name:    "no stages",
+			options: &Options{},
+		},
+		{
+			name: "invalid provisioner",
+			options: &Options{
+				Stages: []StageOptions{{Provisioner: "foo"}},
+			},
+		},
+		{
+			name: "working dir not supported",
+			options: &Options{
+				Stages: []StageOptions{{Provisioner: "null", WorkingDir: "foo"}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewChain(tc.options)
+
+			assert.Error(t, c.Provision(context.Background()))
+		})
+	}
+}
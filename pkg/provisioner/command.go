@@ -0,0 +1,87 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// buildCommand creates an *exec.Cmd for binary. If binary is empty,
+// defaultBinary is used instead. The global args are placed in front of args.
+// Env is added to the environment of the current process.
+func buildCommand(binary, defaultBinary string, globalArgs []string, env map[string]string, args ...string) *exec.Cmd {
+	if binary == "" {
+		binary = defaultBinary
+	}
+
+	cmdArgs := make([]string, 0, len(globalArgs)+len(args))
+	cmdArgs = append(cmdArgs, globalArgs...)
+	cmdArgs = append(cmdArgs, args...)
+
+	cmd := exec.Command(binary, cmdArgs...)
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), buildEnv(env)...)
+	}
+
+	return cmd
+}
+
+// buildEnv converts env into a slice of KEY=value pairs sorted by key.
+func buildEnv(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, env[k])
+	}
+
+	return pairs
+}
+
+// terraformVars returns a TF_VAR_<name> environment variable for each of the
+// inputs. Values that are not strings are encoded as json, which terraform
+// accepts for complex variable types. Returns an error if a value cannot be
+// encoded.
+func terraformVars(inputs map[string]interface{}) (map[string]string, error) {
+	vars := make(map[string]string, len(inputs))
+
+	for k, v := range inputs {
+		if s, ok := v.(string); ok {
+			vars["TF_VAR_"+k] = s
+			continue
+		}
+
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode input %s", k)
+		}
+
+		vars["TF_VAR_"+k] = string(buf)
+	}
+
+	return vars, nil
+}
+
+// mergeEnv merges envs into a new map. Variables of later envs take
+// precedence.
+func mergeEnv(envs ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+
+	for _, env := range envs {
+		for k, v := range env {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,53 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCommand(t *testing.T) {
+	cmd := buildCommand("", "terraform", []string{"-chdir=infra"}, nil, "plan")
+
+	assert.Equal(t, []string{"terraform", "-chdir=infra", "plan"}, cmd.Args)
+	assert.Nil(t, cmd.Env)
+
+	cmd = buildCommand("tofu", "terraform", nil, map[string]string{"TF_LOG": "debug", "AWS_PROFILE": "dev"}, "plan")
+
+	assert.Equal(t, []string{"tofu", "plan"}, cmd.Args)
+	assert.Equal(t, []string{"AWS_PROFILE=dev", "TF_LOG=debug"}, cmd.Env[len(cmd.Env)-2:])
+}
+
+func TestTerraformVars(t *testing.T) {
+	vars, err := terraformVars(map[string]interface{}{
+		"foo": "bar",
+		"baz": []interface{}{"qux"},
+		"num": 3,
+	})
+
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"TF_VAR_foo": "bar",
+		"TF_VAR_baz": `["qux"]`,
+		"TF_VAR_num": "3",
+	}
+
+	assert.Equal(t, expected, vars)
+
+	_, err = terraformVars(map[string]interface{}{"ch": make(chan int)})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to encode input ch")
+}
+
+func TestMergeEnv(t *testing.T) {
+	env := mergeEnv(
+		map[string]string{"TF_VAR_foo": "bar", "TF_VAR_baz": "qux"},
+		map[string]string{"TF_VAR_foo": "override"},
+	)
+
+	assert.Equal(t, map[string]string{"TF_VAR_foo": "override", "TF_VAR_baz": "qux"}, env)
+	assert.Empty(t, mergeEnv(nil, nil))
+}
@@ -14,9 +14,12 @@ var (
 )
 
 func init() {
+	Register("chain", NewChain)
+	Register("kubeadm", NewKubeadm)
 	Register("minikube", NewMinikube)
 	Register("null", NewNull)
 	Register("terraform", NewTerraform)
+	Register("terragrunt", NewTerragrunt)
 }
 
 // Register registers a factory for an infrastructure provisioner with given
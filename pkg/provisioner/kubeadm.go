@@ -0,0 +1,546 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/file"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/remote"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	kubeadmAdminConf   = "/etc/kubernetes/admin.conf"
+	kubeadmKubeletConf = "/etc/kubernetes/kubelet.conf"
+
+	defaultKubeadmKubeconfig = "kubeconfig"
+
+	// kubeadmVersionAnnotation is set on nodes after kubeadm upgraded them
+	// and contains the Kubernetes version they were upgraded to. kubeadm
+	// does not upgrade the kubelet, so the kubelet version cannot be used to
+	// tell whether a node was already upgraded.
+	kubeadmVersionAnnotation = "kcm/kubeadm-version"
+)
+
+// KubeadmInventory contains the hosts of a kubeadm cluster.
+type KubeadmInventory struct {
+	ControlPlane []KubeadmHost `json:"controlPlane" yaml:"controlPlane"`
+	Workers      []KubeadmHost `json:"workers,omitempty" yaml:"workers,omitempty"`
+}
+
+// Hosts returns all hosts of the inventory, control plane hosts first.
+func (i *KubeadmInventory) Hosts() []KubeadmHost {
+	hosts := make([]KubeadmHost, 0, len(i.ControlPlane)+len(i.Workers))
+	hosts = append(hosts, i.ControlPlane...)
+
+	return append(hosts, i.Workers...)
+}
+
+// KubeadmHost is a host in the KubeadmInventory.
+type KubeadmHost struct {
+	// Address is the address used to connect to the host via SSH. It may
+	// contain a port.
+	Address string `json:"address" yaml:"address"`
+
+	// Name is the name of the Kubernetes node. Defaults to Address.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// NodeName returns the name of the Kubernetes node running on h.
+func (h KubeadmHost) NodeName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+
+	return h.Address
+}
+
+// kubeadmNode is a node as reported by the Kubernetes API.
+type kubeadmNode struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Status struct {
+		NodeInfo struct {
+			KubeletVersion string `json:"kubeletVersion"`
+		} `json:"nodeInfo"`
+	} `json:"status"`
+}
+
+// kubeadmClusterState is the state of the cluster as reported by the
+// Kubernetes API.
+type kubeadmClusterState struct {
+	// ServerVersion is the version of the Kubernetes API server.
+	ServerVersion string
+
+	// Nodes maps node names to the Kubernetes version kubeadm upgraded them
+	// to. For nodes that were never upgraded by kcm, the kubelet version is
+	// used instead.
+	Nodes map[string]string
+}
+
+// Kubeadm is an infrastructure provisioner that bootstraps Kubernetes on
+// plain hosts using kubeadm. It connects to the hosts in the inventory via
+// SSH and runs kubeadm init, join and upgrade as needed. Running Provision
+// multiple times is safe, hosts that already are part of the cluster are not
+// joined again. Kubeadm expects kubeadm, kubectl and the kubelet to be
+// installed on all hosts.
+type Kubeadm struct {
+	options   KubeadmOptions
+	transport remote.Transport
+
+	// dir is the dir relative paths in options are resolved against.
+	// Defaults to the working dir of the current process.
+	dir string
+}
+
+// NewKubeadm creates a new Kubeadm provisioner.
+func NewKubeadm(o *Options) Provisioner {
+	return &Kubeadm{
+		options: o.Kubeadm,
+	}
+}
+
+// Provision implements Provision from the Provisioner interface.
+func (k *Kubeadm) Provision(ctx context.Context) error {
+	inventory, err := k.readInventory()
+	if err != nil {
+		return err
+	}
+
+	leader := inventory.ControlPlane[0]
+
+	initialized, err := k.fileExists(ctx, leader, kubeadmAdminConf)
+	if err != nil {
+		return err
+	}
+
+	if !initialized {
+		log.Infof("initializing cluster on %s", leader.Address)
+
+		if _, err := k.run(ctx, leader, k.initCommand(leader)); err != nil {
+			return err
+		}
+	}
+
+	state, err := k.clusterState(ctx, leader)
+	if err != nil {
+		return err
+	}
+
+	if k.needsUpgrade(state.ServerVersion) {
+		log.Infof("upgrading control plane from %s to %s", state.ServerVersion, k.options.KubernetesVersion)
+
+		cmd := fmt.Sprintf("kubeadm upgrade apply --yes %s", shellQuote(k.options.KubernetesVersion))
+
+		if _, err := k.run(ctx, leader, cmd); err != nil {
+			return err
+		}
+
+		if err := k.markUpgraded(ctx, leader, leader); err != nil {
+			return err
+		}
+	}
+
+	var joinCommand, certificateKey string
+
+	hosts := inventory.Hosts()
+
+	for i := 1; i < len(hosts); i++ {
+		host := hosts[i]
+		controlPlane := i < len(inventory.ControlPlane)
+
+		joined, err := k.fileExists(ctx, host, kubeadmKubeletConf)
+		if err != nil {
+			return err
+		}
+
+		if joined {
+			if version, ok := state.Nodes[host.NodeName()]; ok && k.needsUpgrade(version) {
+				log.Infof("upgrading node %s from %s to %s", host.NodeName(), version, k.options.KubernetesVersion)
+
+				if _, err := k.run(ctx, host, "kubeadm upgrade node"); err != nil {
+					return err
+				}
+
+				if err := k.markUpgraded(ctx, leader, host); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if joinCommand == "" {
+			out, err := k.run(ctx, leader, "kubeadm token create --print-join-command")
+			if err != nil {
+				return err
+			}
+
+			joinCommand = strings.TrimSpace(out)
+		}
+
+		cmd := fmt.Sprintf("%s --node-name %s", joinCommand, shellQuote(host.NodeName()))
+
+		if controlPlane {
+			if certificateKey == "" {
+				out, err := k.run(ctx, leader, "kubeadm init phase upload-certs --upload-certs")
+				if err != nil {
+					return err
+				}
+
+				certificateKey = lastLine(out)
+			}
+
+			cmd = fmt.Sprintf("%s --control-plane --certificate-key %s", cmd, shellQuote(certificateKey))
+		}
+
+		log.Infof("joining node %s", host.NodeName())
+
+		if _, err := k.run(ctx, host, cmd); err != nil {
+			return err
+		}
+	}
+
+	return k.writeKubeconfig(ctx, leader)
+}
+
+// Reconcile implements Reconciler. It reports hosts that would be joined,
+// nodes that are not part of the inventory and version differences without
+// making any changes.
+func (k *Kubeadm) Reconcile(ctx context.Context) error {
+	inventory, err := k.readInventory()
+	if err != nil {
+		return err
+	}
+
+	leader := inventory.ControlPlane[0]
+
+	initialized, err := k.fileExists(ctx, leader, kubeadmAdminConf)
+	if err != nil {
+		return err
+	}
+
+	if !initialized {
+		log.Warnf("cluster is not initialized, would run kubeadm init on %s", leader.Address)
+		return nil
+	}
+
+	state, err := k.clusterState(ctx, leader)
+	if err != nil {
+		return err
+	}
+
+	if k.needsUpgrade(state.ServerVersion) {
+		log.Warnf("would upgrade control plane from %s to %s", state.ServerVersion, k.options.KubernetesVersion)
+	}
+
+	known := make(map[string]bool)
+
+	for _, host := range inventory.Hosts() {
+		name := host.NodeName()
+		known[name] = true
+
+		version, ok := state.Nodes[name]
+		if !ok {
+			log.Warnf("node %s is not part of the cluster, would join it", name)
+		} else if k.needsUpgrade(version) {
+			log.Warnf("node %s runs %s, would upgrade to %s", name, version, k.options.KubernetesVersion)
+		}
+	}
+
+	for name := range state.Nodes {
+		if !known[name] {
+			log.Warnf("node %s is part of the cluster but missing in the inventory", name)
+		}
+	}
+
+	return nil
+}
+
+// Output implements Outputter. It returns the path of the local admin
+// kubeconfig which is written by Provision. Nothing is returned if the
+// cluster is not initialized or Provision did not run yet.
+func (k *Kubeadm) Output(ctx context.Context) (map[string]interface{}, error) {
+	v := make(map[string]interface{})
+
+	inventory, err := k.readInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	initialized, err := k.fileExists(ctx, inventory.ControlPlane[0], kubeadmAdminConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if !initialized {
+		log.Warn("cluster is not initialized yet, there is nothing to output.")
+		return v, nil
+	}
+
+	kubeconfig := k.kubeconfigPath()
+
+	if _, err := os.Stat(kubeconfig); os.IsNotExist(err) {
+		log.Warnf("kubeconfig %s does not exist yet, it is written during provisioning", kubeconfig)
+		return v, nil
+	}
+
+	v["kubeconfig"] = kubeconfig
+
+	if k.options.KubernetesVersion != "" {
+		v["kubernetesVersion"] = k.options.KubernetesVersion
+	}
+
+	return v, nil
+}
+
+// writeKubeconfig fetches the admin kubeconfig from host and writes it to
+// the local kubeconfig file.
+func (k *Kubeadm) writeKubeconfig(ctx context.Context, host KubeadmHost) error {
+	out, err := k.run(ctx, host, "cat "+kubeadmAdminConf)
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(ioutil.WriteFile(k.kubeconfigPath(), []byte(out), 0600))
+}
+
+// SetWorkingDir implements WorkingDirSetter.
+func (k *Kubeadm) SetWorkingDir(dir string) {
+	k.dir = dir
+}
+
+func (k *Kubeadm) kubeconfigPath() string {
+	if k.options.Kubeconfig != "" {
+		return k.path(k.options.Kubeconfig)
+	}
+
+	return k.path(defaultKubeadmKubeconfig)
+}
+
+// path resolves p against the working dir of k. Absolute paths and paths
+// relative to the home dir are returned as is.
+func (k *Kubeadm) path(p string) string {
+	if k.dir == "" || p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "~") {
+		return p
+	}
+
+	return filepath.Join(k.dir, p)
+}
+
+// markUpgraded annotates the node of host with the Kubernetes version it
+// was upgraded to using the admin kubeconfig on leader.
+func (k *Kubeadm) markUpgraded(ctx context.Context, leader, host KubeadmHost) error {
+	cmd := fmt.Sprintf(
+		"kubectl --kubeconfig %s annotate node %s %s --overwrite",
+		kubeadmAdminConf,
+		shellQuote(host.NodeName()),
+		shellQuote(kubeadmVersionAnnotation+"="+k.options.KubernetesVersion),
+	)
+
+	_, err := k.run(ctx, leader, cmd)
+
+	return err
+}
+
+// Destroy implements Destroy from the Provisioner interface. It resets all
+// workers and afterwards the control plane hosts in reverse order.
+func (k *Kubeadm) Destroy(ctx context.Context) error {
+	inventory, err := k.readInventory()
+	if err != nil {
+		return err
+	}
+
+	hosts := inventory.Hosts()
+
+	for i := len(hosts) - 1; i >= 0; i-- {
+		host := hosts[i]
+
+		log.Infof("resetting node %s", host.NodeName())
+
+		if _, err := k.run(ctx, host, "kubeadm reset --force"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k *Kubeadm) initCommand(host KubeadmHost) string {
+	args := []string{"kubeadm", "init", "--upload-certs", "--node-name", shellQuote(host.NodeName())}
+
+	if k.options.KubernetesVersion != "" {
+		args = append(args, "--kubernetes-version", shellQuote(k.options.KubernetesVersion))
+	}
+
+	if k.options.ControlPlaneEndpoint != "" {
+		args = append(args, "--control-plane-endpoint", shellQuote(k.options.ControlPlaneEndpoint))
+	}
+
+	if k.options.PodNetworkCIDR != "" {
+		args = append(args, "--pod-network-cidr", shellQuote(k.options.PodNetworkCIDR))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// clusterState retrieves the server version and the nodes of the cluster
+// using the admin kubeconfig on host.
+func (k *Kubeadm) clusterState(ctx context.Context, host KubeadmHost) (*kubeadmClusterState, error) {
+	kubectl := "kubectl --kubeconfig " + kubeadmAdminConf
+
+	out, err := k.run(ctx, host, kubectl+" version --output json")
+	if err != nil {
+		return nil, err
+	}
+
+	var version struct {
+		ServerVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+
+	if err := json.Unmarshal([]byte(out), &version); err != nil {
+		return nil, errors.Wrap(err, "failed to parse server version")
+	}
+
+	out, err = k.run(ctx, host, kubectl+" get nodes --output json")
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes struct {
+		Items []kubeadmNode `json:"items"`
+	}
+
+	if err := json.Unmarshal([]byte(out), &nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to parse nodes")
+	}
+
+	state := &kubeadmClusterState{
+		ServerVersion: version.ServerVersion.GitVersion,
+		Nodes:         make(map[string]string),
+	}
+
+	for _, node := range nodes.Items {
+		version, ok := node.Metadata.Annotations[kubeadmVersionAnnotation]
+		if !ok {
+			version = node.Status.NodeInfo.KubeletVersion
+		}
+
+		state.Nodes[node.Metadata.Name] = version
+	}
+
+	return state, nil
+}
+
+// needsUpgrade returns true if a Kubernetes version is configured and
+// version differs from it.
+func (k *Kubeadm) needsUpgrade(version string) bool {
+	desired := k.options.KubernetesVersion
+	if desired == "" || version == "" {
+		return false
+	}
+
+	return strings.TrimPrefix(desired, "v") != strings.TrimPrefix(version, "v")
+}
+
+// fileExists returns true if filename exists on host. The check runs with
+// sudo if enabled, since the files may not be readable by the SSH user.
+func (k *Kubeadm) fileExists(ctx context.Context, host KubeadmHost, filename string) (bool, error) {
+	cmd := fmt.Sprintf("test -f %s && echo yes || echo no", shellQuote(filename))
+
+	out, err := k.run(ctx, host, cmd)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) == "yes", nil
+}
+
+// run runs cmd on host, optionally prefixed with sudo.
+func (k *Kubeadm) run(ctx context.Context, host KubeadmHost, cmd string) (string, error) {
+	transport, err := k.getTransport()
+	if err != nil {
+		return "", err
+	}
+
+	if k.options.Sudo {
+		cmd = "sudo " + cmd
+	}
+
+	return transport.Run(ctx, host.Address, cmd)
+}
+
+func (k *Kubeadm) getTransport() (remote.Transport, error) {
+	if k.transport != nil {
+		return k.transport, nil
+	}
+
+	config := k.options.SSH
+	config.PrivateKeyFile = k.path(config.PrivateKeyFile)
+	config.KnownHostsFile = k.path(config.KnownHostsFile)
+
+	transport, err := remote.NewSSHTransport(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	k.transport = transport
+
+	return transport, nil
+}
+
+func (k *Kubeadm) readInventory() (*KubeadmInventory, error) {
+	if k.options.Inventory == "" {
+		return nil, errors.New("kubeadm provisioner requires an inventory")
+	}
+
+	inventory := &KubeadmInventory{}
+
+	if err := file.ReadYAML(k.path(k.options.Inventory), inventory); err != nil {
+		return nil, errors.Wrapf(err, "failed to read inventory %s", k.options.Inventory)
+	}
+
+	if len(inventory.ControlPlane) == 0 {
+		return nil, errors.Errorf("inventory %s does not contain any control plane hosts", k.options.Inventory)
+	}
+
+	return inventory, nil
+}
+
+// shellQuote quotes s for use in a shell command if it contains characters
+// that have a special meaning to the shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, isUnsafeShellRune) < 0 {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+func isUnsafeShellRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("@%+=:,./-_", r):
+		return false
+	default:
+		return true
+	}
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,365 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/sshtest"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKubeadmHost is a fake host that records the commands it receives.
+type testKubeadmHost struct {
+	*sshtest.Server
+
+	mu       sync.Mutex
+	name     string
+	files    map[string]bool
+	commands []string
+	outputs  map[string]string
+
+	// stderr is written to the standard error of every command.
+	stderr string
+}
+
+func newTestKubeadmHost(t *testing.T, name string) *testKubeadmHost {
+	h := &testKubeadmHost{
+		name:    name,
+		files:   make(map[string]bool),
+		outputs: make(map[string]string),
+	}
+
+	server, err := sshtest.NewServer(h.handle)
+	require.NoError(t, err)
+
+	h.Server = server
+
+	return h
+}
+
+func (h *testKubeadmHost) handle(cmd string) (string, string, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if strings.HasPrefix(strings.TrimPrefix(cmd, "sudo "), "test -f ") {
+		filename := strings.Fields(strings.TrimPrefix(cmd, "sudo "))[2]
+		if h.files[filename] {
+			return "yes\n", h.stderr, 0
+		}
+
+		return "no\n", h.stderr, 0
+	}
+
+	h.commands = append(h.commands, cmd)
+
+	switch {
+	case strings.HasPrefix(cmd, "kubeadm init --"):
+		h.files[kubeadmAdminConf] = true
+		h.files[kubeadmKubeletConf] = true
+	case strings.HasPrefix(cmd, "kubeadm join"):
+		h.files[kubeadmKubeletConf] = true
+	}
+
+	for prefix, out := range h.outputs {
+		if strings.HasPrefix(cmd, prefix) {
+			return out, h.stderr, 0
+		}
+	}
+
+	return "", h.stderr, 0
+}
+
+func (h *testKubeadmHost) host() KubeadmHost {
+	return KubeadmHost{Address: h.Addr(), Name: h.name}
+}
+
+func newTestKubeadm(t *testing.T, o KubeadmOptions, controlPlane []*testKubeadmHost, workers []*testKubeadmHost) (*Kubeadm, func()) {
+	dir, err := ioutil.TempDir("", "kubeadm")
+	require.NoError(t, err)
+
+	inventory := "controlPlane:\n"
+	for _, h := range controlPlane {
+		inventory += fmt.Sprintf("- address: %s\n  name: %s\n", h.Addr(), h.name)
+	}
+
+	inventory += "workers:\n"
+	for _, h := range workers {
+		inventory += fmt.Sprintf("- address: %s\n  name: %s\n", h.Addr(), h.name)
+	}
+
+	o.Inventory = filepath.Join(dir, "inventory.yaml")
+	o.Kubeconfig = filepath.Join(dir, "kubeconfig")
+	o.SSH = remote.SSHConfig{InsecureIgnoreHostKey: true}
+
+	require.NoError(t, ioutil.WriteFile(o.Inventory, []byte(inventory), 0600))
+
+	k := NewKubeadm(&Options{Kubeadm: o}).(*Kubeadm)
+
+	cleanup := func() {
+		for _, h := range append(controlPlane, workers...) {
+			h.Close()
+		}
+
+		os.RemoveAll(dir)
+	}
+
+	return k, cleanup
+}
+
+func testNodesJSON(version string, names ...string) string {
+	items := make([]string, len(names))
+	for i, name := range names {
+		items[i] = fmt.Sprintf(`{"metadata":{"name":%q},"status":{"nodeInfo":{"kubeletVersion":%q}}}`, name, version)
+	}
+
+	return fmt.Sprintf(`{"items":[%s]}`, strings.Join(items, ","))
+}
+
+func TestKubeadmProvision(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+	cp2 := newTestKubeadmHost(t, "cp-2")
+	worker := newTestKubeadmHost(t, "worker-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{
+		KubernetesVersion: "v1.15.0",
+		PodNetworkCIDR:    "10.244.0.0/16",
+	}, []*testKubeadmHost{cp1, cp2}, []*testKubeadmHost{worker})
+	defer cleanup()
+
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.0"}}`
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = testNodesJSON("v1.15.0", "cp-1")
+	cp1.outputs["kubeadm token create"] = "kubeadm join 10.0.0.1:6443 --token abc --discovery-token-ca-cert-hash sha256:123\n"
+	cp1.outputs["kubeadm init phase upload-certs"] = "[upload-certs] Using certificate key:\nsecretkey\n"
+
+	require.NoError(t, k.Provision(context.Background()))
+
+	assert.Equal(t, []string{
+		"kubeadm init --upload-certs --node-name cp-1 --kubernetes-version v1.15.0 --pod-network-cidr 10.244.0.0/16",
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf version --output json",
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes --output json",
+		"kubeadm token create --print-join-command",
+		"kubeadm init phase upload-certs --upload-certs",
+		"cat /etc/kubernetes/admin.conf",
+	}, cp1.commands)
+
+	assert.Equal(t, []string{
+		"kubeadm join 10.0.0.1:6443 --token abc --discovery-token-ca-cert-hash sha256:123 --node-name cp-2 --control-plane --certificate-key secretkey",
+	}, cp2.commands)
+
+	assert.Equal(t, []string{
+		"kubeadm join 10.0.0.1:6443 --token abc --discovery-token-ca-cert-hash sha256:123 --node-name worker-1",
+	}, worker.commands)
+}
+
+func TestKubeadmProvisionIdempotent(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+	worker := newTestKubeadmHost(t, "worker-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{
+		KubernetesVersion: "v1.15.1",
+		Sudo:              true,
+	}, []*testKubeadmHost{cp1}, []*testKubeadmHost{worker})
+	defer cleanup()
+
+	cp1.files[kubeadmAdminConf] = true
+	worker.files[kubeadmKubeletConf] = true
+
+	cp1.outputs["sudo kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.0"}}`
+	cp1.outputs["sudo kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = testNodesJSON("v1.15.0", "cp-1", "worker-1")
+
+	require.NoError(t, k.Provision(context.Background()))
+
+	assert.Equal(t, []string{
+		"sudo kubectl --kubeconfig /etc/kubernetes/admin.conf version --output json",
+		"sudo kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes --output json",
+		"sudo kubeadm upgrade apply --yes v1.15.1",
+		"sudo kubectl --kubeconfig /etc/kubernetes/admin.conf annotate node cp-1 kcm/kubeadm-version=v1.15.1 --overwrite",
+		"sudo kubectl --kubeconfig /etc/kubernetes/admin.conf annotate node worker-1 kcm/kubeadm-version=v1.15.1 --overwrite",
+		"sudo cat /etc/kubernetes/admin.conf",
+	}, cp1.commands)
+
+	assert.Equal(t, []string{"sudo kubeadm upgrade node"}, worker.commands)
+}
+
+func TestKubeadmProvisionSkipsUpgradedNodes(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+	worker := newTestKubeadmHost(t, "worker-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{KubernetesVersion: "v1.15.1"}, []*testKubeadmHost{cp1}, []*testKubeadmHost{worker})
+	defer cleanup()
+
+	cp1.files[kubeadmAdminConf] = true
+	worker.files[kubeadmKubeletConf] = true
+
+	// The kubelet is not upgraded by kubeadm, so only the annotation tells
+	// that the worker was already upgraded.
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.1"}}`
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = `{"items":[
+  {"metadata":{"name":"cp-1","annotations":{"kcm/kubeadm-version":"v1.15.1"}},"status":{"nodeInfo":{"kubeletVersion":"v1.15.0"}}},
+  {"metadata":{"name":"worker-1","annotations":{"kcm/kubeadm-version":"v1.15.1"}},"status":{"nodeInfo":{"kubeletVersion":"v1.15.0"}}}
+]}`
+
+	require.NoError(t, k.Provision(context.Background()))
+
+	assert.Equal(t, []string{
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf version --output json",
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes --output json",
+		"cat /etc/kubernetes/admin.conf",
+	}, cp1.commands)
+
+	assert.Empty(t, worker.commands)
+}
+
+func TestKubeadmProvisionIgnoresStderr(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{Sudo: true}, []*testKubeadmHost{cp1}, nil)
+	defer cleanup()
+
+	cp1.files[kubeadmAdminConf] = true
+	cp1.stderr = "sudo: unable to resolve host cp-1\n"
+
+	cp1.outputs["sudo kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.0"}}`
+	cp1.outputs["sudo kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = testNodesJSON("v1.15.0", "cp-1")
+	cp1.outputs["sudo cat /etc/kubernetes/admin.conf"] = "apiVersion: v1\nkind: Config\n"
+
+	require.NoError(t, k.Provision(context.Background()))
+
+	buf, err := ioutil.ReadFile(k.options.Kubeconfig)
+
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", string(buf))
+}
+
+func TestKubeadmReconcile(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+	worker := newTestKubeadmHost(t, "worker-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{KubernetesVersion: "v1.15.1"}, []*testKubeadmHost{cp1}, []*testKubeadmHost{worker})
+	defer cleanup()
+
+	cp1.files[kubeadmAdminConf] = true
+
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.0"}}`
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = testNodesJSON("v1.15.0", "cp-1", "worker-2")
+
+	require.NoError(t, k.Reconcile(context.Background()))
+
+	assert.Equal(t, []string{
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf version --output json",
+		"kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes --output json",
+	}, cp1.commands)
+
+	assert.Empty(t, worker.commands)
+}
+
+func TestKubeadmOutput(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{}, []*testKubeadmHost{cp1}, nil)
+	defer cleanup()
+
+	values, err := k.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, values)
+
+	cp1.files[kubeadmAdminConf] = true
+	cp1.outputs["cat /etc/kubernetes/admin.conf"] = "apiVersion: v1\nkind: Config\n"
+
+	values, err = k.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, values)
+	assert.NotContains(t, cp1.commands, "cat /etc/kubernetes/admin.conf")
+
+	_, err = os.Stat(k.options.Kubeconfig)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, k.writeKubeconfig(context.Background(), cp1.host()))
+
+	values, err = k.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"kubeconfig": k.options.Kubeconfig}, values)
+
+	buf, err := ioutil.ReadFile(k.options.Kubeconfig)
+
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", string(buf))
+}
+
+func TestKubeadmQuotesNodeNames(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1; rm -rf /")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{}, []*testKubeadmHost{cp1}, nil)
+	defer cleanup()
+
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf version"] = `{"serverVersion":{"gitVersion":"v1.15.0"}}`
+	cp1.outputs["kubectl --kubeconfig /etc/kubernetes/admin.conf get nodes"] = `{"items":[]}`
+
+	require.NoError(t, k.Provision(context.Background()))
+
+	assert.Equal(t, "kubeadm init --upload-certs --node-name 'cp-1; rm -rf /'", cp1.commands[0])
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"cp-1", "cp-1"},
+		{"10.244.0.0/16", "10.244.0.0/16"},
+		{"kcm/kubeadm-version=v1.15.0", "kcm/kubeadm-version=v1.15.0"},
+		{"", "''"},
+		{"foo bar", "'foo bar'"},
+		{"$(reboot)", "'$(reboot)'"},
+		{"it's", `'it'"'"'s'`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, shellQuote(test.in))
+	}
+}
+
+func TestKubeadmDestroy(t *testing.T) {
+	cp1 := newTestKubeadmHost(t, "cp-1")
+	worker := newTestKubeadmHost(t, "worker-1")
+
+	k, cleanup := newTestKubeadm(t, KubeadmOptions{}, []*testKubeadmHost{cp1}, []*testKubeadmHost{worker})
+	defer cleanup()
+
+	require.NoError(t, k.Destroy(context.Background()))
+
+	assert.Equal(t, []string{"kubeadm reset --force"}, cp1.commands)
+	assert.Equal(t, []string{"kubeadm reset --force"}, worker.commands)
+}
+
+func TestKubeadmMissingInventory(t *testing.T) {
+	k := NewKubeadm(&Options{})
+
+	require.Error(t, k.Provision(context.Background()))
+	require.Error(t, k.Destroy(context.Background()))
+}
+
+func TestKubeadmSetWorkingDir(t *testing.T) {
+	k := &Kubeadm{options: KubeadmOptions{Inventory: "inventory.yaml"}}
+
+	assert.Equal(t, "kubeconfig", k.kubeconfigPath())
+
+	k.SetWorkingDir("/stages/cluster")
+
+	assert.Equal(t, "/stages/cluster/kubeconfig", k.kubeconfigPath())
+	assert.Equal(t, "/stages/cluster/inventory.yaml", k.path(k.options.Inventory))
+	assert.Equal(t, "/etc/kubeconfig", k.path("/etc/kubeconfig"))
+	assert.Equal(t, "~/.ssh/id_rsa", k.path("~/.ssh/id_rsa"))
+	assert.Equal(t, "", k.path(""))
+}
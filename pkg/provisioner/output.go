@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OutputCache is an Outputter that wraps another Outputter and caches its
+// output values, so that the output of the infrastructure provisioner is only
+// fetched once per run.
+type OutputCache struct {
+	outputter Outputter
+	values    map[string]interface{}
+	mu        sync.Mutex
+}
+
+// NewOutputCache creates a new OutputCache which caches the output of o.
+func NewOutputCache(o Outputter) *OutputCache {
+	return &OutputCache{outputter: o}
+}
+
+// Output implements Outputter. The wrapped Outputter is only called if there
+// are no cached values. Errors are not cached.
+func (c *OutputCache) Output(ctx context.Context) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values != nil {
+		return c.values, nil
+	}
+
+	values, err := c.outputter.Output(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	c.values = values
+
+	return values, nil
+}
+
+// Reset implements Resetter. It clears the cached values. This should be
+// called after changes to the infrastructure were made.
+func (c *OutputCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values = nil
+}
+
+// FileOutputter is an Outputter that reads output values from a json file,
+// e.g. a snapshot of the outputs written by a previous run.
+type FileOutputter struct {
+	filename string
+}
+
+// NewFileOutputter creates a new FileOutputter for filename.
+func NewFileOutputter(filename string) *FileOutputter {
+	return &FileOutputter{filename: filename}
+}
+
+// Output implements Outputter.
+func (o *FileOutputter) Output(ctx context.Context) (map[string]interface{}, error) {
+	buf, err := ioutil.ReadFile(o.filename)
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("outputs snapshot %s does not exist", o.filename)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	v := make(map[string]interface{})
+
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse outputs snapshot %s", o.filename)
+	}
+
+	return v, nil
+}
+
+// WriteOutputFile writes the output values v as json to filename. The file is
+// only readable by the current user as it may contain sensitive values.
+func WriteOutputFile(filename string, v map[string]interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(buf, '\n'), 0600)
+}
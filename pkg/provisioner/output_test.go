@@ -0,0 +1,72 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingOutputter struct {
+	called int
+}
+
+func (o *countingOutputter) Output(ctx context.Context) (map[string]interface{}, error) {
+	o.called++
+	return map[string]interface{}{"foo": "bar"}, nil
+}
+
+func TestOutputCache(t *testing.T) {
+	o := &countingOutputter{}
+
+	c := NewOutputCache(o)
+
+	for i := 0; i < 3; i++ {
+		v, err := c.Output(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"foo": "bar"}, v)
+	}
+
+	assert.Equal(t, 1, o.called)
+
+	c.Reset()
+
+	_, err := c.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, o.called)
+}
+
+func TestFileOutputter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "outputs.json")
+
+	o := NewFileOutputter(filename)
+
+	_, err = o.Output(context.Background())
+	require.Error(t, err)
+
+	expected := map[string]interface{}{
+		"foo": "bar",
+		"baz": []interface{}{"qux"},
+	}
+
+	require.NoError(t, WriteOutputFile(filename, expected))
+
+	fi, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	v, err := o.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, expected, v)
+}
@@ -2,6 +2,8 @@ package provisioner
 
 import (
 	"context"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/remote"
 )
 
 // Provisioner is the interface for an infrastructure provisioner.
@@ -30,7 +32,82 @@ type Outputter interface {
 	Output(context.Context) (map[string]interface{}, error)
 }
 
+// Resetter can discard cached output values, e.g. because they may be stale
+// after the infrastructure changed.
+type Resetter interface {
+	// Reset discards cached output values.
+	Reset()
+}
+
+// Inputter can receive input values, e.g. outputs of previous stages in a
+// Chain.
+type Inputter interface {
+	// SetInputs sets the input values that should be passed to the
+	// infrastructure provisioner. Returns an error if the values cannot be
+	// passed to it.
+	SetInputs(map[string]interface{}) error
+}
+
+// WorkingDirSetter can run in a working dir that differs from the working
+// dir of the current process, e.g. in the working dir of a Chain stage.
+type WorkingDirSetter interface {
+	// SetWorkingDir sets the dir that commands are run in and that relative
+	// paths are resolved against.
+	SetWorkingDir(string)
+}
+
 // Options are made available to infrastructure provisioners.
 type Options struct {
 	Parallelism int `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
+
+	// Binary overrides the name or path of the provisioner binary, e.g. to
+	// use OpenTofu instead of terraform.
+	Binary string `json:"binary,omitempty" yaml:"binary,omitempty"`
+
+	// Args are global args that are passed to the provisioner binary before
+	// any subcommand.
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+
+	// Env contains additional environment variables for the provisioner
+	// binary.
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// Stages configures the provisioners of a Chain.
+	Stages []StageOptions `json:"stages,omitempty" yaml:"stages,omitempty"`
+
+	// Kubeadm configures the Kubeadm provisioner.
+	Kubeadm KubeadmOptions `json:"kubeadm,omitempty" yaml:"kubeadm,omitempty"`
+}
+
+// KubeadmOptions configure the Kubeadm provisioner.
+type KubeadmOptions struct {
+	// Inventory is the path to a yaml file containing the control plane and
+	// worker hosts.
+	Inventory string `json:"inventory,omitempty" yaml:"inventory,omitempty"`
+
+	KubernetesVersion    string `json:"kubernetesVersion,omitempty" yaml:"kubernetesVersion,omitempty"`
+	ControlPlaneEndpoint string `json:"controlPlaneEndpoint,omitempty" yaml:"controlPlaneEndpoint,omitempty"`
+	PodNetworkCIDR       string `json:"podNetworkCIDR,omitempty" yaml:"podNetworkCIDR,omitempty"`
+
+	// Kubeconfig is the local path the admin kubeconfig is written to.
+	// Defaults to "kubeconfig" in the working directory.
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+
+	// Sudo prefixes all kubeadm and kubectl commands with sudo.
+	Sudo bool `json:"sudo,omitempty" yaml:"sudo,omitempty"`
+
+	SSH remote.SSHConfig `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+}
+
+// StageOptions configure a single stage of a Chain.
+type StageOptions struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Provisioner string `json:"provisioner" yaml:"provisioner"`
+	WorkingDir  string `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
+
+	// Inputs are the names of the outputs of earlier stages that are passed
+	// to the stage. Other outputs are not passed.
+	Inputs []string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+
+	Options Options `json:"options,omitempty" yaml:"options,omitempty"`
 }
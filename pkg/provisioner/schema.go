@@ -0,0 +1,218 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported output types.
+const (
+	OutputTypeAny    = ""
+	OutputTypeString = "string"
+	OutputTypeNumber = "number"
+	OutputTypeBool   = "bool"
+	OutputTypeList   = "list"
+	OutputTypeMap    = "map"
+)
+
+const sensitiveValue = "<sensitive>"
+
+// OutputSchema describes the outputs that are expected from an
+// infrastructure provisioner. It is keyed by output name. Nested outputs can
+// be addressed using dots, e.g. `network.vpc_id`.
+type OutputSchema map[string]OutputSpec
+
+// OutputSpec describes a single output.
+type OutputSpec struct {
+	// Type is the expected type of the output value. Can be one of `string`,
+	// `number`, `bool`, `list` or `map`. If empty, any type is accepted.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Required marks outputs that must be present.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+
+	// Sensitive marks outputs whose values must not be logged.
+	Sensitive bool `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+}
+
+// OutputSchemaError is returned if output values do not match an
+// OutputSchema. It contains a report line for each missing or mistyped
+// output.
+type OutputSchemaError struct {
+	Problems []string
+}
+
+// Error implements error.
+func (e *OutputSchemaError) Error() string {
+	return fmt.Sprintf(
+		"provisioner outputs do not match the output schema:\n  - %s",
+		strings.Join(e.Problems, "\n  - "),
+	)
+}
+
+// Validate validates the schema itself, e.g. that all types are known.
+func (s OutputSchema) Validate() error {
+	for _, key := range s.keys() {
+		switch s[key].Type {
+		case OutputTypeAny, OutputTypeString, OutputTypeNumber, OutputTypeBool, OutputTypeList, OutputTypeMap:
+		default:
+			return errors.Errorf("invalid type %q for output %q in output schema", s[key].Type, key)
+		}
+	}
+
+	return nil
+}
+
+// ValidateValues validates output values v against the schema. It returns an
+// *OutputSchemaError listing all missing and mistyped outputs.
+func (s OutputSchema) ValidateValues(v map[string]interface{}) error {
+	problems := make([]string, 0)
+
+	for _, key := range s.keys() {
+		spec := s[key]
+
+		value, ok := lookupOutput(v, key)
+		if !ok || value == nil {
+			if spec.Required {
+				problems = append(problems, fmt.Sprintf("required output %q is missing", key))
+			}
+
+			continue
+		}
+
+		if actual := outputType(value); spec.Type != OutputTypeAny && spec.Type != actual {
+			problems = append(problems, fmt.Sprintf("output %q must be of type %s, got %s", key, spec.Type, actual))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &OutputSchemaError{Problems: problems}
+	}
+
+	return nil
+}
+
+// Redact returns a copy of v where the values of all outputs marked as
+// sensitive are replaced.
+func (s OutputSchema) Redact(v map[string]interface{}) map[string]interface{} {
+	redacted := copyOutputs(v)
+
+	for key, spec := range s {
+		if !spec.Sensitive {
+			continue
+		}
+
+		if _, ok := lookupOutput(redacted, key); ok {
+			setOutput(redacted, key, sensitiveValue)
+		}
+	}
+
+	return redacted
+}
+
+func (s OutputSchema) keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// SchemaOutputter is an Outputter that validates the output values of
+// another Outputter against an OutputSchema.
+type SchemaOutputter struct {
+	outputter Outputter
+	schema    OutputSchema
+}
+
+// NewSchemaOutputter creates a new SchemaOutputter which validates the
+// output of o against schema.
+func NewSchemaOutputter(o Outputter, schema OutputSchema) *SchemaOutputter {
+	return &SchemaOutputter{outputter: o, schema: schema}
+}
+
+// Output implements Outputter.
+func (o *SchemaOutputter) Output(ctx context.Context) (map[string]interface{}, error) {
+	values, err := o.outputter.Output(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("outputs", o.schema.Redact(values)).Debug("validating provisioner outputs")
+
+	if err := o.schema.ValidateValues(values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func lookupOutput(v map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := v[key]; ok {
+		return value, true
+	}
+
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) < 2 {
+		return nil, false
+	}
+
+	nested, ok := v[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	return lookupOutput(nested, parts[1])
+}
+
+func setOutput(v map[string]interface{}, key string, value interface{}) {
+	if _, ok := v[key]; ok {
+		v[key] = value
+		return
+	}
+
+	parts := strings.SplitN(key, ".", 2)
+
+	if nested, ok := v[parts[0]].(map[string]interface{}); ok && len(parts) == 2 {
+		setOutput(nested, parts[1], value)
+	}
+}
+
+func copyOutputs(v map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(v))
+
+	for key, value := range v {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copyOutputs(nested)
+		}
+
+		c[key] = value
+	}
+
+	return c
+}
+
+func outputType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return OutputTypeString
+	case bool:
+		return OutputTypeBool
+	case float64, float32, int, int64, int32, uint, uint64, uint32:
+		return OutputTypeNumber
+	case []interface{}:
+		return OutputTypeList
+	case map[string]interface{}:
+		return OutputTypeMap
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
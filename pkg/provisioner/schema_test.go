@@ -0,0 +1,148 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticOutputter map[string]interface{}
+
+func (o staticOutputter) Output(ctx context.Context) (map[string]interface{}, error) {
+	return o, nil
+}
+
+func TestOutputSchemaValidate(t *testing.T) {
+	s := OutputSchema{
+		"kubeconfig": {Type: OutputTypeString},
+		"nodes":      {},
+	}
+
+	require.NoError(t, s.Validate())
+
+	s["foo"] = OutputSpec{Type: "integer"}
+
+	require.Error(t, s.Validate())
+}
+
+func TestOutputSchemaValidateValues(t *testing.T) {
+	cases := []struct {
+		name     string
+		schema   OutputSchema
+		values   map[string]interface{}
+		problems []string
+	}{
+		{
+			name: "valid",
+			schema: OutputSchema{
+				"kubeconfig":     {Type: OutputTypeString, Required: true},
+				"replicas":       {Type: OutputTypeNumber},
+				"enabled":        {Type: OutputTypeBool},
+				"zones":          {Type: OutputTypeList},
+				"tags":           {Type: OutputTypeMap},
+				"network.vpc_id": {Type: OutputTypeString, Required: true},
+				"optional":       {Type: OutputTypeString},
+			},
+			values: map[string]interface{}{
+				"kubeconfig": "/tmp/kubeconfig",
+				"replicas":   float64(3),
+				"enabled":    true,
+				"zones":      []interface{}{"a", "b"},
+				"tags":       map[string]interface{}{"foo": "bar"},
+				"network": map[string]interface{}{
+					"vpc_id": "vpc-123",
+				},
+			},
+		},
+		{
+			name: "missing and mistyped",
+			schema: OutputSchema{
+				"kubeconfig":     {Type: OutputTypeString, Required: true},
+				"token":          {Type: OutputTypeString, Required: true, Sensitive: true},
+				"replicas":       {Type: OutputTypeNumber},
+				"network.vpc_id": {Required: true},
+			},
+			values: map[string]interface{}{
+				"token":    nil,
+				"replicas": "3",
+				"network":  "foo",
+			},
+			problems: []string{
+				`required output "kubeconfig" is missing`,
+				`required output "network.vpc_id" is missing`,
+				`output "replicas" must be of type number, got string`,
+				`required output "token" is missing`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.schema.ValidateValues(tc.values)
+			if tc.problems == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, tc.problems, err.(*OutputSchemaError).Problems)
+		})
+	}
+}
+
+func TestOutputSchemaRedact(t *testing.T) {
+	s := OutputSchema{
+		"token":           {Sensitive: true},
+		"db.password":     {Sensitive: true},
+		"missing":         {Sensitive: true},
+		"missing.nested":  {Sensitive: true},
+		"kubeconfig":      {},
+		"db.password.foo": {Sensitive: true},
+	}
+
+	values := map[string]interface{}{
+		"token":      "secret",
+		"kubeconfig": "/tmp/kubeconfig",
+		"db": map[string]interface{}{
+			"password": "secret",
+			"user":     "admin",
+		},
+	}
+
+	expected := map[string]interface{}{
+		"token":      "<sensitive>",
+		"kubeconfig": "/tmp/kubeconfig",
+		"db": map[string]interface{}{
+			"password": "<sensitive>",
+			"user":     "admin",
+		},
+	}
+
+	assert.Equal(t, expected, s.Redact(values))
+
+	// original values must not be modified
+	assert.Equal(t, "secret", values["token"])
+	assert.Equal(t, "secret", values["db"].(map[string]interface{})["password"])
+}
+
+func TestSchemaOutputter(t *testing.T) {
+	schema := OutputSchema{
+		"kubeconfig": {Type: OutputTypeString, Required: true},
+	}
+
+	o := NewSchemaOutputter(staticOutputter{"kubeconfig": "/tmp/kubeconfig"}, schema)
+
+	values, err := o.Output(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"kubeconfig": "/tmp/kubeconfig"}, values)
+
+	o = NewSchemaOutputter(staticOutputter{"server": "https://localhost"}, schema)
+
+	_, err = o.Output(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `required output "kubeconfig" is missing`)
+}
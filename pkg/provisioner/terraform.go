@@ -25,22 +25,35 @@ type terraformOutputValue struct {
 }
 
 // Terraform is an infrastructure manager that uses terraform to manage
-// resources.
+// resources. Binary can be set to use a terraform compatible tool like
+// OpenTofu instead.
 type Terraform struct {
 	Parallelism int
+	Binary      string
+	Args        []string
+	Env         map[string]string
+
+	// vars contains the TF_VAR_<name> environment variables of the inputs.
+	vars map[string]string
+
+	// dir is the dir terraform is run in. Defaults to the working dir of
+	// the current process.
+	dir string
 }
 
 // NewTerraform creates a new terraform infrastructure manager.
 func NewTerraform(o *Options) Provisioner {
 	return &Terraform{
 		Parallelism: o.Parallelism,
+		Binary:      o.Binary,
+		Args:        o.Args,
+		Env:         o.Env,
 	}
 }
 
 // Provision implements Provision from the Provisioner interface.
 func (m *Terraform) Provision(ctx context.Context) error {
 	args := []string{
-		"terraform",
 		"apply",
 		"--auto-approve",
 	}
@@ -49,7 +62,7 @@ func (m *Terraform) Provision(ctx context.Context) error {
 		args = append(args, fmt.Sprintf("--parallelism=%d", m.Parallelism))
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := m.command(args...)
 
 	_, err := command.RunWithContext(ctx, cmd)
 
@@ -59,7 +72,6 @@ func (m *Terraform) Provision(ctx context.Context) error {
 // Reconcile implements Reconciler.
 func (m *Terraform) Reconcile(ctx context.Context) (err error) {
 	args := []string{
-		"terraform",
 		"plan",
 		"--detailed-exitcode",
 	}
@@ -68,28 +80,54 @@ func (m *Terraform) Reconcile(ctx context.Context) (err error) {
 		args = append(args, fmt.Sprintf("--parallelism=%d", m.Parallelism))
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := m.command(args...)
 
-	if _, err = command.RunWithContext(ctx, cmd); err != nil {
-		// ExitCode 2 means that there are infrastructure changes. This is not an error.
-		if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
-			err = nil
-		}
-	}
+	_, err = command.RunWithContext(ctx, cmd)
 
-	return
+	return ignorePlanChanges(err)
 }
 
 // Output implements Outputter.
 func (m *Terraform) Output(ctx context.Context) (map[string]interface{}, error) {
-	args := []string{
-		"terraform",
-		"output",
-		"--json",
+	cmd := m.command("output", "--json")
+
+	return runTerraformOutput(cmd)
+}
+
+// SetInputs implements Inputter. Inputs are passed to terraform as TF_VAR_<name>
+// environment variables.
+func (m *Terraform) SetInputs(inputs map[string]interface{}) (err error) {
+	m.vars, err = terraformVars(inputs)
+	return err
+}
+
+// SetWorkingDir implements WorkingDirSetter.
+func (m *Terraform) SetWorkingDir(dir string) {
+	m.dir = dir
+}
+
+// command builds a terraform command with given args.
+func (m *Terraform) command(args ...string) *exec.Cmd {
+	cmd := buildCommand(m.Binary, "terraform", m.Args, mergeEnv(m.vars, m.Env), args...)
+	cmd.Dir = m.dir
+
+	return cmd
+}
+
+// ignorePlanChanges returns nil if err was caused by a plan with
+// --detailed-exitcode that exited with code 2, err otherwise.
+func ignorePlanChanges(err error) error {
+	// ExitCode 2 means that there are infrastructure changes. This is not an error.
+	if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		return nil
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	return err
+}
 
+// runTerraformOutput runs cmd, which is expected to print terraform output
+// values as json, and returns the parsed values.
+func runTerraformOutput(cmd *exec.Cmd) (map[string]interface{}, error) {
 	v := make(map[string]interface{})
 
 	out, err := command.RunSilently(cmd)
@@ -120,7 +158,6 @@ func (m *Terraform) Output(ctx context.Context) (map[string]interface{}, error)
 // Destroy implements Destroy from the Provisioner interface.
 func (m *Terraform) Destroy(ctx context.Context) error {
 	args := []string{
-		"terraform",
 		"destroy",
 		"--auto-approve",
 	}
@@ -129,7 +166,7 @@ func (m *Terraform) Destroy(ctx context.Context) error {
 		args = append(args, fmt.Sprintf("--parallelism=%d", m.Parallelism))
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := m.command(args...)
 
 	_, err := command.RunWithContext(ctx, cmd)
 
@@ -24,6 +24,23 @@ func TestTerraformProvision(t *testing.T) {
 	})
 }
 
+func TestTerraformProvisionCustomBinary(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		options := &Options{
+			Binary: "tofu",
+			Args:   []string{"-chdir=infra"},
+			Env:    map[string]string{"TF_IN_AUTOMATION": "1"},
+		}
+
+		m := NewTerraform(options)
+
+		executor.ExpectCommand("tofu -chdir=infra apply --auto-approve")
+
+		assert.NoError(t, m.Provision(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
 func TestTerraformReconcile(t *testing.T) {
 	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
 		m := &Terraform{}
@@ -0,0 +1,230 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	terragruntConfigFile = "terragrunt.hcl"
+	terragruntCacheDir   = ".terragrunt-cache"
+)
+
+// Terragrunt is an infrastructure manager that uses terragrunt to manage
+// resources spread across multiple terraform modules. All modules below the
+// working directory are provisioned using terragrunt's run-all commands.
+type Terragrunt struct {
+	Parallelism int
+	Binary      string
+	Args        []string
+	Env         map[string]string
+
+	// vars contains the TF_VAR_<name> environment variables of the inputs.
+	vars map[string]string
+
+	// rootDir is the directory terragrunt is run in and in which modules are
+	// looked up. Defaults to the current working directory.
+	rootDir string
+}
+
+// NewTerragrunt creates a new terragrunt infrastructure manager.
+func NewTerragrunt(o *Options) Provisioner {
+	return &Terragrunt{
+		Parallelism: o.Parallelism,
+		Binary:      o.Binary,
+		Args:        o.Args,
+		Env:         o.Env,
+	}
+}
+
+// Provision implements Provision from the Provisioner interface.
+func (m *Terragrunt) Provision(ctx context.Context) error {
+	cmd := m.runAllCommand("apply", "--auto-approve")
+
+	_, err := command.RunWithContext(ctx, cmd)
+
+	return err
+}
+
+// Reconcile implements Reconciler.
+func (m *Terragrunt) Reconcile(ctx context.Context) error {
+	cmd := m.runAllCommand("plan", "--detailed-exitcode")
+
+	_, err := command.RunWithContext(ctx, cmd)
+
+	return ignorePlanChanges(err)
+}
+
+// Output implements Outputter. The outputs of every module found below the
+// working directory are nested into the values map by the segments of the
+// relative path of the module, e.g. the outputs of the module `eks/nodes`
+// are available at `eks.nodes`. If there are no modules in subdirectories,
+// the outputs of the module in the working directory are returned as is.
+func (m *Terragrunt) Output(ctx context.Context) (map[string]interface{}, error) {
+	modules, err := m.findModules()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(modules) == 0 {
+		return runTerraformOutput(m.command("output", "--json"))
+	}
+
+	v := make(map[string]interface{})
+
+	// nested contains the module paths and their parent paths for which a
+	// map was created in v. Any other existing value is a module output.
+	nested := make(map[string]bool)
+
+	for _, module := range modules {
+		log.Debugf("fetching output of terragrunt module %s", module)
+
+		values, err := runTerraformOutput(m.command("output", "--json", "--terragrunt-working-dir", module))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch output of terragrunt module %s", module)
+		}
+
+		if err := setModuleOutputs(v, nested, module, values); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// setModuleOutputs stores values in v below the path segments of module.
+// Since modules are sorted, parent modules are always processed before the
+// modules in their subdirectories. Returns an error if an output of a parent
+// module has the same name as a path segment of module.
+func setModuleOutputs(v map[string]interface{}, nested map[string]bool, module string, values map[string]interface{}) error {
+	segments := strings.Split(module, "/")
+
+	for i, segment := range segments {
+		path := strings.Join(segments[:i+1], "/")
+
+		if _, ok := v[segment]; ok && !nested[path] {
+			return errors.Errorf("path of terragrunt module %s conflicts with output %q of module %s", module, segment, strings.Join(segments[:i], "/"))
+		}
+
+		if !nested[path] {
+			v[segment] = make(map[string]interface{})
+			nested[path] = true
+		}
+
+		v = v[segment].(map[string]interface{})
+	}
+
+	for key, value := range values {
+		v[key] = value
+	}
+
+	return nil
+}
+
+// SetInputs implements Inputter. Inputs are passed to terragrunt as TF_VAR_<name>
+// environment variables.
+func (m *Terragrunt) SetInputs(inputs map[string]interface{}) (err error) {
+	m.vars, err = terraformVars(inputs)
+	return err
+}
+
+// SetWorkingDir implements WorkingDirSetter.
+func (m *Terragrunt) SetWorkingDir(dir string) {
+	m.rootDir = dir
+}
+
+// Destroy implements Destroy from the Provisioner interface.
+func (m *Terragrunt) Destroy(ctx context.Context) error {
+	cmd := m.runAllCommand("destroy", "--auto-approve")
+
+	_, err := command.RunWithContext(ctx, cmd)
+
+	return err
+}
+
+// runAllCommand builds a terragrunt run-all command for the terraform
+// subcommand with given args.
+func (m *Terragrunt) runAllCommand(subcommand string, args ...string) *exec.Cmd {
+	cmdArgs := []string{
+		"run-all",
+		subcommand,
+		"--terragrunt-non-interactive",
+	}
+
+	cmdArgs = append(cmdArgs, args...)
+
+	if m.Parallelism > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--parallelism=%d", m.Parallelism))
+	}
+
+	return m.command(cmdArgs...)
+}
+
+// command builds a terragrunt command with given args.
+// The command is run in the root dir, module dirs passed via
+// --terragrunt-working-dir are relative to it.
+func (m *Terragrunt) command(args ...string) *exec.Cmd {
+	cmd := buildCommand(m.Binary, "terragrunt", m.Args, mergeEnv(m.vars, m.Env), args...)
+	cmd.Dir = m.rootDir
+
+	return cmd
+}
+
+// findModules returns the relative paths of all directories below the working
+// directory that contain a terragrunt config file. The result is sorted.
+func (m *Terragrunt) findModules() ([]string, error) {
+	root := m.dir()
+	modules := make([]string, 0)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && info.Name() == terragruntCacheDir {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || info.Name() != terragruntConfigFile {
+			return nil
+		}
+
+		module, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		// A config file in the root dir usually only contains configuration
+		// shared by all modules, so we do not treat it as a module.
+		if module != "." {
+			modules = append(modules, filepath.ToSlash(module))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sort.Strings(modules)
+
+	return modules, nil
+}
+
+func (m *Terragrunt) dir() string {
+	if m.rootDir == "" {
+		return "."
+	}
+
+	return m.rootDir
+}
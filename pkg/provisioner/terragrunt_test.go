@@ -0,0 +1,106 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/commandtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerragruntProvision(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		options := &Options{Parallelism: 4}
+
+		m := NewTerragrunt(options)
+
+		executor.ExpectCommand("terragrunt run-all apply --terragrunt-non-interactive --auto-approve --parallelism=4")
+
+		assert.NoError(t, m.Provision(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestTerragruntReconcile(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m := &Terragrunt{Binary: "/usr/local/bin/terragrunt"}
+
+		executor.ExpectCommand("/usr/local/bin/terragrunt run-all plan --terragrunt-non-interactive --detailed-exitcode")
+
+		assert.NoError(t, m.Reconcile(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestTerragruntOutput(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m := &Terragrunt{rootDir: "testdata/terragrunt"}
+
+		executor.ExpectCommand("terragrunt output --json --terragrunt-working-dir eks$").
+			WillReturn(`{"cluster_name":{"value":"foo"}}`)
+		executor.ExpectCommand("terragrunt output --json --terragrunt-working-dir eks/nodes$").
+			WillReturn(`{"node_count":{"value":3}}`)
+		executor.ExpectCommand("terragrunt output --json --terragrunt-working-dir network$").
+			WillReturn(`{"vpc_id":{"value":"vpc-123"}}`)
+
+		expectedValues := map[string]interface{}{
+			"eks": map[string]interface{}{
+				"cluster_name": "foo",
+				"nodes": map[string]interface{}{
+					"node_count": float64(3),
+				},
+			},
+			"network": map[string]interface{}{
+				"vpc_id": "vpc-123",
+			},
+		}
+
+		values, err := m.Output(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, expectedValues, values)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestTerragruntOutputConflict(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m := &Terragrunt{rootDir: "testdata/terragrunt"}
+
+		executor.ExpectCommand("terragrunt output --json --terragrunt-working-dir eks$").
+			WillReturn(`{"nodes":{"value":["node-1"]}}`)
+		executor.ExpectCommand("terragrunt output --json --terragrunt-working-dir eks/nodes$").
+			WillReturn(`{"node_count":{"value":3}}`)
+
+		_, err := m.Output(context.Background())
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `path of terragrunt module eks/nodes conflicts with output "nodes" of module eks`)
+	})
+}
+
+func TestTerragruntOutputSingleModule(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m := &Terragrunt{rootDir: "testdata/terragrunt/network"}
+
+		executor.ExpectCommand("terragrunt output --json$").WillReturn(`{"vpc_id":{"value":"vpc-123"}}`)
+
+		values, err := m.Output(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"vpc_id": "vpc-123"}, values)
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
+
+func TestTerragruntDestroy(t *testing.T) {
+	commandtest.WithMockExecutor(func(executor commandtest.MockExecutor) {
+		m := &Terragrunt{Args: []string{"--terragrunt-log-level", "error"}}
+
+		executor.ExpectCommand("terragrunt --terragrunt-log-level error run-all destroy --terragrunt-non-interactive --auto-approve")
+
+		assert.NoError(t, m.Destroy(context.Background()))
+		assert.NoError(t, executor.ExpectationsWereMet())
+	})
+}
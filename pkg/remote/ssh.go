@@ -0,0 +1,219 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/command"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// DefaultSSHPort is the port used if the host address does not contain
+	// one.
+	DefaultSSHPort = 22
+
+	// DefaultSSHUser is the user used if none is configured.
+	DefaultSSHUser = "root"
+)
+
+// SSHConfig configures the SSH transport.
+type SSHConfig struct {
+	User                  string `json:"user,omitempty" yaml:"user,omitempty"`
+	PrivateKeyFile        string `json:"privateKeyFile,omitempty" yaml:"privateKeyFile,omitempty"`
+	KnownHostsFile        string `json:"knownHostsFile,omitempty" yaml:"knownHostsFile,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty" yaml:"insecureIgnoreHostKey,omitempty"`
+}
+
+type sshTransport struct {
+	config *ssh.ClientConfig
+
+	// agentSocket is the socket of the SSH agent used for authentication if
+	// no private key file is configured. The agent is connected to for each
+	// command and the connection is closed afterwards.
+	agentSocket string
+}
+
+// NewSSHTransport creates a new Transport which connects to hosts using the
+// SSH protocol. Authentication is done using the configured private key
+// file or, if none is set, the keys of a running SSH agent. Host keys are
+// verified against the known hosts file, which defaults to
+// ~/.ssh/known_hosts.
+func NewSSHTransport(c *SSHConfig) (Transport, error) {
+	auth, err := privateKeyAuth(c)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := hostKeyCallback(c)
+	if err != nil {
+		return nil, err
+	}
+
+	user := c.User
+	if user == "" {
+		user = DefaultSSHUser
+	}
+
+	t := &sshTransport{
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+		},
+	}
+
+	if auth == nil {
+		t.agentSocket = os.Getenv("SSH_AUTH_SOCK")
+	}
+
+	return t, nil
+}
+
+// Run implements Transport.
+func (t *sshTransport) Run(ctx context.Context, address, cmd string) (string, error) {
+	address = withDefaultPort(address)
+
+	redactedCmd := strings.Join(command.RedactArgs(strings.Fields(cmd)), " ")
+
+	log.WithField("host", address).Debugf("executing remote command: %s", redactedCmd)
+
+	config := *t.config
+
+	if t.agentSocket != "" {
+		agentConn, err := net.Dial("unix", t.agentSocket)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to connect to ssh agent")
+		}
+
+		defer agentConn.Close()
+
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers)}
+	}
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to connect to %s", address)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, &config)
+	if err != nil {
+		conn.Close()
+		return "", errors.Wrapf(err, "ssh handshake with %s failed", address)
+	}
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- session.Run(cmd)
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Signal(ssh.SIGINT)
+		client.Close()
+		return "", ctx.Err()
+	case err = <-done:
+	}
+
+	if err != nil {
+		err = errors.Wrapf(
+			err,
+			"remote command %q on %s failed with output: %s",
+			redactedCmd,
+			address,
+			strings.Trim(stderr.String(), "\n"),
+		)
+	}
+
+	return stdout.String(), err
+}
+
+// privateKeyAuth returns the auth method for the configured private key
+// file. Returns nil if no private key file is configured.
+func privateKeyAuth(c *SSHConfig) ([]ssh.AuthMethod, error) {
+	if c.PrivateKeyFile == "" {
+		return nil, nil
+	}
+
+	filename, err := homedir.Expand(c.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse private key %s", filename)
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+}
+
+func hostKeyCallback(c *SSHConfig) (ssh.HostKeyCallback, error) {
+	if c.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	filename := c.KnownHostsFile
+	if filename == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, err
+		}
+
+		filename = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	filename, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := knownhosts.New(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read known hosts file %s", filename)
+	}
+
+	return callback, nil
+}
+
+func withDefaultPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+
+	return net.JoinHostPort(address, strconv.Itoa(DefaultSSHPort))
+}
@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martinohmann/kubernetes-cluster-manager/internal/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHTransport(t *testing.T) {
+	server, err := sshtest.NewServer(func(cmd string) (string, string, int) {
+		switch cmd {
+		case "echo foo":
+			return "foo\n", "warning: something\n", 0
+		default:
+			return "", "command not found\n", 127
+		}
+	})
+
+	require.NoError(t, err)
+	defer server.Close()
+
+	transport, err := NewSSHTransport(&SSHConfig{InsecureIgnoreHostKey: true})
+	require.NoError(t, err)
+
+	out, err := transport.Run(context.Background(), server.Addr(), "echo foo")
+
+	require.NoError(t, err)
+	assert.Equal(t, "foo\n", out)
+
+	out, err = transport.Run(context.Background(), server.Addr(), "bar")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command not found")
+	assert.Equal(t, "", out)
+}
+
+func TestSSHTransportClosesAgentConnection(t *testing.T) {
+	server, err := sshtest.NewServer(func(cmd string) (string, string, int) {
+		return "", "", 0
+	})
+
+	require.NoError(t, err)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ssh-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	closed := make(chan struct{})
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		// ServeAgent returns once the client closed the connection.
+		agent.ServeAgent(agent.NewKeyring(), conn)
+		close(closed)
+	}()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", socket)
+
+	transport, err := NewSSHTransport(&SSHConfig{InsecureIgnoreHostKey: true})
+	require.NoError(t, err)
+
+	_, err = transport.Run(context.Background(), server.Addr(), "true")
+	require.NoError(t, err)
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ssh agent connection was not closed")
+	}
+}
+
+func TestSSHTransportUnknownHostKey(t *testing.T) {
+	_, err := NewSSHTransport(&SSHConfig{KnownHostsFile: "/nonexistent/known_hosts"})
+
+	require.Error(t, err)
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	assert.Equal(t, "10.0.0.1:22", withDefaultPort("10.0.0.1"))
+	assert.Equal(t, "10.0.0.1:2222", withDefaultPort("10.0.0.1:2222"))
+	assert.Equal(t, "node-1:22", withDefaultPort("node-1"))
+}
@@ -0,0 +1,13 @@
+package remote
+
+import "context"
+
+// Transport runs commands on remote hosts.
+type Transport interface {
+	// Run runs cmd on the host with given address and returns its standard
+	// output. Address can optionally contain a port. Will return an error if
+	// the connection fails or the command exits with a non-zero exit code.
+	// The standard error of the command is only included in the error, so
+	// that warnings printed by the command do not end up in the output.
+	Run(ctx context.Context, address, cmd string) (string, error)
+}
@@ -17,6 +17,7 @@ var hintPrefixMap = map[Hint]string{
 	Addition: "+",
 	Update:   "~",
 	Removal:  "-",
+	Replace:  "-/+",
 }
 
 // hintColorFuncMap contains a mapping of hints to color printing functions.
@@ -24,6 +25,7 @@ var hintColorFuncMap = map[Hint]func(string, ...interface{}) string{
 	Addition: color.GreenString,
 	Update:   color.YellowString,
 	Removal:  color.RedString,
+	Replace:  color.MagentaString,
 }
 
 // Format formats the resource as string.
@@ -32,16 +34,16 @@ func Format(r *Resource) string {
 }
 
 // format formats the resource. It will enrich the output based on the resource
-// hints. If the Updated hint is set on the resource, and it also received a
-// contentHint via WithContentHint, a diff will be added to the formatted
-// output only if the diff itself is not empty.
+// hints. If the Update or Replace hint is set on the resource, and it also
+// received a contentHint via WithContentHint, a diff will be added to the
+// formatted output only if the diff itself is not empty.
 func format(r *Resource) string {
 	colorFunc := hintColorFunc(r.hint)
 	prefix := hintPrefix(r.hint)
 	s := r.String()
 
 	switch r.hint {
-	case Update:
+	case Update, Replace:
 		prefix = colorFunc(prefix)
 		s = colorFunc(s)
 
@@ -13,6 +13,9 @@ const (
 	Update
 	// Removal indicates that the resource will be removed.
 	Removal
+	// Replace indicates that the resource will be deleted and recreated
+	// because immutable fields changed.
+	Replace
 )
 
 // String implements fmt.Stringer
@@ -26,6 +29,8 @@ func (h Hint) String() string {
 		return "update"
 	case Removal:
 		return "removal"
+	case Replace:
+		return "replace"
 	}
 
 	return "unknown"
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// UpdateStrategyAnnotation controls what happens if an update of a
+	// resource changes immutable fields.
+	UpdateStrategyAnnotation = "kcm/update-strategy"
+
+	// RecreateUpdateStrategy causes resources to be deleted and recreated if
+	// immutable fields change.
+	RecreateUpdateStrategy = "recreate"
+
+	// FailUpdateStrategy causes the update to fail if immutable fields
+	// change. This is the default.
+	FailUpdateStrategy = "fail"
+)
+
+// ImmutableFields contains the paths of known immutable fields per kind.
+var ImmutableFields = map[string][]string{
+	DaemonSet:             {"spec.selector"},
+	Deployment:            {"spec.selector"},
+	Job:                   {"spec.selector", "spec.template"},
+	PersistentVolumeClaim: {"spec.accessModes", "spec.storageClassName", "spec.volumeName"},
+	"ReplicaSet":          {"spec.selector"},
+	"Service":             {"spec.clusterIP"},
+	StatefulSet:           {"spec.podManagementPolicy", "spec.selector", "spec.serviceName", "spec.volumeClaimTemplates"},
+}
+
+// Recreate returns true if the resource should be deleted and recreated if
+// immutable fields change.
+func (r *Resource) Recreate() bool {
+	return r.UpdateStrategy == RecreateUpdateStrategy
+}
+
+// ImmutableFieldChanges returns the paths of the known immutable fields of r
+// that differ between old and the content of r. Fields that are only present
+// in one of both are not reported, since their value may have been set by
+// the API server.
+func (r *Resource) ImmutableFieldChanges(old []byte) ([]string, error) {
+	paths, ok := ImmutableFields[r.Kind]
+	if !ok {
+		return nil, nil
+	}
+
+	var a, b map[string]interface{}
+
+	if err := yaml.Unmarshal(old, &a); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse resource %s", r)
+	}
+
+	if err := yaml.Unmarshal(r.Content, &b); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse resource %s", r)
+	}
+
+	changed := make([]string, 0)
+
+	for _, path := range paths {
+		va, aok := lookupPath(a, path)
+		vb, bok := lookupPath(b, path)
+
+		if aok && bok && !reflect.DeepEqual(va, vb) {
+			changed = append(changed, path)
+		}
+	}
+
+	return changed, nil
+}
+
+// lookupPath looks up the value at the dotted path in v.
+func lookupPath(v map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = v
+
+	for _, key := range strings.Split(path, ".") {
+		var ok bool
+
+		switch m := current.(type) {
+		case map[string]interface{}:
+			current, ok = m[key]
+		case map[interface{}]interface{}:
+			current, ok = m[key]
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
@@ -0,0 +1,77 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResource_ImmutableFieldChanges(t *testing.T) {
+	cases := []struct {
+		name     string
+		kind     string
+		old      string
+		new      string
+		expected []string
+	}{
+		{
+			name:     "kind without immutable fields",
+			kind:     "ConfigMap",
+			old:      "data:\n  foo: bar\n",
+			new:      "data:\n  foo: baz\n",
+			expected: nil,
+		},
+		{
+			name:     "changed job template",
+			kind:     Job,
+			old:      "spec:\n  template:\n    spec:\n      containers:\n      - image: foo:1\n",
+			new:      "spec:\n  template:\n    spec:\n      containers:\n      - image: foo:2\n",
+			expected: []string{"spec.template"},
+		},
+		{
+			name:     "changed service clusterIP",
+			kind:     "Service",
+			old:      "spec:\n  clusterIP: 10.0.0.1\n  ports: [80]\n",
+			new:      "spec:\n  clusterIP: 10.0.0.2\n  ports: [443]\n",
+			expected: []string{"spec.clusterIP"},
+		},
+		{
+			name:     "field only present in new content",
+			kind:     "Service",
+			old:      "spec:\n  ports: [80]\n",
+			new:      "spec:\n  clusterIP: 10.0.0.2\n",
+			expected: []string{},
+		},
+		{
+			name:     "changed statefulset volumeClaimTemplates and selector",
+			kind:     StatefulSet,
+			old:      "spec:\n  selector:\n    app: foo\n  volumeClaimTemplates:\n  - size: 1Gi\n  replicas: 1\n",
+			new:      "spec:\n  selector:\n    app: bar\n  volumeClaimTemplates:\n  - size: 2Gi\n  replicas: 2\n",
+			expected: []string{"spec.selector", "spec.volumeClaimTemplates"},
+		},
+		{
+			name:     "unchanged immutable fields",
+			kind:     Deployment,
+			old:      "spec:\n  selector:\n    app: foo\n  replicas: 1\n",
+			new:      "spec:\n  selector:\n    app: foo\n  replicas: 2\n",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Resource{Kind: tc.kind, Name: "foo", Content: []byte(tc.new)}
+
+			fields, err := r.ImmutableFieldChanges([]byte(tc.old))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, fields)
+		})
+	}
+}
+
+func TestResource_Recreate(t *testing.T) {
+	assert.True(t, (&Resource{UpdateStrategy: RecreateUpdateStrategy}).Recreate())
+	assert.False(t, (&Resource{UpdateStrategy: FailUpdateStrategy}).Recreate())
+	assert.False(t, (&Resource{}).Recreate())
+}
@@ -0,0 +1,161 @@
+package resource
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// metadataLineRegexp matches the line that starts the top-level metadata
+// block mapping of a resource.
+var metadataLineRegexp = regexp.MustCompile(`^metadata:\s*(#.*)?$`)
+
+// ClusterScopedKinds contains the kinds of the built-in Kubernetes resources
+// that are not namespaced. It is only used where the cluster-scoped kinds
+// cannot be discovered from the cluster, e.g. in client-side dry runs.
+var ClusterScopedKinds = []string{
+	APIService,
+	"CertificateSigningRequest",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ComponentStatus",
+	"CSIDriver",
+	"CSINode",
+	CustomResourceDefinition,
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PodSecurityPolicy",
+	"PriorityClass",
+	"RuntimeClass",
+	"StorageClass",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// SetNamespace sets the namespace of r and updates metadata.namespace in the
+// resource content accordingly. The namespace is inserted into the content
+// as is, so that key order and comments are preserved and the content only
+// differs from the rendered content by the added namespace. Only if the
+// metadata is not a block mapping or already contains a namespace key, the
+// whole content is re-encoded.
+func (r *Resource) SetNamespace(namespace string) error {
+	var v map[string]interface{}
+
+	if err := yaml.Unmarshal(r.Content, &v); err != nil {
+		return errors.Wrapf(err, "failed to parse resource %s", r)
+	}
+
+	metadata, ok := v["metadata"].(map[interface{}]interface{})
+	if !ok {
+		return errors.Errorf("resource %s has no metadata", r)
+	}
+
+	buf, ok := insertNamespace(r.Content, namespace)
+
+	if _, exists := metadata["namespace"]; exists || !ok {
+		metadata["namespace"] = namespace
+
+		var err error
+
+		buf, err = yaml.Marshal(v)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	r.Namespace = namespace
+	r.Content = buf
+
+	return nil
+}
+
+// insertNamespace inserts the namespace key as first key of the top-level
+// metadata block mapping in content. Returns false if content does not
+// contain such a mapping or if the result does not contain namespace.
+func insertNamespace(content []byte, namespace string) ([]byte, bool) {
+	value, err := yaml.Marshal(namespace)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	for i, line := range lines {
+		if !metadataLineRegexp.MatchString(line) {
+			continue
+		}
+
+		indent, ok := childIndent(lines[i+1:])
+		if !ok {
+			return nil, false
+		}
+
+		result := make([]string, 0, len(lines)+1)
+		result = append(result, lines[:i+1]...)
+		result = append(result, indent+"namespace: "+strings.TrimSpace(string(value)))
+		result = append(result, lines[i+1:]...)
+
+		buf := []byte(strings.Join(result, "\n"))
+
+		var v struct {
+			Metadata struct {
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+
+		if err := yaml.Unmarshal(buf, &v); err != nil || v.Metadata.Namespace != namespace {
+			return nil, false
+		}
+
+		return buf, true
+	}
+
+	return nil, false
+}
+
+// childIndent returns the indentation of the first line in lines that is
+// neither blank nor a comment. Returns false if that line is not indented.
+func childIndent(lines []string) (string, bool) {
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := line[:len(line)-len(trimmed)]
+
+		return indent, indent != ""
+	}
+
+	return "", false
+}
+
+// CustomResourceScope returns the kind and the scope of the custom resource
+// defined by r if r is a CustomResourceDefinition. The scope is either
+// "Namespaced" or "Cluster".
+func (r *Resource) CustomResourceScope() (kind string, scope string, err error) {
+	if r.Kind != CustomResourceDefinition {
+		return "", "", nil
+	}
+
+	var crd struct {
+		Spec struct {
+			Scope string `yaml:"scope"`
+			Names struct {
+				Kind string `yaml:"kind"`
+			} `yaml:"names"`
+		} `yaml:"spec"`
+	}
+
+	if err := yaml.Unmarshal(r.Content, &crd); err != nil {
+		return "", "", errors.Wrapf(err, "failed to parse resource %s", r)
+	}
+
+	return crd.Spec.Names.Kind, crd.Spec.Scope, nil
+}
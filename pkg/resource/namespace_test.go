@@ -0,0 +1,129 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResource_SetNamespace(t *testing.T) {
+	r := &Resource{
+		Kind:    "ConfigMap",
+		Name:    "foo",
+		Content: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"),
+	}
+
+	require.NoError(t, r.SetNamespace("bar"))
+
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: bar
+  name: foo
+`
+
+	assert.Equal(t, "bar", r.Namespace)
+	assert.Equal(t, expected, string(r.Content))
+}
+
+func TestResource_SetNamespacePreservesContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		namespace string
+		expected  string
+	}{
+		{
+			name: "key order and comments",
+			content: `# rendered by helm
+kind: ConfigMap
+apiVersion: v1
+metadata: # object metadata
+    # the name
+    name: foo
+    labels:
+      app: foo
+data:
+  z: "1"
+  a: "2"
+`,
+			namespace: "bar",
+			expected: `# rendered by helm
+kind: ConfigMap
+apiVersion: v1
+metadata: # object metadata
+    namespace: bar
+    # the name
+    name: foo
+    labels:
+      app: foo
+data:
+  z: "1"
+  a: "2"
+`,
+		},
+		{
+			name:      "namespace that needs quoting",
+			content:   "kind: ConfigMap\nmetadata:\n  name: foo\n",
+			namespace: "123",
+			expected:  "kind: ConfigMap\nmetadata:\n  namespace: \"123\"\n  name: foo\n",
+		},
+		{
+			name:      "flow style metadata is re-encoded",
+			content:   "kind: ConfigMap\nmetadata: {name: foo}\n",
+			namespace: "bar",
+			expected:  "kind: ConfigMap\nmetadata:\n  name: foo\n  namespace: bar\n",
+		},
+		{
+			name:      "existing empty namespace is re-encoded",
+			content:   "kind: ConfigMap\nmetadata:\n  name: foo\n  namespace: \"\"\n",
+			namespace: "bar",
+			expected:  "kind: ConfigMap\nmetadata:\n  name: foo\n  namespace: bar\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Resource{Kind: "ConfigMap", Name: "foo", Content: []byte(test.content)}
+
+			require.NoError(t, r.SetNamespace(test.namespace))
+
+			assert.Equal(t, test.namespace, r.Namespace)
+			assert.Equal(t, test.expected, string(r.Content))
+		})
+	}
+}
+
+func TestResource_SetNamespaceInvalid(t *testing.T) {
+	r := &Resource{Kind: "ConfigMap", Name: "foo", Content: []byte("kind: ConfigMap\n")}
+
+	assert.Error(t, r.SetNamespace("bar"))
+	assert.Equal(t, "", r.Namespace)
+}
+
+func TestResource_CustomResourceScope(t *testing.T) {
+	r := &Resource{
+		Kind: CustomResourceDefinition,
+		Name: "clusterissuers.cert-manager.io",
+		Content: []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterissuers.cert-manager.io
+spec:
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+`),
+	}
+
+	kind, scope, err := r.CustomResourceScope()
+	require.NoError(t, err)
+	assert.Equal(t, "ClusterIssuer", kind)
+	assert.Equal(t, "Cluster", scope)
+
+	kind, scope, err = (&Resource{Kind: "ConfigMap"}).CustomResourceScope()
+	require.NoError(t, err)
+	assert.Equal(t, "", kind)
+	assert.Equal(t, "", scope)
+}
@@ -0,0 +1,111 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// InstanceLabel is set on all resources applied by kcm and contains the
+	// ID of the kcm instance that manages the resource. It is used to find
+	// orphaned resources.
+	InstanceLabel = "kcm/instance"
+
+	// ComponentLabel is set on all resources applied by kcm and contains the
+	// name of the component the resource belongs to.
+	ComponentLabel = "kcm/component"
+
+	// RevisionAnnotation is set on all resources applied by kcm and contains
+	// the revision of the component the resource was last applied with.
+	RevisionAnnotation = "kcm/revision"
+)
+
+var labelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+
+// Ownership describes which kcm instance and component own a resource.
+type Ownership struct {
+	InstanceID string
+	Component  string
+	Revision   string
+}
+
+// Validate returns an error if the ownership cannot be expressed as
+// Kubernetes labels.
+func (o Ownership) Validate() error {
+	for name, value := range map[string]string{"instance ID": o.InstanceID, "component name": o.Component} {
+		if value == "" || len(value) > 63 || !labelValueRegexp.MatchString(value) {
+			return errors.Errorf("invalid %s %q: must be a valid label value", name, value)
+		}
+	}
+
+	return nil
+}
+
+// Stamp returns a copy of content with the ownership labels and annotations
+// added to the resource metadata.
+func (o Ownership) Stamp(content []byte) ([]byte, error) {
+	var v map[string]interface{}
+
+	if err := yaml.Unmarshal(content, &v); err != nil {
+		return nil, errors.Wrap(err, "failed to parse resource")
+	}
+
+	metadata, ok := v["metadata"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("resource has no metadata")
+	}
+
+	setMetadataValue(metadata, "labels", InstanceLabel, o.InstanceID)
+	setMetadataValue(metadata, "labels", ComponentLabel, o.Component)
+
+	if o.Revision != "" {
+		setMetadataValue(metadata, "annotations", RevisionAnnotation, o.Revision)
+	}
+
+	buf, err := yaml.Marshal(v)
+
+	return buf, errors.WithStack(err)
+}
+
+// StampSlice returns the stamped contents of all resources in s.
+func (o Ownership) StampSlice(s Slice) ([]byte, error) {
+	var buf Buffer
+
+	for _, r := range s {
+		content, err := o.Stamp(r.Content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to add ownership labels to %s", r)
+		}
+
+		buf.Write(content)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Selector returns the label selector matching all resources of the kcm
+// instance.
+func (o Ownership) Selector() string {
+	return InstanceLabel + "=" + o.InstanceID
+}
+
+// Revision computes a short revision identifier from content.
+func Revision(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func setMetadataValue(metadata map[interface{}]interface{}, field, key, value string) {
+	values, ok := metadata[field].(map[interface{}]interface{})
+	if !ok {
+		values = make(map[interface{}]interface{})
+		metadata[field] = values
+	}
+
+	values[key] = value
+}
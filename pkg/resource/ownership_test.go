@@ -0,0 +1,64 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnership_Stamp(t *testing.T) {
+	o := Ownership{InstanceID: "prod", Component: "cert-manager", Revision: "abc"}
+
+	content := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  labels:
+    app: foo
+`)
+
+	buf, err := o.Stamp(content)
+	require.NoError(t, err)
+
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    kcm/revision: abc
+  labels:
+    app: foo
+    kcm/component: cert-manager
+    kcm/instance: prod
+  name: foo
+`
+
+	assert.Equal(t, expected, string(buf))
+	assert.NotContains(t, string(content), "kcm/instance", "original content must not be modified")
+}
+
+func TestOwnership_StampSliceInvalid(t *testing.T) {
+	o := Ownership{InstanceID: "prod", Component: "foo"}
+
+	_, err := o.StampSlice(Slice{{Kind: "ConfigMap", Name: "foo", Content: []byte("kind: ConfigMap")}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to add ownership labels to configmap/foo")
+}
+
+func TestOwnership_Validate(t *testing.T) {
+	assert.NoError(t, Ownership{InstanceID: "prod", Component: "cert-manager"}.Validate())
+	assert.Error(t, Ownership{InstanceID: "", Component: "cert-manager"}.Validate())
+	assert.Error(t, Ownership{InstanceID: "prod/eu", Component: "cert-manager"}.Validate())
+	assert.Error(t, Ownership{InstanceID: "prod", Component: "-foo"}.Validate())
+}
+
+func TestOwnership_Selector(t *testing.T) {
+	assert.Equal(t, "kcm/instance=prod", Ownership{InstanceID: "prod"}.Selector())
+}
+
+func TestRevision(t *testing.T) {
+	assert.Len(t, Revision([]byte("foo")), 12)
+	assert.Equal(t, Revision([]byte("foo")), Revision([]byte("foo")))
+	assert.NotEqual(t, Revision([]byte("foo")), Revision([]byte("bar")))
+}
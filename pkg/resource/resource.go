@@ -2,6 +2,7 @@ package resource
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -15,17 +16,50 @@ const (
 	// DeletePersistentVolumeClaimsPolicy will cause the deletion of all PVCs
 	// that were created for a StatefulSet.
 	DeletePersistentVolumeClaimsPolicy = "delete-pvcs"
+
+	// KeepPolicy causes a resource to be left in the cluster when it is
+	// removed from a manifest or when its component is deleted. The resource
+	// is not managed by kcm anymore afterwards.
+	KeepPolicy = "keep"
+)
+
+const (
+	// WaitAnnotation controls whether kcm waits for a resource after it was
+	// applied if waiting is enabled. If set to "false", the resource is
+	// skipped. Any other value is used as a custom condition for `kubectl
+	// wait`, e.g. "condition=Available". Workloads without the annotation
+	// are waited for until their rollout completed.
+	WaitAnnotation = "kcm/wait"
+
+	// NoWait is the value of the WaitAnnotation that disables waiting.
+	NoWait = "false"
+
+	// ApplyWeightAnnotation can be set to an integer to control the position
+	// of a resource in the apply and delete order. Resources with lower
+	// weights are applied before and deleted after resources with higher
+	// weights, regardless of their kind. The default weight is 0.
+	ApplyWeightAnnotation = "kcm/apply-weight"
 )
 
 const (
 	// Kinds of Kubernetes resources that are treated in a special way by kcm.
-	Job                   = "Job"
-	PersistentVolumeClaim = "PersistentVolumeClaim"
-	StatefulSet           = "StatefulSet"
+	APIService               = "APIService"
+	CustomResourceDefinition = "CustomResourceDefinition"
+	DaemonSet                = "DaemonSet"
+	Deployment               = "Deployment"
+	Job                      = "Job"
+	PersistentVolumeClaim    = "PersistentVolumeClaim"
+	Pod                      = "Pod"
+	StatefulSet              = "StatefulSet"
 )
 
 // Resource is a kubernetes resource.
 type Resource struct {
+	// APIVersion may be empty for resources that were created without
+	// apiVersion, e.g. in tests or by older versions of kcm. These match
+	// resources of any API group.
+	APIVersion string
+
 	Kind      string
 	Name      string
 	Namespace string
@@ -33,6 +67,21 @@ type Resource struct {
 
 	DeletePersistentVolumeClaims bool
 
+	// Keep indicates that the resource must not be deleted by kcm.
+	Keep bool
+
+	// UpdateStrategy is either RecreateUpdateStrategy or
+	// FailUpdateStrategy.
+	UpdateStrategy string
+
+	// WaitFor is a custom condition to wait for after the resource was
+	// applied. SkipWait disables waiting for the resource.
+	WaitFor  string
+	SkipWait bool
+
+	// ApplyWeight takes precedence over the kind when sorting resources.
+	ApplyWeight int
+
 	contentHint []byte
 	hint        Hint
 }
@@ -40,8 +89,9 @@ type Resource struct {
 // Head defines the yaml structure of a resource head. This is used
 // for parsing metadata from raw yaml documents.
 type Head struct {
-	Kind     string   `yaml:"kind"`
-	Metadata Metadata `yaml:"metadata"`
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
 }
 
 // String implements fmt.Stringer
@@ -62,29 +112,82 @@ type Metadata struct {
 
 // New creates a new resource value with content and head.
 func New(content []byte, head Head) (*Resource, error) {
+	var err error
+
 	r := &Resource{
-		Kind:      head.Kind,
-		Name:      head.Metadata.Name,
-		Namespace: head.Metadata.Namespace,
-		Content:   content,
+		APIVersion: head.APIVersion,
+		Kind:       head.Kind,
+		Name:       head.Metadata.Name,
+		Namespace:  head.Metadata.Namespace,
+		Content:    content,
 	}
 
 	policy, ok := head.Metadata.Annotations[DeletionPolicyAnnotation]
 	if ok {
-		if policy != DeletePersistentVolumeClaimsPolicy {
+		switch policy {
+		case DeletePersistentVolumeClaimsPolicy:
+			if r.Kind != StatefulSet {
+				return nil, errors.Errorf("deletion policy %q can only be applied to StatefulSets, got %s", policy, r.Kind)
+			}
+
+			r.DeletePersistentVolumeClaims = true
+		case KeepPolicy:
+			r.Keep = true
+		default:
 			return nil, errors.Errorf("unsupported deletion policy %q", policy)
 		}
+	}
+
+	wait, ok := head.Metadata.Annotations[WaitAnnotation]
+	if ok {
+		if wait == NoWait {
+			r.SkipWait = true
+		} else {
+			r.WaitFor = wait
+		}
+	}
 
-		if r.Kind != StatefulSet {
-			return nil, errors.Errorf("deletion policy %q can only be applied to StatefulSets, got %s", policy, r.Kind)
+	if strategy, ok := head.Metadata.Annotations[UpdateStrategyAnnotation]; ok {
+		if strategy != RecreateUpdateStrategy && strategy != FailUpdateStrategy {
+			return nil, errors.Errorf("unsupported update strategy %q", strategy)
 		}
 
-		r.DeletePersistentVolumeClaims = true
+		r.UpdateStrategy = strategy
+	}
+
+	if weight, ok := head.Metadata.Annotations[ApplyWeightAnnotation]; ok {
+		r.ApplyWeight, err = strconv.Atoi(weight)
+		if err != nil {
+			return nil, errors.Errorf("invalid value %q for annotation %s: must be an integer", weight, ApplyWeightAnnotation)
+		}
 	}
 
 	return r, nil
 }
 
+// Head returns the head of r which identifies the resource.
+func (r *Resource) Head() Head {
+	return Head{
+		APIVersion: r.APIVersion,
+		Kind:       r.Kind,
+		Metadata: Metadata{
+			Name:      r.Name,
+			Namespace: r.Namespace,
+		},
+	}
+}
+
+// HasRollout returns true if r is a workload resource whose rollout status
+// can be watched.
+func (r *Resource) HasRollout() bool {
+	switch r.Kind {
+	case Deployment, StatefulSet, DaemonSet:
+		return true
+	default:
+		return false
+	}
+}
+
 // String implements fmt.Stringer
 func (r *Resource) String() string {
 	if r.Namespace == "" {
@@ -94,9 +197,77 @@ func (r *Resource) String() string {
 	return fmt.Sprintf("%s/%s/%s", r.Namespace, strings.ToLower(r.Kind), r.Name)
 }
 
-// matches returns true if other matches r. Two resources match if their name,
-// kind and namespace are the same.
+// Group returns the API group of the resource. The group of resources in
+// the core API group is empty.
+func (r *Resource) Group() string {
+	return Group(r.APIVersion)
+}
+
+// Group returns the API group part of apiVersion, e.g. "apps" for "apps/v1"
+// and "" for "v1".
+func Group(apiVersion string) string {
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+
+	return ""
+}
+
+// GroupAliases contains the API groups that serve the same objects of a
+// kind. Moving a resource between these groups does not change the object in
+// the cluster.
+var GroupAliases = map[string][]string{
+	DaemonSet:           {"extensions", "apps"},
+	Deployment:          {"extensions", "apps"},
+	"Event":             {"", "events.k8s.io"},
+	"Ingress":           {"extensions", "networking.k8s.io"},
+	"NetworkPolicy":     {"extensions", "networking.k8s.io"},
+	"PodSecurityPolicy": {"extensions", "policy"},
+	"ReplicaSet":        {"extensions", "apps"},
+}
+
+// SameGroup returns true if the API groups a and b serve the same objects of
+// kind, either because they are equal or because they are aliases in
+// GroupAliases.
+func SameGroup(kind, a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	return containsString(GroupAliases[kind], a) && containsString(GroupAliases[kind], b)
+}
+
+func containsString(s []string, needle string) bool {
+	for _, v := range s {
+		if v == needle {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches returns true if other matches r. Two resources match if their API
+// group, kind, name and namespace are the same. The API version is not
+// compared, so that moving a resource to a new version of its API group
+// results in an update. The same applies to moving a resource between API
+// groups that are aliases in GroupAliases. Resources without an API version
+// match resources of any group.
 func (r *Resource) matches(other *Resource) bool {
+	if !r.matchesIgnoringGroup(other) {
+		return false
+	}
+
+	if r == nil || r.APIVersion == "" || other.APIVersion == "" {
+		return true
+	}
+
+	return SameGroup(r.Kind, r.Group(), other.Group())
+}
+
+// matchesIgnoringGroup returns true if name, kind and namespace of r and
+// other are the same.
+func (r *Resource) matchesIgnoringGroup(other *Resource) bool {
 	if r == other {
 		return true
 	}
@@ -51,6 +51,97 @@ func TestNew(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			description: "resource that opts out of waiting",
+			head: Head{
+				Kind: Deployment,
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						WaitAnnotation: NoWait,
+					},
+				},
+			},
+			expected: &Resource{Kind: Deployment, Name: "foo", SkipWait: true},
+		},
+		{
+			description: "resource with custom wait condition",
+			head: Head{
+				Kind: "Certificate",
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						WaitAnnotation: "condition=Ready",
+					},
+				},
+			},
+			expected: &Resource{Kind: "Certificate", Name: "foo", WaitFor: "condition=Ready"},
+		},
+		{
+			description: "resource with keep deletion policy",
+			head: Head{
+				Kind: "Namespace",
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						DeletionPolicyAnnotation: KeepPolicy,
+					},
+				},
+			},
+			expected: &Resource{Kind: "Namespace", Name: "foo", Keep: true},
+		},
+		{
+			description: "resource with recreate update strategy",
+			head: Head{
+				Kind: Job,
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						UpdateStrategyAnnotation: RecreateUpdateStrategy,
+					},
+				},
+			},
+			expected: &Resource{Kind: Job, Name: "foo", UpdateStrategy: RecreateUpdateStrategy},
+		},
+		{
+			description: "resource with unsupported update strategy",
+			head: Head{
+				Kind: Job,
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						UpdateStrategyAnnotation: "replace",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			description: "resource with apply weight",
+			head: Head{
+				Kind: "Issuer",
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						ApplyWeightAnnotation: "-5",
+					},
+				},
+			},
+			expected: &Resource{Kind: "Issuer", Name: "foo", ApplyWeight: -5},
+		},
+		{
+			description: "resource with invalid apply weight",
+			head: Head{
+				Kind: "Issuer",
+				Metadata: Metadata{
+					Name: "foo",
+					Annotations: map[string]string{
+						ApplyWeightAnnotation: "first",
+					},
+				},
+			},
+			expectError: true,
+		},
 		{
 			description: "resource that does not support deletion policy annotation",
 			head: Head{
@@ -21,6 +21,23 @@ func (s Slice) Sort(order Order) Slice {
 	return sortResources(s, order)
 }
 
+// Partition splits the slice into the resources for which f returns true and
+// all other resources. The order of resources is preserved.
+func (s Slice) Partition(f func(*Resource) bool) (Slice, Slice) {
+	matching := make(Slice, 0)
+	other := make(Slice, 0)
+
+	for _, r := range s {
+		if f(r) {
+			matching = append(matching, r)
+		} else {
+			other = append(other, r)
+		}
+	}
+
+	return matching, other
+}
+
 // String implements fmt.Stringer
 func (s Slice) String() string {
 	names := make([]string, len(s))
@@ -32,6 +49,19 @@ func (s Slice) String() string {
 	return strings.Join(names, "\n")
 }
 
+// FindMovedGroup searches haystack for a resource with the same kind, name
+// and namespace as needle, but a different API group and returns it if found,
+// nil otherwise.
+func FindMovedGroup(haystack []*Resource, needle *Resource) (*Resource, bool) {
+	for _, r := range haystack {
+		if r.matchesIgnoringGroup(needle) && !r.matches(needle) {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
 // FindMatching searches haystack for a resource matching needle and returns it
 // if found, nil otherwise.
 func FindMatching(haystack []*Resource, needle *Resource) (*Resource, bool) {
@@ -110,3 +110,89 @@ func TestFindMatching(t *testing.T) {
 		})
 	}
 }
+
+func TestSlice_Partition(t *testing.T) {
+	s := Slice{
+		{Kind: CustomResourceDefinition, Name: "foo"},
+		{Kind: Deployment, Name: "bar"},
+		{Kind: CustomResourceDefinition, Name: "baz"},
+	}
+
+	crds, rest := s.Partition(func(r *Resource) bool {
+		return r.Kind == CustomResourceDefinition
+	})
+
+	assert.Equal(t, Slice{s[0], s[2]}, crds)
+	assert.Equal(t, Slice{s[1]}, rest)
+}
+
+func TestFindMatchingAPIGroup(t *testing.T) {
+	resources := []*Resource{
+		{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "foo"},
+		{APIVersion: "apps/v1beta2", Kind: "Deployment", Name: "foo"},
+		{APIVersion: "v1", Kind: "Service", Name: "foo"},
+		{APIVersion: "example.com/v1", Kind: "Certificate", Name: "foo"},
+	}
+
+	cases := []struct {
+		description string
+		r           *Resource
+		expected    *Resource
+	}{
+		{
+			description: "different API group",
+			r:           &Resource{APIVersion: "example.org/v1", Kind: "Certificate", Name: "foo"},
+		},
+		{
+			description: "aliased API group",
+			r:           &Resource{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo"},
+			expected:    resources[0],
+		},
+		{
+			description: "API group is only aliased for some kinds",
+			r:           &Resource{APIVersion: "networking.k8s.io/v1", Kind: "Certificate", Name: "foo"},
+		},
+		{
+			description: "different version of the same API group",
+			r:           &Resource{APIVersion: "apps/v1", Kind: "Deployment", Name: "foo"},
+			expected:    resources[1],
+		},
+		{
+			description: "core API group",
+			r:           &Resource{APIVersion: "v1", Kind: "Service", Name: "foo"},
+			expected:    resources[2],
+		},
+		{
+			description: "legacy resource without API version",
+			r:           &Resource{Kind: "Ingress", Name: "foo"},
+			expected:    resources[0],
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, ok := FindMatching(resources, tc.r)
+
+			assert.Equal(t, tc.expected != nil, ok)
+			assert.Equal(t, tc.expected, r)
+		})
+	}
+}
+
+func TestFindMovedGroup(t *testing.T) {
+	resources := []*Resource{
+		{APIVersion: "example.com/v1", Kind: "Certificate", Name: "foo"},
+		{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "foo"},
+	}
+
+	r, ok := FindMovedGroup(resources, &Resource{APIVersion: "example.org/v1", Kind: "Certificate", Name: "foo"})
+	assert.True(t, ok)
+	assert.Equal(t, resources[0], r)
+
+	_, ok = FindMovedGroup(resources, &Resource{APIVersion: "example.com/v2", Kind: "Certificate", Name: "foo"})
+	assert.False(t, ok)
+
+	// Aliased groups serve the same objects, so this is not a move.
+	_, ok = FindMovedGroup(resources, &Resource{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo"})
+	assert.False(t, ok)
+}
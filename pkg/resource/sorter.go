@@ -2,13 +2,25 @@
 
 package resource
 
-import "sort"
-
-// Order is a slice of strings that defines the ordering of resources.
-type Order []string
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Order defines the ordering of resources. Resources are sorted by their
+// apply weight first, then by the position of their kind in Kinds and
+// finally by name. Kinds that are not part of Kinds (e.g. custom resources)
+// are sorted alphabetically after all known kinds, or before them if Delete
+// is true. Delete also reverses the order of apply weights.
+type Order struct {
+	Kinds  []string
+	Delete bool
+}
 
 // ApplyOrder is the resource order for apply operations.
-var ApplyOrder Order = []string{
+var ApplyOrder = Order{Kinds: []string{
 	"Namespace",
 	"ResourceQuota",
 	"LimitRange",
@@ -36,10 +48,10 @@ var ApplyOrder Order = []string{
 	"CronJob",
 	"Ingress",
 	"APIService",
-}
+}}
 
 // DeleteOrder is the resource order for delete operations.
-var DeleteOrder Order = []string{
+var DeleteOrder = Order{Delete: true, Kinds: []string{
 	"APIService",
 	"Ingress",
 	"Service",
@@ -67,6 +79,94 @@ var DeleteOrder Order = []string{
 	"LimitRange",
 	"ResourceQuota",
 	"Namespace",
+}}
+
+// KindPlacement places a kind before or after another kind in the apply
+// order. The delete order is adjusted accordingly.
+type KindPlacement struct {
+	Kind   string `json:"kind" yaml:"kind"`
+	Before string `json:"before,omitempty" yaml:"before,omitempty"`
+	After  string `json:"after,omitempty" yaml:"after,omitempty"`
+}
+
+// Validate returns an error if p is not a valid placement.
+func (p KindPlacement) Validate() error {
+	switch {
+	case p.Kind == "":
+		return errors.New("kind placement is missing the kind")
+	case p.Before == "" && p.After == "":
+		return errors.Errorf("kind placement for %s needs one of before or after", p.Kind)
+	case p.Before != "" && p.After != "":
+		return errors.Errorf("kind placement for %s cannot have both before and after", p.Kind)
+	case p.Before == p.Kind || p.After == p.Kind:
+		return errors.Errorf("kind %s cannot be placed relative to itself", p.Kind)
+	default:
+		return nil
+	}
+}
+
+// Extend returns a copy of o with the placements applied in the given order.
+// Kinds that are already part of o are moved. The kinds referenced by before
+// and after must be known, either because they are already part of o or
+// because they were placed by a preceding placement. Placements are always
+// expressed in terms of the apply order and are inverted if o is a delete
+// order.
+func (o Order) Extend(placements []KindPlacement) (Order, error) {
+	kinds := make([]string, len(o.Kinds))
+	copy(kinds, o.Kinds)
+
+	for _, p := range placements {
+		if err := p.Validate(); err != nil {
+			return o, err
+		}
+
+		kinds = removeKind(kinds, p.Kind)
+
+		ref, after := p.Before, false
+		if p.After != "" {
+			ref, after = p.After, true
+		}
+
+		if o.Delete {
+			after = !after
+		}
+
+		pos := indexOfKind(kinds, ref)
+		if pos < 0 {
+			return o, errors.Errorf("cannot place kind %s relative to unknown kind %s", p.Kind, ref)
+		}
+
+		if after {
+			pos++
+		}
+
+		kinds = append(kinds[:pos], append([]string{p.Kind}, kinds[pos:]...)...)
+	}
+
+	return Order{Kinds: kinds, Delete: o.Delete}, nil
+}
+
+// String implements fmt.Stringer.
+func (o Order) String() string {
+	return strings.Join(o.Kinds, ", ")
+}
+
+func indexOfKind(kinds []string, kind string) int {
+	for i, k := range kinds {
+		if k == kind {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func removeKind(kinds []string, kind string) []string {
+	if i := indexOfKind(kinds, kind); i >= 0 {
+		return append(kinds[:i], kinds[i+1:]...)
+	}
+
+	return kinds
 }
 
 type resourceSorter struct {
@@ -78,17 +178,14 @@ type resourceSorter struct {
 func newResourceSorter(resources []*Resource, order Order) *resourceSorter {
 	o := make(map[string]int)
 
-	for k, v := range order {
+	for k, v := range order.Kinds {
 		o[v] = k
 	}
 
 	return &resourceSorter{
 		resources: resources,
 		order:     o,
-		// TODO(mohmann): this is a little hacky and needs to be improved. We
-		// need a way to make the sorter aware of the fact that custom
-		// resources should be deleted before their CustomResourceDefinition.
-		isDelete: order[len(order)-1] == "Namespace",
+		isDelete:  order.Delete,
 	}
 }
 
@@ -106,6 +203,14 @@ func (s *resourceSorter) Swap(i, j int) {
 func (s *resourceSorter) Less(i, j int) bool {
 	a, b := s.resources[i], s.resources[j]
 
+	if a.ApplyWeight != b.ApplyWeight {
+		if s.isDelete {
+			return a.ApplyWeight > b.ApplyWeight
+		}
+
+		return a.ApplyWeight < b.ApplyWeight
+	}
+
 	aPos, aok := s.order[a.Kind]
 	bPos, bok := s.order[b.Kind]
 
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var unsorted = Slice{
@@ -49,3 +50,99 @@ func TestSlice_SortDeleteOrder(t *testing.T) {
 
 	assert.Equal(t, expected, unsorted.Sort(DeleteOrder))
 }
+
+func TestSlice_SortApplyWeight(t *testing.T) {
+	s := Slice{
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "Issuer", Name: "foo", ApplyWeight: -1},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "ConfigMap", Name: "bar", ApplyWeight: 10},
+	}
+
+	expectedApply := Slice{
+		{Kind: "Issuer", Name: "foo", ApplyWeight: -1},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "ConfigMap", Name: "bar", ApplyWeight: 10},
+	}
+
+	assert.Equal(t, expectedApply, s.Sort(ApplyOrder))
+
+	expectedDelete := Slice{
+		{Kind: "ConfigMap", Name: "bar", ApplyWeight: 10},
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "Issuer", Name: "foo", ApplyWeight: -1},
+	}
+
+	assert.Equal(t, expectedDelete, s.Sort(DeleteOrder))
+}
+
+func TestOrder_Extend(t *testing.T) {
+	placements := []KindPlacement{
+		{Kind: "Issuer", Before: "Ingress"},
+		{Kind: "ClusterIssuer", After: "Issuer"},
+		{Kind: "Namespace", After: "APIService"},
+	}
+
+	applyOrder, err := ApplyOrder.Extend(placements)
+	require.NoError(t, err)
+
+	deleteOrder, err := DeleteOrder.Extend(placements)
+	require.NoError(t, err)
+
+	s := Slice{
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "ClusterIssuer", Name: "foo"},
+		{Kind: "Prometheus", Name: "foo"},
+		{Kind: "Issuer", Name: "foo"},
+		{Kind: "Deployment", Name: "foo"},
+	}
+
+	expectedApply := Slice{
+		{Kind: "Deployment", Name: "foo"},
+		{Kind: "Issuer", Name: "foo"},
+		{Kind: "ClusterIssuer", Name: "foo"},
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "Prometheus", Name: "foo"},
+	}
+
+	assert.Equal(t, expectedApply, s.Sort(applyOrder))
+
+	expectedDelete := Slice{
+		{Kind: "Prometheus", Name: "foo"},
+		{Kind: "Namespace", Name: "foo"},
+		{Kind: "Ingress", Name: "foo"},
+		{Kind: "ClusterIssuer", Name: "foo"},
+		{Kind: "Issuer", Name: "foo"},
+		{Kind: "Deployment", Name: "foo"},
+	}
+
+	assert.Equal(t, expectedDelete, s.Sort(deleteOrder))
+
+	// the default orders are not modified
+	assert.Equal(t, "Namespace", ApplyOrder.Kinds[0])
+	assert.Equal(t, "Namespace", DeleteOrder.Kinds[len(DeleteOrder.Kinds)-1])
+}
+
+func TestOrder_ExtendErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		placements []KindPlacement
+	}{
+		{name: "missing kind", placements: []KindPlacement{{Before: "Ingress"}}},
+		{name: "missing reference", placements: []KindPlacement{{Kind: "Issuer"}}},
+		{name: "before and after", placements: []KindPlacement{{Kind: "Issuer", Before: "Ingress", After: "Service"}}},
+		{name: "relative to itself", placements: []KindPlacement{{Kind: "Issuer", Before: "Issuer"}}},
+		{name: "unknown reference", placements: []KindPlacement{{Kind: "Issuer", Before: "Certificate"}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ApplyOrder.Extend(tc.placements)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -85,3 +85,44 @@ func (s Slice) PersistentVolumeClaimsForDeletion() Slice {
 
 	return claims.WithHint(Removal)
 }
+
+// PersistentVolumeClaimsOrphanedByUpdate extracts the PersistentVolumeClaims
+// that are not used anymore after updating StatefulSets that have been
+// annotated with the delete-pvcs deletion policy. This is the case if a
+// StatefulSet was scaled down or if volume claim templates were removed or
+// renamed. The previous state of a StatefulSet is taken from its content
+// hint, StatefulSets without content hint are ignored.
+func (s Slice) PersistentVolumeClaimsOrphanedByUpdate() Slice {
+	claims := make(Slice, 0)
+
+	for _, r := range s {
+		if r.Kind != StatefulSet || !r.DeletePersistentVolumeClaims || r.contentHint == nil {
+			continue
+		}
+
+		var current, next partialStatefulSet
+
+		if err := yaml.Unmarshal(r.contentHint, &current); err != nil {
+			log.Errorf("error while parsing stateful set %q: %s", r.Name, err.Error())
+			continue
+		}
+
+		if err := yaml.Unmarshal(r.Content, &next); err != nil {
+			log.Errorf("error while parsing stateful set %q: %s", r.Name, err.Error())
+			continue
+		}
+
+		used := make(map[string]bool)
+		for _, claim := range buildPersistentVolumeClaims(&next) {
+			used[claim.Namespace+"/"+claim.Name] = true
+		}
+
+		for _, claim := range buildPersistentVolumeClaims(&current) {
+			if !used[claim.Namespace+"/"+claim.Name] {
+				claims = append(claims, claim)
+			}
+		}
+	}
+
+	return claims.WithHint(Removal)
+}
@@ -63,3 +63,54 @@ spec:
 
 	assert.Equal(t, expected, pvcs)
 }
+
+func TestSlice_PersistentVolumeClaimsOrphanedByUpdate(t *testing.T) {
+	current := []byte(`---
+kind: StatefulSet
+metadata:
+  name: web
+  namespace: foo
+spec:
+  replicas: 3
+  volumeClaimTemplates:
+  - metadata:
+      name: www
+  - metadata:
+      name: cache
+`)
+
+	next := []byte(`---
+kind: StatefulSet
+metadata:
+  name: web
+  namespace: foo
+spec:
+  replicas: 2
+  volumeClaimTemplates:
+  - metadata:
+      name: www
+  - metadata:
+      name: tmp
+`)
+
+	s := Slice{
+		(&Resource{Kind: StatefulSet, Name: "web", Namespace: "foo", DeletePersistentVolumeClaims: true, Content: next}).
+			WithContentHint(current),
+		(&Resource{Kind: StatefulSet, Name: "web", Namespace: "foo", Content: next}).
+			WithContentHint(current),
+		{Kind: StatefulSet, Name: "web", Namespace: "foo", DeletePersistentVolumeClaims: true, Content: next},
+		(&Resource{Kind: StatefulSet, Name: "web", Namespace: "foo", DeletePersistentVolumeClaims: true, Content: current}).
+			WithContentHint(next),
+	}
+
+	expected := Slice{
+		{Kind: PersistentVolumeClaim, Name: "www-web-2", Namespace: "foo", hint: Removal},
+		{Kind: PersistentVolumeClaim, Name: "cache-web-0", Namespace: "foo", hint: Removal},
+		{Kind: PersistentVolumeClaim, Name: "cache-web-1", Namespace: "foo", hint: Removal},
+		{Kind: PersistentVolumeClaim, Name: "cache-web-2", Namespace: "foo", hint: Removal},
+		{Kind: PersistentVolumeClaim, Name: "tmp-web-0", Namespace: "foo", hint: Removal},
+		{Kind: PersistentVolumeClaim, Name: "tmp-web-1", Namespace: "foo", hint: Removal},
+	}
+
+	assert.Equal(t, expected, s.PersistentVolumeClaimsOrphanedByUpdate())
+}
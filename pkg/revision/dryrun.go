@@ -0,0 +1,109 @@
+package revision
+
+import (
+	"context"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/hook"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
+	"github.com/martinohmann/kubernetes-cluster-manager/pkg/resource"
+	"github.com/pkg/errors"
+)
+
+// serverDryRun returns true if resources should be sent to the API server
+// using server-side dry run instead of being skipped in dry-run mode.
+func (u *upgrader) serverDryRun() bool {
+	return u.options.DryRun && u.options.ServerDryRun
+}
+
+// dryRunApply sends every resource in r to the API server using a
+// server-side dry run of kubectl apply. Errors are collected per resource
+// instead of aborting at the first one. Custom resources whose
+// CustomResourceDefinition is part of r, resources whose Namespace is part of
+// r and resources for which recreated returns true cannot be validated
+// reliably, since neither the creation of the CRD or Namespace nor the
+// deletion preceding the recreation is persisted. Errors caused by this are
+// only logged.
+func (u *upgrader) dryRunApply(ctx context.Context, r resource.Slice, recreated func(*resource.Resource) bool) {
+	definedKinds := make(map[string]bool)
+	definedNamespaces := make(map[string]bool)
+
+	for _, res := range r {
+		if kind, _, err := res.CustomResourceScope(); err == nil && kind != "" {
+			definedKinds[kind] = true
+		}
+
+		if res.Kind == "Namespace" {
+			definedNamespaces[res.Name] = true
+		}
+	}
+
+	for _, res := range r.Sort(u.options.ApplyOrder) {
+		buf := resource.Slice{res}.Bytes()
+
+		if u.ownership != nil {
+			stamped, err := u.ownership.Stamp(res.Content)
+			if err != nil {
+				u.recordDryRunError(res, err)
+				continue
+			}
+
+			buf = resource.Slice{{Content: stamped}}.Bytes()
+		}
+
+		err := u.client.ApplyManifestDryRun(ctx, buf)
+
+		switch {
+		case err == nil:
+		case definedKinds[res.Kind] && strings.Contains(err.Error(), "no matches for kind"):
+			u.logger.Warnf("cannot validate %s before its CustomResourceDefinition is established", res)
+		case definedNamespaces[kubernetes.MissingNamespace(err)]:
+			u.logger.Warnf("cannot validate %s before its Namespace is created", res)
+		case recreated(res) && len(kubernetes.ImmutableFieldErrors(err)) > 0:
+			u.logger.Infof("%s would be recreated because immutable fields changed", res)
+		default:
+			u.recordDryRunError(res, err)
+		}
+	}
+}
+
+// dryRunDelete sends every resource in r to the API server using a
+// server-side dry run of kubectl delete. Errors are collected per resource.
+func (u *upgrader) dryRunDelete(ctx context.Context, r resource.Slice) {
+	for _, res := range r.Sort(u.options.DeleteOrder) {
+		err := u.client.DeleteManifestDryRun(ctx, resource.Slice{res}.Bytes())
+		if err != nil {
+			u.recordDryRunError(res, err)
+		}
+	}
+}
+
+// dryRunHooks validates the resources of hooks using a server-side dry run.
+// Hooks that are deleted before their creation are treated as recreated.
+func (u *upgrader) dryRunHooks(ctx context.Context, hooks hook.Slice) {
+	recreated := make(map[*resource.Resource]bool)
+
+	for _, h := range hooks {
+		recreated[h.Resource] = h.DeleteBeforeCreation
+	}
+
+	u.dryRunApply(ctx, hooks.Resources(), func(r *resource.Resource) bool {
+		return recreated[r]
+	})
+}
+
+// recordDryRunError records err as the server-side dry-run result of res.
+func (u *upgrader) recordDryRunError(res *resource.Resource, err error) {
+	u.dryRunErrs = multierror.Append(u.dryRunErrs, errors.Wrapf(err, "server dry run of %s failed", res))
+}
+
+// dryRunResult returns err if it is non-nil and the errors collected during
+// a server-side dry run otherwise.
+func (u *upgrader) dryRunResult(err error) error {
+	if err != nil || u.dryRunErrs == nil {
+		return err
+	}
+
+	return u.dryRunErrs.ErrorOrNil()
+}
@@ -27,13 +27,29 @@ type ChangeSet struct {
 	UnchangedResources resource.Slice
 	RemovedResources   resource.Slice
 
+	// ReplacedResources are updated resources with changes to immutable
+	// fields that need to be deleted and recreated.
+	ReplacedResources resource.Slice
+
+	// MovedResources are resources that moved to an API group which is not
+	// an alias of their previous one. Their next versions are part of
+	// AddedResources, their current versions are part of RemovedResources.
+	MovedResources []MovedResource
+
+	// ImmutableFieldUpdates are updated resources that change known
+	// immutable fields, but do not have the recreate update strategy.
+	// Applying them will fail.
+	ImmutableFieldUpdates []ImmutableFieldUpdate
+
 	Hooks hook.SliceMap
 }
 
 // HasResourceChanges returns true if there are resource changes waiting to be
-// applied. Resource changes are resource additions, deletions and updates.
+// applied. Resource changes are resource additions, deletions, updates and
+// replacements.
 func (c *ChangeSet) HasResourceChanges() bool {
-	return len(c.AddedResources) > 0 || len(c.UpdatedResources) > 0 || len(c.RemovedResources) > 0
+	return len(c.AddedResources) > 0 || len(c.UpdatedResources) > 0 ||
+		len(c.RemovedResources) > 0 || len(c.ReplacedResources) > 0
 }
 
 // Slice is a slice of revisions.
@@ -106,6 +122,19 @@ func NewSlice(current, next []*manifest.Manifest) Slice {
 	return revisions
 }
 
+// MovedResource is a resource that moved to a different API group.
+type MovedResource struct {
+	Current *resource.Resource
+	Next    *resource.Resource
+}
+
+// ImmutableFieldUpdate is an update of a resource that changes immutable
+// fields.
+type ImmutableFieldUpdate struct {
+	Resource *resource.Resource
+	Fields   []string
+}
+
 // ChangeSet creates a ChangeSet for r. The change set categorizes resources
 // into buckets (e.g. added, updated, unchanged, removed) and also contains the
 // most recent hooks for this revision.
@@ -137,17 +166,42 @@ func (r *Revision) ChangeSet() *ChangeSet {
 			c.RemovedResources = append(c.RemovedResources, current.WithHint(resource.Removal))
 		} else if bytes.Compare(current.Content, res.Content) == 0 {
 			c.UnchangedResources = append(c.UnchangedResources, res)
+		} else if fields := immutableFieldChanges(current, res); len(fields) > 0 && res.Recreate() {
+			c.ReplacedResources = append(c.ReplacedResources, res.WithHint(resource.Replace).WithContentHint(current.Content))
 		} else {
 			c.UpdatedResources = append(c.UpdatedResources, res.WithHint(resource.Update).WithContentHint(current.Content))
+
+			if len(fields) > 0 {
+				c.ImmutableFieldUpdates = append(c.ImmutableFieldUpdates, ImmutableFieldUpdate{Resource: res, Fields: fields})
+			}
 		}
 	}
 
 	for _, next := range r.Next.Resources {
 		_, ok := resource.FindMatching(r.Current.Resources, next)
-		if !ok {
-			c.AddedResources = append(c.AddedResources, next.WithHint(resource.Addition))
+		if ok {
+			continue
+		}
+
+		c.AddedResources = append(c.AddedResources, next.WithHint(resource.Addition))
+
+		if current, ok := resource.FindMovedGroup(c.RemovedResources, next); ok {
+			c.MovedResources = append(c.MovedResources, MovedResource{Current: current, Next: next})
 		}
 	}
 
 	return c
 }
+
+// immutableFieldChanges returns the paths of the known immutable fields that
+// the update from current to next changes. Content that cannot be parsed is
+// treated as not changing any immutable fields, applying it will surface the
+// error.
+func immutableFieldChanges(current, next *resource.Resource) []string {
+	fields, err := next.ImmutableFieldChanges(current.Content)
+	if err != nil {
+		return nil
+	}
+
+	return fields
+}
@@ -150,6 +150,9 @@ func TestRevision_ChangeSet(t *testing.T) {
 		updated     resource.Slice
 		unchanged   resource.Slice
 		removed     resource.Slice
+		replaced    resource.Slice
+		moved       []MovedResource
+		immutable   []ImmutableFieldUpdate
 		hooks       hook.SliceMap
 	}{
 		{
@@ -206,6 +209,89 @@ func TestRevision_ChangeSet(t *testing.T) {
 				hook.PreCreate: testHookNameSlice("baz"),
 			},
 		},
+		{
+			description: "moved API version",
+			revision: &Revision{
+				Current: &manifest.Manifest{
+					Resources: resource.Slice{
+						{APIVersion: "apps/v1beta2", Kind: "Deployment", Name: "foo", Content: []byte("apiVersion: apps/v1beta2")},
+						{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "foo", Content: []byte("apiVersion: extensions/v1beta1")},
+					},
+				},
+				Next: &manifest.Manifest{
+					Resources: resource.Slice{
+						{APIVersion: "apps/v1", Kind: "Deployment", Name: "foo", Content: []byte("apiVersion: apps/v1")},
+						{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo", Content: []byte("apiVersion: networking.k8s.io/v1")},
+					},
+				},
+			},
+			updated: resource.Slice{
+				(&resource.Resource{APIVersion: "apps/v1", Kind: "Deployment", Name: "foo", Content: []byte("apiVersion: apps/v1")}).
+					WithContentHint([]byte("apiVersion: apps/v1beta2")),
+				(&resource.Resource{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "foo", Content: []byte("apiVersion: networking.k8s.io/v1")}).
+					WithContentHint([]byte("apiVersion: extensions/v1beta1")),
+			}.WithHint(resource.Update),
+		},
+		{
+			description: "moved API group",
+			revision: &Revision{
+				Current: &manifest.Manifest{
+					Resources: resource.Slice{
+						{APIVersion: "example.com/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.com/v1")},
+					},
+				},
+				Next: &manifest.Manifest{
+					Resources: resource.Slice{
+						{APIVersion: "example.org/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.org/v1")},
+					},
+				},
+			},
+			added: resource.Slice{
+				{APIVersion: "example.org/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.org/v1")},
+			}.WithHint(resource.Addition),
+			removed: resource.Slice{
+				{APIVersion: "example.com/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.com/v1")},
+			}.WithHint(resource.Removal),
+			moved: []MovedResource{
+				{
+					Current: (&resource.Resource{APIVersion: "example.com/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.com/v1")}).WithHint(resource.Removal),
+					Next:    (&resource.Resource{APIVersion: "example.org/v1", Kind: "Certificate", Name: "foo", Content: []byte("apiVersion: example.org/v1")}).WithHint(resource.Addition),
+				},
+			},
+		},
+		{
+			description: "immutable field changes",
+			revision: &Revision{
+				Current: &manifest.Manifest{
+					Resources: resource.Slice{
+						{Kind: resource.Job, Name: "foo", Content: []byte("spec:\n  template: foo\n")},
+						{Kind: resource.Job, Name: "bar", Content: []byte("spec:\n  template: foo\n")},
+					},
+				},
+				Next: &manifest.Manifest{
+					Resources: resource.Slice{
+						{Kind: resource.Job, Name: "foo", UpdateStrategy: resource.RecreateUpdateStrategy, Content: []byte("spec:\n  template: bar\n")},
+						{Kind: resource.Job, Name: "bar", Content: []byte("spec:\n  template: bar\n")},
+					},
+				},
+			},
+			updated: resource.Slice{
+				(&resource.Resource{Kind: resource.Job, Name: "bar", Content: []byte("spec:\n  template: bar\n")}).
+					WithContentHint([]byte("spec:\n  template: foo\n")),
+			}.WithHint(resource.Update),
+			replaced: resource.Slice{
+				(&resource.Resource{Kind: resource.Job, Name: "foo", UpdateStrategy: resource.RecreateUpdateStrategy, Content: []byte("spec:\n  template: bar\n")}).
+					WithContentHint([]byte("spec:\n  template: foo\n")),
+			}.WithHint(resource.Replace),
+			immutable: []ImmutableFieldUpdate{
+				{
+					Resource: (&resource.Resource{Kind: resource.Job, Name: "bar", Content: []byte("spec:\n  template: bar\n")}).
+						WithHint(resource.Update).
+						WithContentHint([]byte("spec:\n  template: foo\n")),
+					Fields: []string{"spec.template"},
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -216,6 +302,9 @@ func TestRevision_ChangeSet(t *testing.T) {
 			assert.Equal(t, tc.updated, c.UpdatedResources)
 			assert.Equal(t, tc.unchanged, c.UnchangedResources)
 			assert.Equal(t, tc.removed, c.RemovedResources)
+			assert.Equal(t, tc.replaced, c.ReplacedResources)
+			assert.Equal(t, tc.moved, c.MovedResources)
+			assert.Equal(t, tc.immutable, c.ImmutableFieldUpdates)
 			assert.Equal(t, tc.hooks, c.Hooks)
 		})
 	}
@@ -5,6 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/gammazero/workerpool"
@@ -24,8 +27,20 @@ const (
 	// MaxWorkers is the maximum number of go-routines to use for concurrent
 	// actions.
 	MaxWorkers = 10
+
+	// DefaultWaitTimeout is the time to wait for the resources of a component
+	// to become ready if no timeout is configured.
+	DefaultWaitTimeout = 5 * time.Minute
 )
 
+// apiExtensionConditions maps the kinds of resources that extend the
+// Kubernetes API to the condition that signals that the new API types are
+// ready to be used.
+var apiExtensionConditions = map[string]string{
+	resource.CustomResourceDefinition: "condition=Established",
+	resource.APIService:               "condition=Available",
+}
+
 // Client applies and deletes manifests from a cluster.
 type Client interface {
 	// ApplyManifest applies raw manifest bytes.
@@ -34,11 +49,31 @@ type Client interface {
 	// DeleteManifest deletes raw manifest bytes.
 	DeleteManifest(context.Context, []byte) error
 
+	// ApplyManifestDryRun and DeleteManifestDryRun send raw manifest bytes
+	// to the API server using server-side dry run.
+	ApplyManifestDryRun(context.Context, []byte) error
+	DeleteManifestDryRun(context.Context, []byte) error
+
 	// DeleteResource deletes a resource by its kind, name and namespace.
 	DeleteResource(context.Context, resource.Head) error
 
 	// Wait waits for a resource condition to be met.
 	Wait(context.Context, kubernetes.WaitOptions) error
+
+	// RolloutStatus waits for the rollout of a workload resource to
+	// complete.
+	RolloutStatus(context.Context, kubernetes.RolloutStatusOptions) error
+
+	// RefreshDiscovery refreshes the client's view of the API types
+	// available in the cluster.
+	RefreshDiscovery(context.Context) error
+
+	// RemoveLabels removes labels from a resource.
+	RemoveLabels(context.Context, resource.Head, ...string) error
+
+	// Logs returns the recent logs of a Pod or of one of the pods of a
+	// workload resource.
+	Logs(context.Context, resource.Head) (string, error)
 }
 
 // Upgrader handles revision upgrades.
@@ -59,6 +94,30 @@ type UpgraderOptions struct {
 	NoSave           bool
 	ManifestsDir     string
 	FullDiff         bool
+
+	// Wait enables waiting for applied resources to become ready before a
+	// component upgrade is considered successful. WaitTimeout is the
+	// maximum time to wait per component. ComponentWaitTimeouts override
+	// WaitTimeout for the components with matching names.
+	Wait                  bool
+	WaitTimeout           time.Duration
+	ComponentWaitTimeouts map[string]time.Duration
+
+	// ApplyOrder and DeleteOrder define the order in which resources are
+	// applied and deleted. resource.ApplyOrder and resource.DeleteOrder are
+	// used if unset.
+	ApplyOrder  resource.Order
+	DeleteOrder resource.Order
+
+	// InstanceID identifies the kcm instance. If set, all applied resources
+	// are labeled with it and with the name of their component.
+	InstanceID string
+
+	// ServerDryRun sends resources and hooks to the API server using
+	// server-side dry run instead of skipping them. It only has an effect
+	// if DryRun is set. Errors are collected per resource and returned at
+	// the end of the upgrade.
+	ServerDryRun bool
 }
 
 // upgrader is an implementations of Upgrader.
@@ -68,6 +127,9 @@ type upgrader struct {
 	resourcePrinter *resource.Printer
 	diffPrinter     *diff.Printer
 	logger          *logrus.Entry
+	ownership       *resource.Ownership
+	dryRunErrs      *multierror.Error
+	component       string
 }
 
 // NewUpgrader creates a new Upgrader with client and options.
@@ -76,6 +138,14 @@ func NewUpgrader(client Client, o *UpgraderOptions) Upgrader {
 		o = &UpgraderOptions{}
 	}
 
+	if len(o.ApplyOrder.Kinds) == 0 {
+		o.ApplyOrder = resource.ApplyOrder
+	}
+
+	if len(o.DeleteOrder.Kinds) == 0 {
+		o.DeleteOrder = resource.DeleteOrder
+	}
+
 	u := &upgrader{
 		client:  client,
 		options: o,
@@ -97,13 +167,31 @@ func (u *upgrader) Upgrade(ctx context.Context, rev *Revision) error {
 	manifest := rev.Manifest()
 	filename := filepath.Join(u.options.ManifestsDir, manifest.Filename())
 
-	u.logger.Infof("starting upgrade for component %s", manifest.Name)
+	if manifest.Source != "" {
+		u.logger.Infof("starting upgrade for component %s from %s", manifest.Name, manifest.Source)
+	} else {
+		u.logger.Infof("starting upgrade for component %s", manifest.Name)
+	}
 
 	u.setupUpgradeContext(manifest.Name)
 	defer u.resetUpgradeContext()
 
+	if u.options.InstanceID != "" {
+		u.ownership = &resource.Ownership{
+			InstanceID: u.options.InstanceID,
+			Component:  manifest.Name,
+			Revision:   resource.Revision(manifest.Content()),
+		}
+
+		if err := u.ownership.Validate(); err != nil {
+			return err
+		}
+	}
+
 	changeSet := rev.ChangeSet()
 
+	u.warnAboutChangeSet(changeSet)
+
 	if u.options.FullDiff {
 		u.diffPrinter.Print(rev.DiffOptions())
 	}
@@ -117,7 +205,7 @@ func (u *upgrader) Upgrade(ctx context.Context, rev *Revision) error {
 			}
 		}
 
-		return err
+		return u.dryRunResult(err)
 	}
 
 	if rev.IsInitial() {
@@ -130,7 +218,25 @@ func (u *upgrader) Upgrade(ctx context.Context, rev *Revision) error {
 		return ioutil.WriteFile(filename, manifest.Content(), 0660)
 	}
 
-	return err
+	return u.dryRunResult(err)
+}
+
+// warnAboutChangeSet logs warnings about changes in changeSet that may
+// have unexpected effects.
+func (u *upgrader) warnAboutChangeSet(changeSet *ChangeSet) {
+	for _, m := range changeSet.MovedResources {
+		u.logger.Warnf(
+			"%s moved from API version %s to %s in a different API group, it will be deleted and recreated",
+			m.Next, m.Current.APIVersion, m.Next.APIVersion,
+		)
+	}
+
+	for _, f := range changeSet.ImmutableFieldUpdates {
+		u.logger.Warnf(
+			"update of %s changes immutable fields (%s) and will fail, set the %s annotation to %q to recreate it",
+			f.Resource, strings.Join(f.Fields, ", "), resource.UpdateStrategyAnnotation, resource.RecreateUpdateStrategy,
+		)
+	}
 }
 
 // processManifestDeletion delete all manifest resources from the cluster. It
@@ -139,16 +245,18 @@ func (u *upgrader) Upgrade(ctx context.Context, rev *Revision) error {
 // policy.
 func (u *upgrader) processManifestDeletion(ctx context.Context, manifest *manifest.Manifest) error {
 	return u.wrapHooks(ctx, manifest.Hooks, hook.Delete, func() error {
+		resources := u.releaseKeptResources(ctx, manifest.Resources)
+
 		u.logger.Warn("deleting all resources")
 
-		u.resourcePrinter.PrintSlice(manifest.Resources)
+		u.resourcePrinter.PrintSlice(resources)
 
-		err := u.deleteResources(ctx, manifest.Resources)
+		err := u.deleteResources(ctx, resources)
 		if err != nil {
 			return err
 		}
 
-		claims := manifest.Resources.PersistentVolumeClaimsForDeletion()
+		claims := resources.PersistentVolumeClaimsForDeletion()
 
 		return u.deletePersistentVolumeClaims(ctx, manifest, claims)
 	})
@@ -162,34 +270,53 @@ func (u *upgrader) processManifestCreation(ctx context.Context, manifest *manife
 
 		u.resourcePrinter.PrintSlice(manifest.Resources)
 
-		return u.applyResources(ctx, manifest.Resources)
+		err := u.applyResources(ctx, manifest.Resources)
+		if err != nil {
+			return err
+		}
+
+		return u.waitForResources(ctx, manifest.Resources)
 	})
 }
 
 // processManifestUpdate will update resources that have changed and delete
 // resources that disappeared from the manifest and also remove
-// PersistentVolumeClaims of StatefulSets that were removed and had the
-// delete-pvcs deletion policy enabled. It will run the pre-upgrade and
-// post-upgrade hooks.
+// PersistentVolumeClaims of StatefulSets that had the delete-pvcs deletion
+// policy enabled and were either removed, scaled down or had volume claim
+// templates removed. It will run the pre-upgrade and post-upgrade hooks.
 func (u *upgrader) processManifestUpdate(ctx context.Context, manifest *manifest.Manifest, changeSet *ChangeSet) error {
 	return u.wrapHooks(ctx, manifest.Hooks, hook.Upgrade, func() error {
+		removed := u.releaseKeptResources(ctx, changeSet.RemovedResources)
+
 		u.logger.Warn("deleting removed resources")
 
-		u.resourcePrinter.PrintSlice(changeSet.RemovedResources)
+		u.resourcePrinter.PrintSlice(removed)
 
-		err := u.deleteResources(ctx, changeSet.RemovedResources)
+		err := u.deleteResources(ctx, removed)
 		if err != nil {
 			return err
 		}
 
-		claims := changeSet.RemovedResources.PersistentVolumeClaimsForDeletion()
+		claims := removed.PersistentVolumeClaimsForDeletion()
 
 		err = u.deletePersistentVolumeClaims(ctx, manifest, claims)
 		if err != nil {
 			return err
 		}
 
-		resources := append(changeSet.AddedResources, changeSet.UpdatedResources...)
+		if len(changeSet.ReplacedResources) > 0 {
+			u.logger.Warnf("deleting %s for replacement", pluralize.Pluralize("resource", len(changeSet.ReplacedResources), true))
+
+			err = u.deleteResources(ctx, changeSet.ReplacedResources)
+			if err != nil {
+				return err
+			}
+		}
+
+		resources := make(resource.Slice, 0)
+		resources = append(resources, changeSet.AddedResources...)
+		resources = append(resources, changeSet.ReplacedResources...)
+		resources = append(resources, changeSet.UpdatedResources...)
 
 		if u.options.IncludeUnchanged {
 			resources = append(resources, changeSet.UnchangedResources...)
@@ -199,10 +326,69 @@ func (u *upgrader) processManifestUpdate(ctx context.Context, manifest *manifest
 
 		u.resourcePrinter.PrintSlice(resources)
 
-		return u.applyResources(ctx, resources)
+		err = u.applyResources(ctx, resources)
+		if err != nil {
+			return err
+		}
+
+		err = u.waitForResources(ctx, resources)
+		if err != nil {
+			return err
+		}
+
+		return u.deleteOrphanedPersistentVolumeClaims(ctx, manifest, resources)
 	})
 }
 
+// deleteOrphanedPersistentVolumeClaims removes the PersistentVolumeClaims
+// that are not used anymore by the updated StatefulSets in r. The claims are
+// only deleted after the rollout of the StatefulSets finished, even if
+// waiting for resources is disabled, so that the pods using them are gone.
+func (u *upgrader) deleteOrphanedPersistentVolumeClaims(ctx context.Context, manifest *manifest.Manifest, r resource.Slice) error {
+	claims := r.PersistentVolumeClaimsOrphanedByUpdate()
+	if len(claims) == 0 {
+		return nil
+	}
+
+	if !u.options.Wait && !u.options.DryRun {
+		statefulSets, _ := r.Partition(func(res *resource.Resource) bool {
+			return res.Kind == resource.StatefulSet && res.DeletePersistentVolumeClaims && !res.SkipWait
+		})
+
+		if err := u.awaitResources(ctx, statefulSets); err != nil {
+			return err
+		}
+	}
+
+	return u.deletePersistentVolumeClaims(ctx, manifest, claims)
+}
+
+// releaseKeptResources filters out the resources of r that have the keep
+// deletion policy and returns the remaining ones. The kept resources are left
+// in the cluster. If the upgrader is configured with an instance ID, their
+// ownership labels are removed so that they are not pruned later. Failing to
+// remove the labels is not fatal, the resource may not exist anymore.
+func (u *upgrader) releaseKeptResources(ctx context.Context, r resource.Slice) resource.Slice {
+	kept, rest := r.Partition(func(r *resource.Resource) bool {
+		return r.Keep
+	})
+
+	for _, res := range kept {
+		u.logger.Warnf("keeping %s due to deletion policy %q, it is not managed by kcm anymore", res, resource.KeepPolicy)
+
+		if u.options.DryRun || u.options.InstanceID == "" {
+			continue
+		}
+
+		err := u.client.RemoveLabels(ctx, res.Head(), resource.InstanceLabel, resource.ComponentLabel)
+		if err != nil {
+			u.logger.Warnf("failed to remove ownership labels from %s: %s", res, err.Error())
+		}
+	}
+
+	return rest
+}
+
 // deletePersistentVolumeClaims removes the PersistentVolumeClaims in the
 // claims slice from the cluster. This will be a no-op when dry-run mode is
 // enabled.
@@ -211,7 +397,7 @@ func (u *upgrader) deletePersistentVolumeClaims(ctx context.Context, manifest *m
 		return nil
 	}
 
-	u.logger.Warn("deleting pvcs of removed stateful sets")
+	u.logger.Warn("deleting orphaned pvcs of stateful sets")
 
 	u.resourcePrinter.PrintSlice(claims)
 
@@ -252,38 +438,291 @@ func (u *upgrader) wrapHooks(ctx context.Context, hooks hook.SliceMap, hookPair
 }
 
 // deleteResources deletes all resources in r from the cluster. This will be a
-// no-op when dry-run mode is enabled.
+// no-op when dry-run mode is enabled, unless server-side dry run is enabled.
 func (u *upgrader) deleteResources(ctx context.Context, r resource.Slice) error {
 	if len(r) == 0 {
 		return nil
 	}
 
+	if u.serverDryRun() {
+		u.dryRunDelete(ctx, r)
+		return nil
+	}
+
 	if u.options.DryRun {
 		u.logger.Debug("skipping resource deletions due to dry run")
 		return nil
 	}
 
-	return u.client.DeleteManifest(ctx, r.Sort(resource.DeleteOrder).Bytes())
+	return u.client.DeleteManifest(ctx, r.Sort(u.options.DeleteOrder).Bytes())
 }
 
-// applyResources applies all resources in r to the cluster. This will be a
-// no-op when dry-run mode is enabled.
+// applyResources applies all resources in r to the cluster. Since custom
+// resources cannot be applied before their CustomResourceDefinition is
+// established, CRDs are applied first and the remaining resources are only
+// applied after the CRDs became established. APIServices are applied along
+// with the remaining resources as they usually depend on them, but are waited
+// for as well so that the APIs they provide can be used afterwards. This will
+// be a no-op when dry-run mode is enabled, unless server-side dry run is
+// enabled.
 func (u *upgrader) applyResources(ctx context.Context, r resource.Slice) error {
 	if len(r) == 0 {
 		return nil
 	}
 
+	if u.serverDryRun() {
+		u.dryRunApply(ctx, r, (*resource.Resource).Recreate)
+		return nil
+	}
+
 	if u.options.DryRun {
 		u.logger.Debug("skipping resource updates due to dry run")
 		return nil
 	}
 
-	return u.client.ApplyManifest(ctx, r.Sort(resource.ApplyOrder).Bytes())
+	crds, rest := r.Partition(func(r *resource.Resource) bool {
+		return r.Kind == resource.CustomResourceDefinition
+	})
+
+	if len(crds) > 0 {
+		err := u.applyManifest(ctx, crds)
+		if err != nil {
+			return err
+		}
+
+		err = u.waitForAPIExtensions(ctx, crds)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	err := u.applyManifest(ctx, rest.Sort(u.options.ApplyOrder))
+	if err != nil {
+		return err
+	}
+
+	apiServices, _ := rest.Partition(func(r *resource.Resource) bool {
+		return r.Kind == resource.APIService
+	})
+
+	return u.waitForAPIExtensions(ctx, apiServices)
+}
+
+// applyManifest applies the resources in r. If applying fails because
+// immutable fields of resources with the recreate update strategy changed,
+// these resources are deleted and the resources are applied again.
+func (u *upgrader) applyManifest(ctx context.Context, r resource.Slice) error {
+	err := u.applyStampedManifest(ctx, r)
+
+	// Every retry recreates at least one resource, so the number of retries
+	// is bounded by the number of resources.
+	for i := 0; err != nil && i < len(r); i++ {
+		failed := kubernetes.ImmutableFieldErrors(err)
+		if len(failed) == 0 {
+			return err
+		}
+
+		recreate, rerr := findRecreatable(r, failed, err)
+		if rerr != nil {
+			return rerr
+		}
+
+		u.logger.Warnf("recreating %s because immutable fields changed", pluralize.Pluralize("resource", len(recreate), true))
+
+		u.resourcePrinter.PrintSlice(recreate.WithHint(resource.Replace))
+
+		if err := u.client.DeleteManifest(ctx, recreate.Sort(u.options.DeleteOrder).Bytes()); err != nil {
+			return err
+		}
+
+		err = u.applyStampedManifest(ctx, r)
+	}
+
+	return err
+}
+
+// findRecreatable returns the resources of r that failed to be applied due
+// to immutable field changes. If the namespace of a failed resource is known,
+// resources in other namespaces are not considered. An error is returned if
+// any of the failed resources does not have the recreate update strategy.
+func findRecreatable(r resource.Slice, failed []resource.Head, err error) (resource.Slice, error) {
+	recreate := make(resource.Slice, 0, len(failed))
+
+	for _, head := range failed {
+		found := false
+
+		for _, res := range r {
+			if res.Kind != head.Kind || res.Name != head.Metadata.Name {
+				continue
+			}
+
+			// Resources without namespace end up in the default namespace
+			// of the kubeconfig context, which is unknown here.
+			if head.Metadata.Namespace != "" && res.Namespace != "" && res.Namespace != head.Metadata.Namespace {
+				continue
+			}
+
+			if !res.Recreate() {
+				return nil, errors.Wrapf(
+					err,
+					"immutable fields of %s changed, set the %s annotation to %q to recreate it",
+					res, resource.UpdateStrategyAnnotation, resource.RecreateUpdateStrategy,
+				)
+			}
+
+			recreate = append(recreate, res)
+			found = true
+		}
+
+		if !found {
+			return nil, err
+		}
+	}
+
+	return recreate, nil
+}
+
+// applyStampedManifest applies the resources in r. If the upgrader is
+// configured with an instance ID, the resources are labeled with their owner
+// before.
+func (u *upgrader) applyStampedManifest(ctx context.Context, r resource.Slice) error {
+	if u.ownership == nil {
+		return u.client.ApplyManifest(ctx, r.Bytes())
+	}
+
+	buf, err := u.ownership.StampSlice(r)
+	if err != nil {
+		return err
+	}
+
+	return u.client.ApplyManifest(ctx, buf)
+}
+
+// waitForAPIExtensions waits for the CustomResourceDefinitions and
+// APIServices in r to become ready and refreshes the client's discovery
+// information afterwards, so that the new API types can be used.
+func (u *upgrader) waitForAPIExtensions(ctx context.Context, r resource.Slice) error {
+	if len(r) == 0 {
+		return nil
+	}
+
+	u.logger.Infof("waiting for %s to become ready", pluralize.Pluralize("API extension", len(r), true))
+
+	for _, res := range r {
+		err := u.client.Wait(ctx, kubernetes.WaitOptions{
+			Kind:    res.Kind,
+			Name:    res.Name,
+			For:     apiExtensionConditions[res.Kind],
+			Timeout: u.waitTimeout(),
+		})
+
+		if err != nil {
+			return errors.Wrapf(err, "waiting for %s failed", res)
+		}
+	}
+
+	return errors.Wrap(u.client.RefreshDiscovery(ctx), "failed to refresh API discovery")
 }
 
-// execHooks executes given hooks. It will delete the hooks from the cluster
-// prior to applying them to ensure that Job resources are recreated properly.
-// This is a no-op if dry-run mode is enabled.
+// waitForResources waits for the rollout of the workload resources in r to
+// complete and for custom conditions set via the kcm/wait annotation to be
+// met. All waits share the configured timeout. This is a no-op if waiting is
+// disabled or dry-run mode is enabled.
+func (u *upgrader) waitForResources(ctx context.Context, r resource.Slice) error {
+	if !u.options.Wait || u.options.DryRun {
+		return nil
+	}
+
+	resources := make(resource.Slice, 0)
+
+	for _, res := range r {
+		if !res.SkipWait && (res.WaitFor != "" || res.HasRollout()) {
+			resources = append(resources, res)
+		}
+	}
+
+	return u.awaitResources(ctx, resources)
+}
+
+// awaitResources waits for all resources to become ready. Resources
+// that are annotated with a wait condition are waited for until the
+// condition is met, all others until their rollout finished.
+func (u *upgrader) awaitResources(ctx context.Context, resources resource.Slice) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	timeout := u.waitTimeout()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	u.logger.Infof("waiting for %s to become ready", pluralize.Pluralize("resource", len(resources), true))
+
+	pool := workerpool.New(MaxWorkers)
+	errs := &multierror.Error{}
+
+	var mu sync.Mutex
+
+	for _, res := range resources {
+		r := res
+
+		pool.Submit(func() {
+			var err error
+
+			if r.WaitFor != "" {
+				err = u.client.Wait(ctx, kubernetes.WaitOptions{
+					Kind:      r.Kind,
+					Name:      r.Name,
+					Namespace: r.Namespace,
+					For:       r.WaitFor,
+					Timeout:   timeout,
+				})
+			} else {
+				err = u.client.RolloutStatus(ctx, kubernetes.RolloutStatusOptions{
+					Kind:      r.Kind,
+					Name:      r.Name,
+					Namespace: r.Namespace,
+					Timeout:   timeout,
+				})
+			}
+
+			if err != nil {
+				mu.Lock()
+				errs = multierror.Append(errs, errors.Wrapf(err, "waiting for %s failed", r))
+				mu.Unlock()
+			}
+		})
+	}
+
+	pool.StopWait()
+
+	return errs.ErrorOrNil()
+}
+
+// waitTimeout returns the wait timeout configured for the component that is
+// currently upgraded, the global wait timeout or DefaultWaitTimeout if none
+// is set.
+func (u *upgrader) waitTimeout() time.Duration {
+	if timeout := u.options.ComponentWaitTimeouts[u.component]; timeout > 0 {
+		return timeout
+	}
+
+	if u.options.WaitTimeout <= 0 {
+		return DefaultWaitTimeout
+	}
+
+	return u.options.WaitTimeout
+}
+
+// execHooks executes given hooks in groups ordered by their weight. It will
+// delete the hooks from the cluster prior to applying them to ensure that Job
+// and Pod resources are recreated properly. This is a no-op if dry-run mode
+// is enabled, unless server-side dry run is enabled.
 func (u *upgrader) execHooks(ctx context.Context, hooks hook.Slice) error {
 	if u.options.NoHooks || hooks == nil {
 		return nil
@@ -299,17 +738,43 @@ func (u *upgrader) execHooks(ctx context.Context, hooks hook.Slice) error {
 
 	u.resourcePrinter.PrintSlice(r)
 
+	if u.serverDryRun() {
+		u.dryRunHooks(ctx, hooks)
+		return nil
+	}
+
 	if u.options.DryRun {
 		u.logger.Debug("skipping hooks due to dry run")
 		return nil
 	}
 
-	err := u.deleteResources(ctx, r)
+	for _, group := range hooks.Sort().Groups() {
+		err := u.execHookGroup(ctx, group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execHookGroup executes a group of hooks with the same weight in parallel
+// and waits for all of them to finish.
+func (u *upgrader) execHookGroup(ctx context.Context, hooks hook.Slice) error {
+	stale := make(resource.Slice, 0, len(hooks))
+
+	for _, h := range hooks {
+		if h.DeleteBeforeCreation {
+			stale = append(stale, h.Resource)
+		}
+	}
+
+	err := u.deleteResources(ctx, stale)
 	if err != nil {
 		return err
 	}
 
-	err = u.applyResources(ctx, r)
+	err = u.applyResources(ctx, hooks.Resources())
 	if err != nil {
 		return err
 	}
@@ -323,6 +788,8 @@ func (u *upgrader) waitForHooks(ctx context.Context, hooks hook.Slice) error {
 	pool := workerpool.New(MaxWorkers)
 	errs := &multierror.Error{}
 
+	var mu sync.Mutex
+
 	for _, hook := range hooks {
 		if hook.WaitFor == "" {
 			continue
@@ -331,23 +798,11 @@ func (u *upgrader) waitForHooks(ctx context.Context, hooks hook.Slice) error {
 		h := hook
 
 		pool.Submit(func() {
-			u.logger.Infof("waiting for hook %s", h.String())
-
-			err := u.client.Wait(ctx, kubernetes.WaitOptions{
-				Kind:      h.Resource.Kind,
-				Name:      h.Resource.Name,
-				Namespace: h.Resource.Namespace,
-				For:       h.WaitFor,
-				Timeout:   h.WaitTimeout,
-			})
-
+			err := u.waitForHook(ctx, h)
 			if err != nil {
-				errs = multierror.Append(errs, errors.Wrapf(err, "waiting for hook %s failed", h))
-			} else if h.DeleteAfterCompletion {
-				err := u.client.DeleteManifest(ctx, h.Resource.Content)
-				if err != nil {
-					errs = multierror.Append(errs, errors.Wrapf(err, "failed to delete hook %s", h))
-				}
+				mu.Lock()
+				errs = multierror.Append(errs, err)
+				mu.Unlock()
 			}
 		})
 	}
@@ -357,16 +812,83 @@ func (u *upgrader) waitForHooks(ctx context.Context, hooks hook.Slice) error {
 	return errs.ErrorOrNil()
 }
 
+// waitForHook waits for the WaitFor condition of h to be met. If the hook
+// fails or times out, its logs are printed and it is deleted unless it has
+// the keep-on-failure policy. Failures of hooks with the ignore-failure
+// policy are only logged.
+func (u *upgrader) waitForHook(ctx context.Context, h *hook.Hook) error {
+	u.logger.Infof("waiting for hook %s", h.String())
+
+	err := u.client.Wait(ctx, kubernetes.WaitOptions{
+		Kind:      h.Resource.Kind,
+		Name:      h.Resource.Name,
+		Namespace: h.Resource.Namespace,
+		For:       h.WaitFor,
+		Timeout:   h.WaitTimeout,
+	})
+	if err == nil {
+		if !h.DeleteAfterCompletion {
+			return nil
+		}
+
+		return errors.Wrapf(u.client.DeleteManifest(ctx, h.Resource.Content), "failed to delete hook %s", h)
+	}
+
+	err = errors.Wrapf(err, "waiting for hook %s failed", h)
+
+	u.printHookLogs(ctx, h)
+
+	if !h.KeepOnFailure {
+		if err := u.client.DeleteManifest(ctx, h.Resource.Content); err != nil {
+			u.logger.Warnf("failed to delete hook %s: %s", h, err.Error())
+		}
+	}
+
+	if h.IgnoreFailure {
+		u.logger.Warnf("ignoring failed hook due to policy %q: %s", hook.IgnoreFailurePolicy, err.Error())
+		return nil
+	}
+
+	return err
+}
+
+// printHookLogs prints the logs of Job and Pod hooks. Failing to fetch the
+// logs is not fatal, e.g. the pod may never have been scheduled.
+func (u *upgrader) printHookLogs(ctx context.Context, h *hook.Hook) {
+	if h.Resource.Kind != resource.Job && h.Resource.Kind != resource.Pod {
+		return
+	}
+
+	logs, err := u.client.Logs(ctx, h.Resource.Head())
+	if err != nil {
+		u.logger.Warnf("failed to fetch logs of hook %s: %s", h, err.Error())
+		return
+	}
+
+	logs = strings.TrimRight(logs, "\n")
+	if logs == "" {
+		return
+	}
+
+	for _, line := range strings.Split(logs, "\n") {
+		u.logger.Warnf("%s: %s", h.Resource, line)
+	}
+}
+
 func (u *upgrader) setupUpgradeContext(name string) {
 	prefix := color.MagentaString(name)
 
 	u.logger = logrus.WithContext(log.ContextWithPrefix(prefix))
+	u.component = name
 
 	u.setupPrinters()
 }
 
 func (u *upgrader) resetUpgradeContext() {
 	u.logger = logrus.NewEntry(logrus.StandardLogger())
+	u.ownership = nil
+	u.dryRunErrs = nil
+	u.component = ""
 
 	u.setupPrinters()
 }
@@ -2,8 +2,10 @@ package revision
 
 import (
 	"context"
+	"errors"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/hook"
 	"github.com/martinohmann/kubernetes-cluster-manager/pkg/kubernetes"
@@ -15,10 +17,16 @@ import (
 )
 
 type mockClient struct {
-	applyCalled          uint64
-	deleteCalled         uint64
-	waitCalled           uint64
-	deleteResourceCalled uint64
+	applyCalled            uint64
+	deleteCalled           uint64
+	waitCalled             uint64
+	rolloutStatusCalled    uint64
+	refreshDiscoveryCalled uint64
+	removeLabelsCalled     uint64
+	deleteResourceCalled   uint64
+	logsCalled             uint64
+	applyDryRunCalled      uint64
+	deleteDryRunCalled     uint64
 }
 
 func (c *mockClient) ApplyManifest(ctx context.Context, buf []byte) error {
@@ -31,6 +39,16 @@ func (c *mockClient) DeleteManifest(ctx context.Context, buf []byte) error {
 	return nil
 }
 
+func (c *mockClient) ApplyManifestDryRun(ctx context.Context, buf []byte) error {
+	atomic.AddUint64(&c.applyDryRunCalled, 1)
+	return nil
+}
+
+func (c *mockClient) DeleteManifestDryRun(ctx context.Context, buf []byte) error {
+	atomic.AddUint64(&c.deleteDryRunCalled, 1)
+	return nil
+}
+
 func (c *mockClient) DeleteResource(ctx context.Context, selector resource.Head) error {
 	atomic.AddUint64(&c.deleteResourceCalled, 1)
 	return nil
@@ -41,6 +59,26 @@ func (c *mockClient) Wait(ctx context.Context, o kubernetes.WaitOptions) error {
 	return nil
 }
 
+func (c *mockClient) RolloutStatus(ctx context.Context, o kubernetes.RolloutStatusOptions) error {
+	atomic.AddUint64(&c.rolloutStatusCalled, 1)
+	return nil
+}
+
+func (c *mockClient) RemoveLabels(ctx context.Context, head resource.Head, keys ...string) error {
+	atomic.AddUint64(&c.removeLabelsCalled, 1)
+	return nil
+}
+
+func (c *mockClient) Logs(ctx context.Context, head resource.Head) (string, error) {
+	atomic.AddUint64(&c.logsCalled, 1)
+	return "", nil
+}
+
+func (c *mockClient) RefreshDiscovery(ctx context.Context) error {
+	atomic.AddUint64(&c.refreshDiscoveryCalled, 1)
+	return nil
+}
+
 func TestUpgrader_Upgrade(t *testing.T) {
 	client := &mockClient{}
 
@@ -143,7 +181,8 @@ func TestUpgrader_execHooks(t *testing.T) {
 
 	hooks := hook.Slice{
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "foo",
 				Kind: resource.Job,
@@ -152,14 +191,16 @@ func TestUpgrader_execHooks(t *testing.T) {
 			DeleteAfterCompletion: true,
 		},
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "bar",
 				Kind: resource.Job,
 			},
 		},
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "baz",
 				Kind: resource.Job,
@@ -184,7 +225,8 @@ func TestUpgrader_execHooksDryRun(t *testing.T) {
 
 	hooks := hook.Slice{
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "foo",
 				Kind: resource.Job,
@@ -193,14 +235,16 @@ func TestUpgrader_execHooksDryRun(t *testing.T) {
 			DeleteAfterCompletion: true,
 		},
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "bar",
 				Kind: resource.Job,
 			},
 		},
 		{
-			Type: hook.PreCreate,
+			Type:                 hook.PreCreate,
+			DeleteBeforeCreation: true,
 			Resource: &resource.Resource{
 				Name: "baz",
 				Kind: resource.Job,
@@ -219,3 +263,680 @@ func TestUpgrader_execHooksDryRun(t *testing.T) {
 	assert.Equal(t, uint64(0), client.waitCalled)
 	assert.Equal(t, uint64(0), client.applyCalled)
 }
+
+func TestUpgrader_waitForResources(t *testing.T) {
+	resources := resource.Slice{
+		{Kind: resource.Deployment, Name: "foo"},
+		{Kind: resource.StatefulSet, Name: "bar"},
+		{Kind: resource.DaemonSet, Name: "baz", SkipWait: true},
+		{Kind: "ConfigMap", Name: "qux"},
+		{Kind: "Certificate", Name: "quux", WaitFor: "condition=Ready"},
+	}
+
+	cases := []struct {
+		name                  string
+		options               *UpgraderOptions
+		expectedWaits         uint64
+		expectedRolloutStatus uint64
+	}{
+		{
+			name:    "waiting disabled",
+			options: &UpgraderOptions{},
+		},
+		{
+			name:    "dry run",
+			options: &UpgraderOptions{Wait: true, DryRun: true},
+		},
+		{
+			name:                  "waiting enabled",
+			options:               &UpgraderOptions{Wait: true},
+			expectedWaits:         1,
+			expectedRolloutStatus: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &mockClient{}
+
+			u := &upgrader{client: client, logger: log.NewEntry(log.StandardLogger()), options: tc.options}
+
+			require.NoError(t, u.waitForResources(context.Background(), resources))
+
+			assert.Equal(t, tc.expectedWaits, client.waitCalled)
+			assert.Equal(t, tc.expectedRolloutStatus, client.rolloutStatusCalled)
+		})
+	}
+}
+
+type failingRolloutClient struct {
+	mockClient
+}
+
+func (c *failingRolloutClient) RolloutStatus(ctx context.Context, o kubernetes.RolloutStatusOptions) error {
+	return errors.New("deployment exceeded its progress deadline")
+}
+
+func TestUpgrader_UpgradeSkipsPostHooksIfRolloutFails(t *testing.T) {
+	client := &failingRolloutClient{}
+
+	next := &manifest.Manifest{
+		Name: "foo",
+		Resources: resource.Slice{
+			{Kind: resource.Deployment, Name: "foo", Content: []byte("kind: Deployment\n")},
+		},
+		Hooks: hook.SliceMap{
+			hook.PostCreate: hook.Slice{
+				{
+					Type:     hook.PostCreate,
+					Resource: &resource.Resource{Kind: resource.Job, Name: "bar"},
+				},
+			},
+		},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{NoSave: true, Wait: true})
+
+	err := u.Upgrade(context.Background(), &Revision{Next: next})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiting for deployment/foo failed")
+
+	// only the resources were applied, the post-create hook was skipped
+	assert.Equal(t, uint64(1), client.applyCalled)
+	assert.Equal(t, uint64(0), client.deleteCalled)
+}
+
+type recordingClient struct {
+	mockClient
+	applied [][]byte
+	waits   []kubernetes.WaitOptions
+}
+
+func (c *recordingClient) ApplyManifest(ctx context.Context, buf []byte) error {
+	c.applied = append(c.applied, buf)
+	return nil
+}
+
+func (c *recordingClient) Wait(ctx context.Context, o kubernetes.WaitOptions) error {
+	c.waits = append(c.waits, o)
+	return nil
+}
+
+func TestUpgrader_applyResourcesWaitsForAPIExtensions(t *testing.T) {
+	client := &recordingClient{}
+
+	u := NewUpgrader(client, &UpgraderOptions{}).(*upgrader)
+
+	resources := resource.Slice{
+		{Kind: "Certificate", Name: "foo", Content: []byte("kind: Certificate")},
+		{Kind: resource.APIService, Name: "v1beta1.metrics.k8s.io", Content: []byte("kind: APIService")},
+		{Kind: resource.Deployment, Name: "bar", Content: []byte("kind: Deployment")},
+		{Kind: resource.CustomResourceDefinition, Name: "certificates.example.com", Content: []byte("kind: CustomResourceDefinition")},
+	}
+
+	require.NoError(t, u.applyResources(context.Background(), resources))
+
+	require.Len(t, client.applied, 2)
+	assert.Equal(t, "---\nkind: CustomResourceDefinition\n", string(client.applied[0]))
+	assert.Equal(t, "---\nkind: Deployment\n---\nkind: APIService\n---\nkind: Certificate\n", string(client.applied[1]))
+
+	expectedWaits := []kubernetes.WaitOptions{
+		{Kind: resource.CustomResourceDefinition, Name: "certificates.example.com", For: "condition=Established", Timeout: DefaultWaitTimeout},
+		{Kind: resource.APIService, Name: "v1beta1.metrics.k8s.io", For: "condition=Available", Timeout: DefaultWaitTimeout},
+	}
+
+	assert.Equal(t, expectedWaits, client.waits)
+	assert.Equal(t, uint64(2), client.refreshDiscoveryCalled)
+}
+
+func TestUpgrader_applyResourcesWithoutAPIExtensions(t *testing.T) {
+	client := &recordingClient{}
+
+	u := NewUpgrader(client, &UpgraderOptions{}).(*upgrader)
+
+	resources := resource.Slice{
+		{Kind: resource.Deployment, Name: "bar", Content: []byte("kind: Deployment")},
+	}
+
+	require.NoError(t, u.applyResources(context.Background(), resources))
+
+	assert.Len(t, client.applied, 1)
+	assert.Empty(t, client.waits)
+	assert.Equal(t, uint64(0), client.refreshDiscoveryCalled)
+}
+
+func TestUpgrader_UpgradeAddsOwnershipLabels(t *testing.T) {
+	client := &recordingClient{}
+
+	next := &manifest.Manifest{
+		Name: "foo",
+		Resources: resource.Slice{
+			{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap\nmetadata:\n  name: bar\n")},
+		},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{NoSave: true, InstanceID: "prod"})
+
+	require.NoError(t, u.Upgrade(context.Background(), &Revision{Next: next}))
+
+	require.Len(t, client.applied, 1)
+	assert.Contains(t, string(client.applied[0]), "kcm/component: foo")
+	assert.Contains(t, string(client.applied[0]), "kcm/instance: prod")
+	assert.Contains(t, string(client.applied[0]), "kcm/revision: "+resource.Revision(next.Content()))
+
+	// the manifest content itself is not modified
+	assert.NotContains(t, string(next.Content()), "kcm/instance")
+}
+
+func TestUpgrader_UpgradeInvalidInstanceID(t *testing.T) {
+	u := NewUpgrader(&mockClient{}, &UpgraderOptions{NoSave: true, InstanceID: "prod/eu"})
+
+	err := u.Upgrade(context.Background(), &Revision{Next: &manifest.Manifest{Name: "foo"}})
+
+	assert.Error(t, err)
+}
+
+type deleteRecordingClient struct {
+	mockClient
+	deleted [][]byte
+	heads   []resource.Head
+}
+
+func (c *deleteRecordingClient) DeleteManifest(ctx context.Context, buf []byte) error {
+	c.deleted = append(c.deleted, buf)
+	return nil
+}
+
+func (c *deleteRecordingClient) RemoveLabels(ctx context.Context, head resource.Head, keys ...string) error {
+	c.heads = append(c.heads, head)
+	return nil
+}
+
+func TestUpgrader_UpgradeKeepsResources(t *testing.T) {
+	cases := []struct {
+		name          string
+		options       *UpgraderOptions
+		revision      func(current, next *manifest.Manifest) *Revision
+		expectedHeads []resource.Head
+	}{
+		{
+			name:    "component removal",
+			options: &UpgraderOptions{NoSave: true, InstanceID: "prod"},
+			revision: func(current, next *manifest.Manifest) *Revision {
+				return &Revision{Current: current}
+			},
+			expectedHeads: []resource.Head{
+				{Kind: "Namespace", Metadata: resource.Metadata{Name: "foo"}},
+			},
+		},
+		{
+			name:    "resource removal",
+			options: &UpgraderOptions{NoSave: true, InstanceID: "prod"},
+			revision: func(current, next *manifest.Manifest) *Revision {
+				return &Revision{Current: current, Next: next}
+			},
+			expectedHeads: []resource.Head{
+				{Kind: "Namespace", Metadata: resource.Metadata{Name: "foo"}},
+			},
+		},
+		{
+			name:    "without instance ID",
+			options: &UpgraderOptions{NoSave: true},
+			revision: func(current, next *manifest.Manifest) *Revision {
+				return &Revision{Current: current}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			current := &manifest.Manifest{
+				Name: "foo",
+				Resources: resource.Slice{
+					{Kind: "Namespace", Name: "foo", Keep: true, Content: []byte("kind: Namespace")},
+					{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap")},
+				},
+			}
+
+			next := &manifest.Manifest{
+				Name: "foo",
+				Resources: resource.Slice{
+					{Kind: "Secret", Name: "baz", Content: []byte("kind: Secret\nmetadata:\n  name: baz\n")},
+				},
+			}
+
+			client := &deleteRecordingClient{}
+
+			u := NewUpgrader(client, tc.options)
+
+			require.NoError(t, u.Upgrade(context.Background(), tc.revision(current, next)))
+
+			require.Len(t, client.deleted, 1)
+			assert.Equal(t, "---\nkind: ConfigMap\n", string(client.deleted[0]))
+			assert.Equal(t, tc.expectedHeads, client.heads)
+		})
+	}
+}
+
+type replacingClient struct {
+	mockClient
+	calls       []string
+	applyErrors []error
+}
+
+func (c *replacingClient) ApplyManifest(ctx context.Context, buf []byte) error {
+	c.calls = append(c.calls, "apply: "+string(buf))
+
+	if len(c.applyErrors) == 0 {
+		return nil
+	}
+
+	err := c.applyErrors[0]
+	c.applyErrors = c.applyErrors[1:]
+
+	return err
+}
+
+func (c *replacingClient) DeleteManifest(ctx context.Context, buf []byte) error {
+	c.calls = append(c.calls, "delete: "+string(buf))
+	return nil
+}
+
+func TestUpgrader_UpgradeReplacesResources(t *testing.T) {
+	client := &replacingClient{}
+
+	rev := &Revision{
+		Current: &manifest.Manifest{
+			Name: "foo",
+			Resources: resource.Slice{
+				{Kind: resource.Job, Name: "foo", Content: []byte("spec:\n  template: foo")},
+			},
+		},
+		Next: &manifest.Manifest{
+			Name: "foo",
+			Resources: resource.Slice{
+				{Kind: resource.Job, Name: "foo", UpdateStrategy: resource.RecreateUpdateStrategy, Content: []byte("spec:\n  template: bar")},
+			},
+		},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{NoSave: true})
+
+	require.NoError(t, u.Upgrade(context.Background(), rev))
+
+	expected := []string{
+		"delete: ---\nspec:\n  template: bar\n",
+		"apply: ---\nspec:\n  template: bar\n",
+	}
+
+	assert.Equal(t, expected, client.calls)
+}
+
+func TestUpgrader_applyManifestRecreatesOnImmutableFieldErrors(t *testing.T) {
+	immutableErr := errors.New(`The Job "foo" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable`)
+
+	cases := []struct {
+		name          string
+		resources     resource.Slice
+		expectedCalls []string
+		expectedErr   string
+	}{
+		{
+			name: "recreate update strategy",
+			resources: resource.Slice{
+				{Kind: resource.Job, Name: "foo", UpdateStrategy: resource.RecreateUpdateStrategy, Content: []byte("kind: Job")},
+				{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap")},
+			},
+			expectedCalls: []string{
+				"apply: ---\nkind: Job\n---\nkind: ConfigMap\n",
+				"delete: ---\nkind: Job\n",
+				"apply: ---\nkind: Job\n---\nkind: ConfigMap\n",
+			},
+		},
+		{
+			name: "fail update strategy",
+			resources: resource.Slice{
+				{Kind: resource.Job, Name: "foo", Content: []byte("kind: Job")},
+			},
+			expectedCalls: []string{
+				"apply: ---\nkind: Job\n",
+			},
+			expectedErr: `set the kcm/update-strategy annotation to "recreate"`,
+		},
+		{
+			name: "unknown resource",
+			resources: resource.Slice{
+				{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap")},
+			},
+			expectedCalls: []string{
+				"apply: ---\nkind: ConfigMap\n",
+			},
+			expectedErr: "field is immutable",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &replacingClient{applyErrors: []error{immutableErr}}
+
+			u := NewUpgrader(client, &UpgraderOptions{}).(*upgrader)
+
+			err := u.applyManifest(context.Background(), tc.resources)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedCalls, client.calls)
+		})
+	}
+}
+
+func TestFindRecreatable(t *testing.T) {
+	err := errors.New("field is immutable")
+
+	r := resource.Slice{
+		{Kind: resource.Job, Name: "foo", Namespace: "bar", UpdateStrategy: resource.RecreateUpdateStrategy},
+		{Kind: resource.Job, Name: "foo", Namespace: "baz"},
+		{Kind: resource.Job, Name: "qux", UpdateStrategy: resource.RecreateUpdateStrategy},
+	}
+
+	cases := []struct {
+		name        string
+		failed      []resource.Head
+		expected    resource.Slice
+		expectedErr string
+	}{
+		{
+			name:     "namespace known",
+			failed:   []resource.Head{{Kind: resource.Job, Metadata: resource.Metadata{Name: "foo", Namespace: "bar"}}},
+			expected: resource.Slice{r[0]},
+		},
+		{
+			name:        "namespace unknown",
+			failed:      []resource.Head{{Kind: resource.Job, Metadata: resource.Metadata{Name: "foo"}}},
+			expectedErr: "immutable fields of baz/job/foo",
+		},
+		{
+			name:     "resource without namespace",
+			failed:   []resource.Head{{Kind: resource.Job, Metadata: resource.Metadata{Name: "qux", Namespace: "default"}}},
+			expected: resource.Slice{r[2]},
+		},
+		{
+			name:        "namespace mismatch",
+			failed:      []resource.Head{{Kind: resource.Job, Metadata: resource.Metadata{Name: "foo", Namespace: "other"}}},
+			expectedErr: "field is immutable",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recreate, err := findRecreatable(r, tc.failed, err)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, recreate)
+			}
+		})
+	}
+}
+
+type pvcRecordingClient struct {
+	mockClient
+	deletedResources []resource.Head
+}
+
+func (c *pvcRecordingClient) DeleteResource(ctx context.Context, head resource.Head) error {
+	c.deletedResources = append(c.deletedResources, head)
+	return nil
+}
+
+func TestUpgrader_UpgradeDeletesOrphanedPersistentVolumeClaims(t *testing.T) {
+	newRevision := func() *Revision {
+		return &Revision{
+			Current: &manifest.Manifest{
+				Name: "foo",
+				Resources: resource.Slice{
+					{Kind: resource.StatefulSet, Name: "web", DeletePersistentVolumeClaims: true, Content: []byte("metadata:\n  name: web\nspec:\n  replicas: 2\n  volumeClaimTemplates:\n  - metadata:\n      name: data")},
+				},
+			},
+			Next: &manifest.Manifest{
+				Name: "foo",
+				Resources: resource.Slice{
+					{Kind: resource.StatefulSet, Name: "web", DeletePersistentVolumeClaims: true, Content: []byte("metadata:\n  name: web\nspec:\n  replicas: 1\n  volumeClaimTemplates:\n  - metadata:\n      name: data")},
+				},
+			},
+		}
+	}
+
+	t.Run("waits for rollout", func(t *testing.T) {
+		client := &pvcRecordingClient{}
+
+		u := NewUpgrader(client, &UpgraderOptions{NoSave: true})
+
+		require.NoError(t, u.Upgrade(context.Background(), newRevision()))
+
+		expected := []resource.Head{
+			{Kind: resource.PersistentVolumeClaim, Metadata: resource.Metadata{Name: "data-web-1"}},
+		}
+
+		assert.Equal(t, expected, client.deletedResources)
+		assert.Equal(t, uint64(1), client.rolloutStatusCalled)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := &pvcRecordingClient{}
+
+		u := NewUpgrader(client, &UpgraderOptions{NoSave: true, DryRun: true})
+
+		require.NoError(t, u.Upgrade(context.Background(), newRevision()))
+
+		assert.Empty(t, client.deletedResources)
+		assert.Equal(t, uint64(0), client.rolloutStatusCalled)
+	})
+}
+
+func TestUpgrader_execHooksInWeightedGroups(t *testing.T) {
+	client := &replacingClient{}
+
+	hooks := hook.Slice{
+		{Type: hook.PreUpgrade, Weight: 1, DeleteBeforeCreation: true, Resource: &resource.Resource{Kind: resource.Job, Name: "migrate", Content: []byte("kind: Job")}},
+		{Type: hook.PreUpgrade, DeleteBeforeCreation: true, Resource: &resource.Resource{Kind: "ConfigMap", Name: "flags", Content: []byte("kind: ConfigMap")}},
+		{Type: hook.PreUpgrade, DeleteBeforeCreation: true, Resource: &resource.Resource{Kind: resource.Pod, Name: "check", Content: []byte("kind: Pod")}},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{NoSave: true}).(*upgrader)
+	u.setupUpgradeContext("foo")
+
+	require.NoError(t, u.execHooks(context.Background(), hooks))
+
+	expected := []string{
+		"delete: ---\nkind: Pod\n---\nkind: ConfigMap\n",
+		"apply: ---\nkind: ConfigMap\n---\nkind: Pod\n",
+		"delete: ---\nkind: Job\n",
+		"apply: ---\nkind: Job\n",
+	}
+
+	assert.Equal(t, expected, client.calls)
+}
+
+type failingHookClient struct {
+	mockClient
+	logs []resource.Head
+}
+
+func (c *failingHookClient) Wait(ctx context.Context, o kubernetes.WaitOptions) error {
+	return errors.New("timed out waiting for the condition")
+}
+
+func (c *failingHookClient) Logs(ctx context.Context, head resource.Head) (string, error) {
+	c.logs = append(c.logs, head)
+	return "running migrations\nmigration failed\n", nil
+}
+
+func TestUpgrader_execHooksFailurePolicies(t *testing.T) {
+	cases := []struct {
+		name          string
+		hook          *hook.Hook
+		expectedErr   bool
+		expectDeletes uint64
+	}{
+		{
+			name:          "default",
+			hook:          &hook.Hook{DeleteBeforeCreation: true},
+			expectedErr:   true,
+			expectDeletes: 2,
+		},
+		{
+			name:          "keep on failure",
+			hook:          &hook.Hook{DeleteBeforeCreation: true, KeepOnFailure: true},
+			expectedErr:   true,
+			expectDeletes: 1,
+		},
+		{
+			name:          "ignore failure",
+			hook:          &hook.Hook{IgnoreFailure: true},
+			expectDeletes: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &failingHookClient{}
+
+			h := tc.hook
+			h.Type = hook.PreUpgrade
+			h.WaitFor = "condition=complete"
+			h.Resource = &resource.Resource{Kind: resource.Job, Name: "migrate", Namespace: "foo", Content: []byte("kind: Job")}
+
+			u := NewUpgrader(client, &UpgraderOptions{NoSave: true}).(*upgrader)
+			u.setupUpgradeContext("foo")
+
+			err := u.execHooks(context.Background(), hook.Slice{h})
+			if tc.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "waiting for hook pre-upgrade/foo/job/migrate")
+			} else {
+				require.NoError(t, err)
+			}
+
+			expectedLogs := []resource.Head{
+				{Kind: resource.Job, Metadata: resource.Metadata{Name: "migrate", Namespace: "foo"}},
+			}
+
+			assert.Equal(t, expectedLogs, client.logs)
+			assert.Equal(t, tc.expectDeletes, client.deleteCalled)
+		})
+	}
+}
+
+func TestUpgrader_waitTimeout(t *testing.T) {
+	u := NewUpgrader(&mockClient{}, &UpgraderOptions{
+		WaitTimeout:           2 * time.Minute,
+		ComponentWaitTimeouts: map[string]time.Duration{"foo": 10 * time.Minute},
+	}).(*upgrader)
+
+	assert.Equal(t, 2*time.Minute, u.waitTimeout())
+
+	u.setupUpgradeContext("foo")
+	assert.Equal(t, 10*time.Minute, u.waitTimeout())
+
+	u.setupUpgradeContext("bar")
+	assert.Equal(t, 2*time.Minute, u.waitTimeout())
+
+	u.resetUpgradeContext()
+	assert.Equal(t, 2*time.Minute, u.waitTimeout())
+
+	u = NewUpgrader(&mockClient{}, nil).(*upgrader)
+	assert.Equal(t, DefaultWaitTimeout, u.waitTimeout())
+}
+
+type dryRunClient struct {
+	mockClient
+	applied []string
+	deleted []string
+	errors  map[string]error
+}
+
+func (c *dryRunClient) ApplyManifestDryRun(ctx context.Context, buf []byte) error {
+	c.applied = append(c.applied, string(buf))
+	return c.errors[string(buf)]
+}
+
+func (c *dryRunClient) DeleteManifestDryRun(ctx context.Context, buf []byte) error {
+	c.deleted = append(c.deleted, string(buf))
+	return c.errors[string(buf)]
+}
+
+func TestUpgrader_UpgradeServerDryRun(t *testing.T) {
+	client := &dryRunClient{
+		errors: map[string]error{
+			"---\nkind: Deployment\n":  errors.New(`admission webhook "validate.example.com" denied the request`),
+			"---\nkind: ConfigMap\n":   errors.New(`configmaps "bar" is forbidden`),
+			"---\nkind: Certificate\n": errors.New(`no matches for kind "Certificate" in version "example.com/v1"`),
+			"---\nkind: Secret\n":      errors.New(`namespaces "monitoring" not found`),
+		},
+	}
+
+	rev := &Revision{
+		Current: &manifest.Manifest{
+			Name: "foo",
+			Resources: resource.Slice{
+				{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap")},
+			},
+		},
+		Next: &manifest.Manifest{
+			Name: "foo",
+			Resources: resource.Slice{
+				{Kind: resource.Deployment, Name: "baz", Content: []byte("kind: Deployment")},
+				{Kind: resource.CustomResourceDefinition, Name: "certificates.example.com", Content: []byte("kind: CustomResourceDefinition\nspec:\n  names:\n    kind: Certificate\n  scope: Namespaced")},
+				{Kind: "Certificate", Name: "qux", Content: []byte("kind: Certificate")},
+				{Kind: "Namespace", Name: "monitoring", Content: []byte("kind: Namespace")},
+				{Kind: "Secret", Name: "grafana", Namespace: "monitoring", Content: []byte("kind: Secret")},
+			},
+			Hooks: hook.SliceMap{
+				hook.PreUpgrade: hook.Slice{
+					{Type: hook.PreUpgrade, Resource: &resource.Resource{Kind: resource.Job, Name: "migrate", Content: []byte("kind: Job")}},
+				},
+			},
+		},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{DryRun: true, ServerDryRun: true})
+
+	err := u.Upgrade(context.Background(), rev)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server dry run of deployment/baz failed")
+	assert.Contains(t, err.Error(), "server dry run of configmap/bar failed")
+	assert.NotContains(t, err.Error(), "certificate/qux")
+	assert.NotContains(t, err.Error(), "secret/grafana")
+
+	assert.Equal(t, []string{"---\nkind: ConfigMap\n"}, client.deleted)
+	assert.Len(t, client.applied, 6)
+	assert.Equal(t, uint64(0), client.applyCalled)
+	assert.Equal(t, uint64(0), client.deleteCalled)
+}
+
+func TestUpgrader_UpgradeServerDryRunRequiresDryRun(t *testing.T) {
+	client := &dryRunClient{}
+
+	next := &manifest.Manifest{
+		Name: "foo",
+		Resources: resource.Slice{
+			{Kind: "ConfigMap", Name: "bar", Content: []byte("kind: ConfigMap")},
+		},
+	}
+
+	u := NewUpgrader(client, &UpgraderOptions{NoSave: true, ServerDryRun: true})
+
+	require.NoError(t, u.Upgrade(context.Background(), &Revision{Next: next}))
+
+	assert.Empty(t, client.applied)
+	assert.Equal(t, uint64(1), client.applyCalled)
+}